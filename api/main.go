@@ -21,6 +21,7 @@ func initRouter() *gin.Engine {
 
 	pg := configs.InitDbConfig()
 	libs.InitRedis()
+	libs.InitJWTKeys()
 
 	router = routers.InitRouter(pg)
 	router.Use(gin.Recovery())
@@ -0,0 +1,345 @@
+package controllers
+
+import (
+	"coffeeder-backend/libs"
+	"coffeeder-backend/models"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Mengganti password dengan memasukkan password saat ini. Password baru harus memenuhi password policy, dan semua sesi lain diakhiri
+// @Tags Profile
+// @Accept json
+// @Produce json
+// @Param body body models.ChangePasswordRequest true "Change password payload"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.Response
+// @Failure 401 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Security BearerAuth
+// @Router /profile/password [patch]
+func (uc *UserController) ChangePassword(ctx *gin.Context) {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	if err := libs.Validate.Struct(req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    libs.FormatValidationError(err),
+		})
+		return
+	}
+
+	email, hashed, err := models.GetUserCredentials(uc.DB, userID)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to fetch user",
+		})
+		return
+	}
+
+	if ok, _ := libs.VerifyPassword(req.CurrentPassword, hashed); !ok {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    map[string]string{"currentpassword": "Password saat ini salah"},
+		})
+		return
+	}
+
+	if fieldErrors, err := checkNewPassword(uc.DB, userID, "newpassword", req.NewPassword); err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to check password",
+		})
+		return
+	} else if fieldErrors != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    fieldErrors,
+		})
+		return
+	}
+
+	newHash, err := libs.HashPassword(req.NewPassword)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to hash password",
+		})
+		return
+	}
+
+	if err := models.UpdatePassword(uc.DB, userID, newHash); err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to change password",
+		})
+		return
+	}
+
+	// Tokens from API keys carry no session; the current session is kept
+	// either way so the caller stays logged in.
+	ended, err := models.RevokeOtherSessions(uc.DB, userID, ctx.GetString("sessionID"))
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Password changed, but other sessions could not be ended",
+		})
+		return
+	}
+	for _, sid := range ended {
+		libs.RevokeSessionAccessTokens(sid)
+	}
+
+	err = libs.SendOTPEmail(libs.SendOptions{
+		To:      []string{email},
+		Subject: "Your Coffeeder password was changed",
+		Body:    "The password of your Coffeeder account was just changed and your other sessions were logged out. If this wasn't you, reset your password immediately.",
+	})
+	if err != nil {
+		fmt.Println("Failed to send password change notice:", err)
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Password changed successfully",
+	})
+}
+
+// RequestEmailChange godoc
+// @Summary Request email change
+// @Description Mengirim link konfirmasi ke email baru (dan pemberitahuan ke email lama). Email baru berlaku setelah link dikonfirmasi
+// @Tags Profile
+// @Accept json
+// @Produce json
+// @Param body body models.ChangeEmailRequest true "Change email payload"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.Response
+// @Failure 401 {object} models.Response
+// @Failure 409 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Security BearerAuth
+// @Router /profile/email [post]
+func (uc *UserController) RequestEmailChange(ctx *gin.Context) {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	var req models.ChangeEmailRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	if err := libs.Validate.Struct(req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    libs.FormatValidationError(err),
+		})
+		return
+	}
+
+	email, hashed, err := models.GetUserCredentials(uc.DB, userID)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to fetch user",
+		})
+		return
+	}
+
+	if ok, _ := libs.VerifyPassword(req.Password, hashed); !ok {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    map[string]string{"password": "Password salah"},
+		})
+		return
+	}
+
+	status, message := uc.startEmailChange(userID, email, req.NewEmail)
+	ctx.JSON(status, models.Response{
+		Success: status == 200,
+		Message: message,
+	})
+}
+
+// startEmailChange mails a confirmation link to newEmail and a notice to
+// oldEmail. It returns the status and message to respond with.
+func (uc *UserController) startEmailChange(userID int64, oldEmail, newEmail string) (int, string) {
+	newEmail = strings.TrimSpace(newEmail)
+	if strings.EqualFold(oldEmail, newEmail) {
+		return 400, "New email is the same as the current email"
+	}
+
+	registered, err := models.IsEmailRegistered(uc.DB, newEmail)
+	if err != nil {
+		return 500, "Failed to check email"
+	}
+	if registered {
+		return 409, "Email already registered"
+	}
+
+	ttl := libs.GetEnvDuration("EMAIL_CHANGE_TTL", time.Hour)
+	// The token records the address it was issued from, so it stops working
+	// once the email has changed, including through another link.
+	token, _, err := libs.GenerateActionTokenWithRef("email-change", strconv.FormatInt(userID, 10), newEmail, oldEmail, ttl)
+	if err != nil {
+		return 500, "Failed to generate token"
+	}
+
+	link := libs.FrontendURL("/confirm-email", url.Values{"token": {token}})
+	err = libs.SendOTPEmail(libs.SendOptions{
+		To:      []string{newEmail},
+		Subject: "Confirm your new Coffeeder email",
+		Body: fmt.Sprintf("Confirm that you want to use this address for your Coffeeder account by opening this link: %s\n\nThe link expires in %s.",
+			link, ttl),
+	})
+	if err != nil {
+		fmt.Println("Failed to send email change confirmation:", err)
+		return 500, "Failed to send confirmation email"
+	}
+
+	err = libs.SendOTPEmail(libs.SendOptions{
+		To:      []string{oldEmail},
+		Subject: "Email change requested on your Coffeeder account",
+		Body: fmt.Sprintf("A request was made to change the email of your Coffeeder account to %s. Nothing changes until the new address is confirmed. If this wasn't you, change your password.",
+			newEmail),
+	})
+	if err != nil {
+		fmt.Println("Failed to send email change notice:", err)
+	}
+
+	return 200, "Confirmation link sent to the new email"
+}
+
+// ConfirmEmailChange godoc
+// @Summary Confirm email change
+// @Description Mengganti email dengan token dari link konfirmasi. Token hanya bisa dipakai sekali; setelah berhasil semua sesi harus login ulang
+// @Tags Profile
+// @Accept json
+// @Produce json
+// @Param body body models.ConfirmEmailChangeRequest true "Confirmation token"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.Response
+// @Failure 401 {object} models.Response
+// @Failure 409 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /profile/email/confirm [post]
+func (uc *UserController) ConfirmEmailChange(ctx *gin.Context) {
+	var req models.ConfirmEmailChangeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	claims, err := libs.ParseActionToken(req.Token, "email-change")
+	if err != nil || libs.IsTokenDenied(claims.ID) {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired token",
+		})
+		return
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired token",
+		})
+		return
+	}
+
+	oldEmail := claims.Ref
+	if oldEmail == "" {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired token",
+		})
+		return
+	}
+
+	err = models.ChangeEmail(uc.DB, userID, oldEmail, claims.Email)
+	if errors.Is(err, models.ErrEmailChanged) {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired token",
+		})
+		return
+	}
+	if errors.Is(err, models.ErrEmailTaken) {
+		ctx.JSON(409, models.Response{
+			Success: false,
+			Message: "Email already registered",
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to change email",
+		})
+		return
+	}
+
+	libs.DenyToken(claims.ID, claims.ExpiresAt.Time)
+
+	// Existing tokens still carry the old email.
+	models.RevokeUserRefreshTokens(uc.DB, userID)
+	libs.RevokeUserAccessTokens(int(userID))
+
+	err = libs.SendOTPEmail(libs.SendOptions{
+		To:      []string{oldEmail},
+		Subject: "Your Coffeeder email was changed",
+		Body: fmt.Sprintf("The email of your Coffeeder account was changed to %s. If this wasn't you, contact support.",
+			claims.Email),
+	})
+	if err != nil {
+		fmt.Println("Failed to send email change notice:", err)
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Email changed successfully, please login again",
+	})
+}
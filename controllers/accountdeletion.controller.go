@@ -0,0 +1,374 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"coffeeder-backend/libs"
+	"coffeeder-backend/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ExportProfile godoc
+// @Summary Export my data
+// @Description Mengunduh data pribadi: profile, cart, dan riwayat order beserta item. format=json (default) mengembalikan data di response, format=zip mengirim file account.json di dalam arsip ZIP
+// @Tags Profile
+// @Produce json
+// @Produce application/zip
+// @Param format query string false "json or zip"
+// @Success 200 {object} models.Response{data=models.AccountExport}
+// @Failure 400 {object} models.Response
+// @Failure 401 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Security BearerAuth
+// @Router /profile/export [get]
+func (uc *UserController) ExportProfile(ctx *gin.Context) {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	format := ctx.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "format must be json or zip",
+		})
+		return
+	}
+
+	export, err := models.GetAccountExport(uc.DB, userID)
+	if err != nil {
+		fmt.Println("Failed to export account:", err)
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to export data",
+		})
+		return
+	}
+
+	if format == "json" {
+		ctx.JSON(200, models.Response{
+			Success: true,
+			Message: "Data exported successfully",
+			Data:    export,
+		})
+		return
+	}
+
+	archive, err := accountExportZip(export)
+	if err != nil {
+		fmt.Println("Failed to build export archive:", err)
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to export data",
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("coffeeder-account-%d-%s.zip", userID, export.ExportedAt.Format("20060102"))
+	ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Data(200, "application/zip", archive)
+}
+
+func accountExportZip(export *models.AccountExport) ([]byte, error) {
+	body, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     "account.json",
+		Method:   zip.Deflate,
+		Modified: export.ExportedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DeleteAccount godoc
+// @Summary Delete my account
+// @Description Menjadwalkan penghapusan akun setelah masa tenggang (ACCOUNT_DELETION_GRACE, default 14 hari). Selama masa tenggang penghapusan bisa dibatalkan. Setelahnya data pribadi di users, profile, dan transactions dianonimkan; riwayat order tetap disimpan untuk keperluan akuntansi. Tanpa password (mis. akun dari social login) link konfirmasi dikirim ke email dan penghapusan dijadwalkan lewat /profile/deletion/confirm
+// @Tags Profile
+// @Accept json
+// @Produce json
+// @Param body body models.DeleteAccountRequest true "Current password, or empty to confirm by email"
+// @Success 200 {object} models.Response{data=models.AccountDeletionResponse}
+// @Failure 400 {object} models.Response
+// @Failure 401 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Security BearerAuth
+// @Router /profile [delete]
+func (uc *UserController) DeleteAccount(ctx *gin.Context) {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	var req models.DeleteAccountRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	email, hashed, err := models.GetUserCredentials(uc.DB, userID)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to fetch user",
+		})
+		return
+	}
+
+	if req.Password == "" {
+		uc.sendAccountDeletionLink(ctx, userID, email)
+		return
+	}
+
+	if ok, _ := libs.VerifyPassword(req.Password, hashed); !ok {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    map[string]string{"password": "Password salah"},
+		})
+		return
+	}
+
+	uc.scheduleAccountDeletion(ctx, userID, email)
+}
+
+// sendAccountDeletionLink emails a link that confirms the deletion, for
+// accounts that can't (or don't want to) confirm with a password.
+func (uc *UserController) sendAccountDeletionLink(ctx *gin.Context, userID int64, email string) {
+	ttl := libs.GetEnvDuration("ACCOUNT_DELETION_LINK_TTL", time.Hour)
+	token, _, err := libs.GenerateActionToken("account-deletion", strconv.FormatInt(userID, 10), email, ttl)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to generate token",
+		})
+		return
+	}
+
+	link := libs.FrontendURL("/confirm-account-deletion", url.Values{"token": {token}})
+	err = libs.SendOTPEmail(libs.SendOptions{
+		To:      []string{email},
+		Subject: "Confirm deleting your Coffeeder account",
+		Body: fmt.Sprintf("Open this link to confirm that you want to delete your Coffeeder account: %s\n\nThe link expires in %s. If this wasn't you, ignore this email and change your password.",
+			link, ttl),
+	})
+	if err != nil {
+		fmt.Println("Failed to send account deletion confirmation:", err)
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to send confirmation email",
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Confirmation link sent to your email",
+	})
+}
+
+func (uc *UserController) scheduleAccountDeletion(ctx *gin.Context, userID int64, email string) {
+	grace := libs.GetEnvDuration("ACCOUNT_DELETION_GRACE", 14*24*time.Hour)
+	deletion, err := models.ScheduleAccountDeletion(uc.DB, userID, time.Now().Add(grace))
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to schedule account deletion",
+		})
+		return
+	}
+
+	err = libs.SendOTPEmail(libs.SendOptions{
+		To:      []string{email},
+		Subject: "Your Coffeeder account will be deleted",
+		Body: fmt.Sprintf("Your Coffeeder account is scheduled for deletion on %s. Until then you can log in and cancel it from your profile. After that date your personal data is removed and cannot be recovered.\n\nIf this wasn't you, log in, cancel the deletion and change your password.",
+			deletion.ScheduledAt.Format("2 January 2006 15:04 MST")),
+	})
+	if err != nil {
+		fmt.Println("Failed to send account deletion notice:", err)
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Account deletion scheduled",
+		Data:    deletion,
+	})
+}
+
+// ConfirmAccountDeletion godoc
+// @Summary Confirm account deletion
+// @Description Menjadwalkan penghapusan akun dengan token dari link konfirmasi yang dikirim DELETE /profile tanpa password
+// @Tags Profile
+// @Accept json
+// @Produce json
+// @Param body body models.ConfirmAccountDeletionRequest true "Confirmation token"
+// @Success 200 {object} models.Response{data=models.AccountDeletionResponse}
+// @Failure 400 {object} models.Response
+// @Failure 401 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /profile/deletion/confirm [post]
+func (uc *UserController) ConfirmAccountDeletion(ctx *gin.Context) {
+	var req models.ConfirmAccountDeletionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	if err := libs.Validate.Struct(req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    libs.FormatValidationError(err),
+		})
+		return
+	}
+
+	claims, err := libs.ParseActionToken(req.Token, "account-deletion")
+	if err != nil {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired token",
+		})
+		return
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired token",
+		})
+		return
+	}
+
+	// The link only counts for the address it was sent to.
+	email, _, err := models.GetUserCredentials(uc.DB, userID)
+	if err != nil || !strings.EqualFold(email, claims.Email) {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired token",
+		})
+		return
+	}
+
+	uc.scheduleAccountDeletion(ctx, userID, email)
+}
+
+// CancelAccountDeletion godoc
+// @Summary Cancel account deletion
+// @Description Membatalkan penghapusan akun yang masih dalam masa tenggang
+// @Tags Profile
+// @Produce json
+// @Success 200 {object} models.Response
+// @Failure 401 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Security BearerAuth
+// @Router /profile/deletion/cancel [post]
+func (uc *UserController) CancelAccountDeletion(ctx *gin.Context) {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	err := models.CancelAccountDeletion(uc.DB, userID)
+	if errors.Is(err, models.ErrNoDeletionScheduled) {
+		ctx.JSON(404, models.Response{
+			Success: false,
+			Message: "No account deletion is scheduled",
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to cancel account deletion",
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Account deletion cancelled",
+	})
+}
+
+// RunAccountDeletions godoc
+// @Summary Anonymise due accounts
+// @Description Menganonimkan akun yang masa tenggang penghapusannya sudah lewat. Server biasa menjalankannya otomatis (ACCOUNT_DELETION_SWEEP_INTERVAL); di deployment serverless panggil endpoint ini dari cron job
+// @Tags Users
+// @Produce json
+// @Success 200 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Security BearerAuth
+// @Router /admin/users/deletions/run [post]
+func (uc *UserController) RunAccountDeletions(ctx *gin.Context) {
+	ids, err := SweepAccountDeletions(uc.DB)
+	if err != nil {
+		fmt.Println("Failed to anonymise accounts:", err)
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to anonymise accounts",
+			Data:    map[string]int{"anonymized": len(ids)},
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Due accounts anonymised",
+		Data:    map[string]int{"anonymized": len(ids)},
+	})
+}
+
+// SweepAccountDeletions anonymises the accounts whose grace period is over and
+// invalidates their remaining access tokens.
+func SweepAccountDeletions(db *pgxpool.Pool) ([]int64, error) {
+	ids, err := models.AnonymizeDueAccounts(db)
+	for _, id := range ids {
+		libs.RevokeUserAccessTokens(int(id))
+	}
+	return ids, err
+}
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"coffeeder-backend/libs"
+	"coffeeder-backend/models"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type APIKeyController struct {
+	DB *pgxpool.Pool
+}
+
+// CreateAPIKey godoc
+// @Summary Create an API key
+// @Description Membuat API key untuk POS atau service internal. Key hanya ditampilkan sekali; yang disimpan hanya hash dan prefix. Jika userId diisi, key bertindak sebagai user tersebut dan scope dibatasi oleh permission role-nya
+// @Tags API Keys
+// @Accept json
+// @Produce json
+// @Param body body models.APIKeyRequest true "API key payload"
+// @Success 201 {object} models.Response{data=models.APIKeyCreated}
+// @Failure 400 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/api-keys [post]
+func (kc *APIKeyController) CreateAPIKey(ctx *gin.Context) {
+	adminID, ok := currentUserID(ctx)
+	if !ok {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	var req models.APIKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	if err := libs.Validate.Struct(req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    libs.FormatAPIKeyValidationError(err),
+		})
+		return
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "expiresAt must be in the future",
+		})
+		return
+	}
+
+	unknown, err := models.UnknownPermissions(kc.DB, req.Scopes)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to validate scopes",
+		})
+		return
+	}
+	if len(unknown) > 0 {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Unknown scopes: " + strings.Join(unknown, ", "),
+		})
+		return
+	}
+
+	if req.UserID != nil {
+		if _, err := models.GetUserByID(kc.DB, *req.UserID); err != nil {
+			ctx.JSON(400, models.Response{
+				Success: false,
+				Message: "User not found",
+			})
+			return
+		}
+	}
+
+	key, prefix, err := libs.GenerateAPIKey()
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to generate API key",
+		})
+		return
+	}
+
+	apiKey, err := models.CreateAPIKey(kc.DB, req, prefix, libs.HashToken(key), adminID)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to create API key",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(201, models.Response{
+		Success: true,
+		Message: "API key created, copy it now because it will not be shown again",
+		Data: models.APIKeyCreated{
+			APIKey: apiKey,
+			Key:    key,
+		},
+	})
+}
+
+// GetAPIKeys godoc
+// @Summary List API keys
+// @Description Menampilkan semua API key (prefix, scope, status, terakhir dipakai) tanpa nilai key-nya
+// @Tags API Keys
+// @Produce json
+// @Success 200 {object} models.Response{data=[]models.APIKey}
+// @Failure 500 {object} models.Response
+// @Router /admin/api-keys [get]
+func (kc *APIKeyController) GetAPIKeys(ctx *gin.Context) {
+	keys, err := models.GetAPIKeys(kc.DB)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to fetch API keys",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "API keys fetched successfully",
+		Data:    keys,
+	})
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Description Mencabut API key; request berikutnya dengan key tersebut langsung ditolak
+// @Tags API Keys
+// @Produce json
+// @Param id path int true "API key ID"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/api-keys/{id} [delete]
+func (kc *APIKeyController) RevokeAPIKey(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid API key ID",
+		})
+		return
+	}
+
+	if err := models.RevokeAPIKey(kc.DB, id); err != nil {
+		if errors.Is(err, models.ErrAPIKeyNotFound) {
+			ctx.JSON(404, models.Response{
+				Success: false,
+				Message: "API key not found or already revoked",
+			})
+			return
+		}
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to revoke API key",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "API key revoked successfully",
+	})
+}
@@ -4,7 +4,10 @@ import (
 	"coffeeder-backend/libs"
 	"coffeeder-backend/models"
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,13 +20,13 @@ type AuthController struct {
 }
 
 // Register godoc
-// @Summary      Register a new user or admin
-// @Description  Create a new user account. If role is "admin", response message will indicate admin registration success.
+// @Summary      Register a new user
+// @Description  Create a new customer account. The role is always "customer"; staff accounts are created through invitations.
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
 // @Param        body  body      models.UserRegister  true  "Register Payload"
-// @Success      201   {object}  models.Response{data=models.UserResponse}  "User or Admin registered successfully"
+// @Success      201   {object}  models.Response{data=models.UserResponse}  "User registered successfully"
 // @Failure      400   {object}  models.Response  "Invalid request body or validation failed"
 // @Failure      409   {object}  models.Response  "Email already registered"
 // @Failure      500   {object}  models.Response  "Internal server error"
@@ -50,6 +53,21 @@ func (ac *AuthController) Register(ctx *gin.Context) {
 		return
 	}
 
+	if fieldErrors, err := checkNewPassword(ac.DB, 0, "password", req.Password); err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to check password",
+		})
+		return
+	} else if fieldErrors != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    fieldErrors,
+		})
+		return
+	}
+
 	hashed, err := libs.HashPassword(req.Password)
 	if err != nil {
 		ctx.JSON(500, models.Response{
@@ -75,32 +93,160 @@ func (ac *AuthController) Register(ctx *gin.Context) {
 		return
 	}
 
-	if req.Role == "admin" {
-		ctx.JSON(201, models.Response{
+	message := "User registered successfully, please check your email to verify your account"
+	if err := sendVerificationEmail(user.ID, user.Email); err != nil {
+		fmt.Println("Failed to send verification email:", err)
+		message = "User registered successfully, but the verification email could not be sent"
+	}
+
+	ctx.JSON(201, models.Response{
+		Success: true,
+		Message: message,
+		Data:    user,
+	})
+}
+
+// sendVerificationEmail mails a signed link that verifies email for userID.
+func sendVerificationEmail(userID int64, email string) error {
+	ttl := libs.GetEnvDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour)
+	token, _, err := libs.GenerateActionToken("verify-email", strconv.FormatInt(userID, 10), email, ttl)
+	if err != nil {
+		return err
+	}
+
+	link := libs.FrontendURL("/verify-email", url.Values{"token": {token}})
+	return libs.SendOTPEmail(libs.SendOptions{
+		To:      []string{email},
+		Subject: "Verify your Coffeeder email",
+		Body: fmt.Sprintf("Please verify your email address by opening this link: %s\n\nThe link expires in %s.",
+			link, ttl),
+	})
+}
+
+// VerifyEmail godoc
+// @Summary      Verify email
+// @Description  Verify the user's email address using the signed token from the verification link
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      models.VerifyEmailRequest  true  "Verification token"
+// @Success      200   {object}  models.Response
+// @Failure      400   {object}  models.Response
+// @Failure      401   {object}  models.Response
+// @Failure      500   {object}  models.Response
+// @Router       /auth/verify-email [post]
+func (ac *AuthController) VerifyEmail(ctx *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	claims, err := libs.ParseActionToken(req.Token, "verify-email")
+	if err != nil {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired verification link",
+		})
+		return
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired verification link",
+		})
+		return
+	}
+
+	updated, err := models.MarkEmailVerified(ac.DB, userID, claims.Email)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to verify email",
+		})
+		return
+	}
+	if !updated {
+		verified, err := models.IsEmailVerified(ac.DB, userID)
+		if err != nil || !verified {
+			ctx.JSON(401, models.Response{
+				Success: false,
+				Message: "Invalid or expired verification link",
+			})
+			return
+		}
+		ctx.JSON(200, models.Response{
 			Success: true,
-			Message: "Admin registered successfully",
-			Data:    user,
+			Message: "Email already verified",
 		})
 		return
 	}
 
-	ctx.JSON(201, models.Response{
+	ctx.JSON(200, models.Response{
 		Success: true,
-		Message: "User registered successfully",
-		Data:    user,
+		Message: "Email verified successfully",
 	})
 }
 
+// ResendVerification godoc
+// @Summary      Resend verification email
+// @Description  Send a new verification link. The response is the same whether or not the email is registered.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      models.ResendVerificationRequest  true  "Email"
+// @Success      200   {object}  models.Response
+// @Failure      400   {object}  models.Response
+// @Failure      500   {object}  models.Response
+// @Router       /auth/resend-verification [post]
+func (ac *AuthController) ResendVerification(ctx *gin.Context) {
+	var req models.ResendVerificationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "If the email is registered and not yet verified, a verification link has been sent",
+	}
+
+	user, _, _, err := models.LoginUser(ac.DB, req.Email)
+	if err != nil || user.EmailVerifiedAt != nil {
+		ctx.JSON(200, response)
+		return
+	}
+
+	if err := sendVerificationEmail(user.ID, user.Email); err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to send verification email, please check SMTP configuration",
+		})
+		return
+	}
+
+	ctx.JSON(200, response)
+}
+
 // Login godoc
 // @Summary      User login
-// @Description  Login using email and password
+// @Description  Login using email and password. Users with two-factor authentication enabled receive a challenge token instead, to be exchanged at /auth/2fa/verify.
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
 // @Param        login  body      models.UserLogin  true  "Login Payload"
-// @Success      200  {object}  models.Response{data=models.UserResponse}
+// @Success      200  {object}  models.Response{data=models.UserResponse}  "Access token and refresh token, or models.TwoFactorChallengeResponse"
 // @Failure      400  {object}  models.Response
 // @Failure      401  {object}  models.Response
+// @Failure      429  {object}  models.Response  "Too many attempts or account locked (see Retry-After)"
 // @Failure      500  {object}  models.Response
 // @Router       /auth/login [post]
 func (ac *AuthController) Login(ctx *gin.Context) {
@@ -127,26 +273,115 @@ func (ac *AuthController) Login(ctx *gin.Context) {
 		return
 	}
 
-	user, hashedPassword, _, err := models.LoginUser(ac.DB, input.Email)
+	lockout, err := models.GetLoginLockout(ac.DB, input.Email)
 	if err != nil {
-		ctx.JSON(401, models.Response{
+		ctx.JSON(500, models.Response{
 			Success: false,
-			Message: "Email or password incorrect",
+			Message: "Failed to check account lockout",
+		})
+		return
+	}
+	if lockout != nil && lockout.IsLocked() {
+		setRetryAfter(ctx, *lockout.LockedUntil)
+		ctx.JSON(429, models.Response{
+			Success: false,
+			Message: "Account temporarily locked due to too many failed login attempts",
 		})
 		return
 	}
 
+	user, hashedPassword, _, err := models.LoginUser(ac.DB, input.Email)
+	if err != nil {
+		ac.loginFailed(ctx, input.Email, nil)
+		return
+	}
+
 	ok, err := libs.VerifyPassword(input.Password, hashedPassword)
 	if err != nil || !ok {
-		ctx.JSON(401, models.Response{
+		ac.loginFailed(ctx, input.Email, user)
+		return
+	}
+
+	models.ClearLoginLockout(ac.DB, input.Email)
+	ac.completeLogin(ctx, user)
+}
+
+// loginFailed records a failed login and responds. Unknown emails are counted
+// too so the response does not reveal whether an account exists; only real
+// accounts get the lockout notification.
+func (ac *AuthController) loginFailed(ctx *gin.Context, email string, user *models.UserResponse) {
+	maxFailed := libs.GetEnvInt("LOGIN_MAX_FAILED", 5)
+	lockoutDuration := libs.GetEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute)
+	window := libs.GetEnvDuration("LOGIN_FAILURE_WINDOW", lockoutDuration)
+
+	lockout, newlyLocked, err := models.RecordFailedLogin(ac.DB, email, ctx.ClientIP(), maxFailed, window, lockoutDuration)
+	if err != nil {
+		fmt.Println("Failed to record failed login:", err)
+	}
+
+	if newlyLocked && user != nil {
+		err := libs.SendOTPEmail(libs.SendOptions{
+			To:      []string{user.Email},
+			Subject: "Your Coffeeder account has been temporarily locked",
+			Body: fmt.Sprintf("We blocked sign-in to your account after %d failed login attempts (last from IP %s).\n\nYou can try again after %s. If this wasn't you, please reset your password.",
+				lockout.FailedCount, ctx.ClientIP(), lockout.LockedUntil.Format(time.RFC1123)),
+		})
+		if err != nil {
+			fmt.Println("Failed to send lockout email:", err)
+		}
+	}
+
+	if lockout.Locked {
+		setRetryAfter(ctx, *lockout.LockedUntil)
+		ctx.JSON(429, models.Response{
 			Success: false,
-			Message: "Email or password incorrect",
+			Message: "Account temporarily locked due to too many failed login attempts",
 		})
 		return
 	}
 
-	token, err := libs.GenerateToken(int(user.ID), user.Email, user.Role)
+	ctx.JSON(401, models.Response{
+		Success: false,
+		Message: "Email or password incorrect",
+	})
+}
+
+// completeLogin finishes a login whose first factor has been checked. Users
+// with 2FA enabled get a short-lived challenge token to exchange at
+// /auth/2fa/verify; everyone else gets their tokens straight away.
+func (ac *AuthController) completeLogin(ctx *gin.Context, user *models.UserResponse) {
+	enabled, err := models.IsTOTPEnabled(ac.DB, user.ID)
 	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to check two-factor authentication",
+		})
+		return
+	}
+
+	if enabled {
+		ttl := libs.GetEnvDuration("TWO_FACTOR_CHALLENGE_TTL", 5*time.Minute)
+		challenge, _, err := libs.GenerateActionToken("2fa", strconv.FormatInt(user.ID, 10), user.Email, ttl)
+		if err != nil {
+			ctx.JSON(500, models.Response{
+				Success: false,
+				Message: "Failed to generate token",
+			})
+			return
+		}
+
+		ctx.JSON(200, models.Response{
+			Success: true,
+			Message: "Two-factor authentication required",
+			Data: models.TwoFactorChallengeResponse{
+				TwoFactorRequired: true,
+				ChallengeToken:    challenge,
+			},
+		})
+		return
+	}
+
+	if err := ac.issueTokens(ctx, user, false); err != nil {
 		ctx.JSON(500, models.Response{
 			Success: false,
 			Message: "Failed to generate token",
@@ -154,18 +389,339 @@ func (ac *AuthController) Login(ctx *gin.Context) {
 		return
 	}
 
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Login success",
+		Data:    user,
+	})
+}
+
+// accessToken signs an access token carrying the permissions of user's role,
+// bound to the session sid.
+func (ac *AuthController) accessToken(user *models.UserResponse, mfa bool, sid string) (string, error) {
+	permissions, err := models.GetRolePermissions(ac.DB, user.Role)
+	if err != nil {
+		return "", err
+	}
+
+	return libs.GenerateToken(libs.UserPayload{
+		Id:          int(user.ID),
+		Email:       user.Email,
+		Role:        user.Role,
+		Permissions: permissions,
+		MFA:         mfa,
+		SessionID:   sid,
+	})
+}
+
+// issueTokens starts a new session for the request's device and fills user
+// with a fresh access token and the first refresh token of the session's
+// token family. The session ID is the family ID.
+func (ac *AuthController) issueTokens(ctx *gin.Context, user *models.UserResponse, mfa bool) error {
+	familyID, err := libs.GenerateRandomToken(16)
+	if err != nil {
+		return err
+	}
+
+	token, err := ac.accessToken(user, mfa, familyID)
+	if err != nil {
+		return err
+	}
+
+	refreshToken, err := libs.GenerateRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(libs.RefreshTokenTTL())
+	err = models.CreateSession(ac.DB, familyID, user.ID, ctx.Request.UserAgent(), ctx.ClientIP(), mfa, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	err = models.CreateRefreshToken(ac.DB, user.ID, familyID, libs.HashToken(refreshToken), mfa, expiresAt)
+	if err != nil {
+		return err
+	}
+
 	user.Token = token
+	user.RefreshToken = refreshToken
+	return nil
+}
+
+// Refresh godoc
+// @Summary      Refresh access token
+// @Description  Exchange a refresh token for a new access token and a rotated refresh token. Reusing an already rotated refresh token revokes its whole token family.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      models.RefreshTokenRequest  true  "Refresh token payload"
+// @Success      200   {object}  models.Response{data=models.TokenResponse}
+// @Failure      400   {object}  models.Response
+// @Failure      401   {object}  models.Response
+// @Failure      500   {object}  models.Response
+// @Router       /auth/refresh [post]
+func (ac *AuthController) Refresh(ctx *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	current, err := models.GetRefreshTokenByHash(ac.DB, libs.HashToken(req.RefreshToken))
+	if err != nil {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid refresh token",
+		})
+		return
+	}
+
+	if current.RevokedAt != nil {
+		models.RevokeRefreshTokenFamily(ac.DB, current.FamilyID)
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Refresh token reuse detected, please login again",
+		})
+		return
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Refresh token expired",
+		})
+		return
+	}
+
+	user, err := models.GetUserByID(ac.DB, current.UserID)
+	if err != nil {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid refresh token",
+		})
+		return
+	}
+
+	refreshToken, err := libs.GenerateRefreshToken()
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to generate token",
+		})
+		return
+	}
+
+	expiresAt := time.Now().Add(libs.RefreshTokenTTL())
+	err = models.RotateRefreshToken(ac.DB, current, libs.HashToken(refreshToken), expiresAt)
+	if errors.Is(err, models.ErrRefreshTokenReused) {
+		models.RevokeRefreshTokenFamily(ac.DB, current.FamilyID)
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Refresh token reuse detected, please login again",
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to rotate refresh token",
+		})
+		return
+	}
+
+	if err := models.TouchSession(ac.DB, current.FamilyID, ctx.ClientIP(), &expiresAt); err != nil {
+		fmt.Println("Failed to record session activity:", err)
+	}
+
+	token, err := ac.accessToken(user, current.MFA, current.FamilyID)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to generate token",
+		})
+		return
+	}
 
 	ctx.JSON(200, models.Response{
 		Success: true,
-		Message: "Login success",
+		Message: "Token refreshed successfully",
+		Data: models.TokenResponse{
+			Token:        token,
+			RefreshToken: refreshToken,
+		},
+	})
+}
+
+// AcceptInvitation godoc
+// @Summary      Accept an admin invitation
+// @Description  Create the invited account using a signed, single-use invitation token and set its password
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      models.AcceptInvitationRequest  true  "Invitation payload"
+// @Success      201   {object}  models.Response{data=models.UserResponse}
+// @Failure      400   {object}  models.Response
+// @Failure      401   {object}  models.Response
+// @Failure      409   {object}  models.Response
+// @Failure      500   {object}  models.Response
+// @Router       /auth/invitations/accept [post]
+func (ac *AuthController) AcceptInvitation(ctx *gin.Context) {
+	var req models.AcceptInvitationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	if err := libs.Validate.Struct(req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    libs.FormatValidationError(err),
+		})
+		return
+	}
+
+	claims, err := libs.ParseActionToken(req.Token, "admin-invite")
+	if err != nil {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired invitation",
+		})
+		return
+	}
+
+	inv, err := models.GetInvitationByTokenHash(ac.DB, libs.HashToken(claims.ID))
+	if err != nil || inv.Status != "pending" || !strings.EqualFold(inv.Email, claims.Email) {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired invitation",
+		})
+		return
+	}
+
+	if fieldErrors, err := checkNewPassword(ac.DB, 0, "password", req.Password); err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to check password",
+		})
+		return
+	} else if fieldErrors != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    fieldErrors,
+		})
+		return
+	}
+
+	hashed, err := libs.HashPassword(req.Password)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to hash password",
+		})
+		return
+	}
+
+	user, err := models.AcceptInvitation(ac.DB, inv, req.Fullname, hashed)
+	if err != nil {
+		if errors.Is(err, models.ErrInvitationNotPending) {
+			ctx.JSON(401, models.Response{
+				Success: false,
+				Message: "Invalid or expired invitation",
+			})
+			return
+		}
+		if err.Error() == "email already registered" {
+			ctx.JSON(409, models.Response{
+				Success: false,
+				Message: "Email already registered",
+			})
+			return
+		}
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to accept invitation",
+		})
+		return
+	}
+
+	ctx.JSON(201, models.Response{
+		Success: true,
+		Message: "Invitation accepted successfully",
 		Data:    user,
 	})
 }
 
+// Logout godoc
+// @Summary      Logout
+// @Description  Revoke the current access token and end its session. A refresh token in the body also revokes the token family it belongs to.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      models.LogoutRequest  false  "Refresh token to revoke"
+// @Success      200   {object}  models.Response
+// @Failure      401   {object}  models.Response
+// @Failure      500   {object}  models.Response
+// @Security     BearerAuth
+// @Router       /auth/logout [post]
+func (ac *AuthController) Logout(ctx *gin.Context) {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	var req models.LogoutRequest
+	_ = ctx.ShouldBindJSON(&req)
+
+	tokenID := ctx.GetString("tokenID")
+	expiresAt := ctx.GetTime("tokenExpiresAt")
+	if err := libs.DenyToken(tokenID, expiresAt); err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to revoke token",
+		})
+		return
+	}
+
+	if sid := ctx.GetString("sessionID"); sid != "" {
+		if err := models.RevokeRefreshTokenFamily(ac.DB, sid); err != nil {
+			ctx.JSON(500, models.Response{
+				Success: false,
+				Message: "Failed to end session",
+			})
+			return
+		}
+		libs.RevokeSessionAccessTokens(sid)
+	}
+
+	if req.RefreshToken != "" {
+		rt, err := models.GetRefreshTokenByHash(ac.DB, libs.HashToken(req.RefreshToken))
+		if err == nil && rt.UserID == userID {
+			models.RevokeRefreshTokenFamily(ac.DB, rt.FamilyID)
+		}
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Logout success",
+	})
+}
+
 // ForgotPassword godoc
 // @Summary      Request password
-// @Description  Generate OTP for user to forgot password
+// @Description  Generate OTP for user to forgot password. Resending is limited by a cooldown and blocked while the OTP is locked.
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
@@ -173,12 +729,12 @@ func (ac *AuthController) Login(ctx *gin.Context) {
 // @Success      200   {object}  models.Response
 // @Failure      400   {object}  models.Response
 // @Failure      404   {object}  models.Response
+// @Failure      429   {object}  models.Response
 // @Failure      500   {object}  models.Response
 // @Router       /auth/forgot-password [post]
 func (ac *AuthController) ForgotPassword(ctx *gin.Context) {
 	var req models.ForgotPasswordRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		fmt.Println("Invalid request body:", err)
 		ctx.JSON(400, models.Response{
 			Success: false,
 			Message: "Invalid request body",
@@ -186,14 +742,11 @@ func (ac *AuthController) ForgotPassword(ctx *gin.Context) {
 		return
 	}
 
-	fmt.Println("ForgotPassword request for email:", req.Email)
-
 	var userID int64
 	err := ac.DB.QueryRow(context.Background(),
 		"SELECT id FROM users WHERE email=$1", req.Email,
 	).Scan(&userID)
 	if err != nil {
-		fmt.Println("User not found:", err)
 		ctx.JSON(404, models.Response{
 			Success: false,
 			Message: "Email not found",
@@ -201,38 +754,38 @@ func (ac *AuthController) ForgotPassword(ctx *gin.Context) {
 		return
 	}
 
-	otp := libs.GenerateOTP(6)
-	fmt.Println("Generated OTP:", otp)
-
-	err = models.CreateForgotPassword(ac.DB, userID, otp, 2*time.Minute)
+	otpService := libs.NewOTPService()
+	otp, fp, err := models.IssuePasswordResetOTP(ac.DB, otpService, userID)
 	if err != nil {
-		fmt.Println("Insert failed, trying to update existing record:", err)
-		_, err2 := ac.DB.Exec(context.Background(),
-			`UPDATE forgot_password 
-			 SET token=$1, expires_at=$2 
-			 WHERE user_id=$3`,
-			otp, time.Now().Add(2*time.Minute), userID,
-		)
-		if err2 != nil {
-			fmt.Println("Failed to update existing ForgotPassword record:", err2)
+		switch {
+		case errors.Is(err, models.ErrOTPLocked):
+			setRetryAfter(ctx, *fp.LockedUntil)
+			ctx.JSON(429, models.Response{
+				Success: false,
+				Message: "Too many invalid attempts, please try again later",
+			})
+		case errors.Is(err, models.ErrOTPCooldown):
+			setRetryAfter(ctx, fp.LastSentAt.Add(otpService.ResendCooldown))
+			ctx.JSON(429, models.Response{
+				Success: false,
+				Message: "OTP was sent recently, please wait before requesting a new one",
+			})
+		default:
 			ctx.JSON(500, models.Response{
 				Success: false,
 				Message: "Failed to generate OTP",
 			})
-			return
 		}
+		return
 	}
 
-	fmt.Println("ForgotPassword record created/updated successfully")
-
 	err = libs.SendOTPEmail(libs.SendOptions{
 		To:         []string{req.Email},
 		Subject:    "OTP Reset Password",
-		Body:       fmt.Sprintf("Your OTP is: %s. It will expire in 2 minutes.", otp),
+		Body:       fmt.Sprintf("Your OTP is: %s. It will expire in %s.", otp, otpService.TTL),
 		BodyIsHTML: false,
 	})
 	if err != nil {
-		fmt.Println("Error sending OTP email:", err)
 		ctx.JSON(500, models.Response{
 			Success: false,
 			Message: "Failed to send OTP email, please check SMTP configuration",
@@ -240,17 +793,15 @@ func (ac *AuthController) ForgotPassword(ctx *gin.Context) {
 		return
 	}
 
-	fmt.Println("OTP sent successfully to email:", req.Email)
 	ctx.JSON(200, models.Response{
 		Success: true,
 		Message: "OTP has been sent to your email",
 	})
 }
 
-
 // VerifyOTP godoc
 // @Summary      Verify OTP
-// @Description  Verify OTP sent to user's email
+// @Description  Verify OTP sent to user's email and return a short-lived reset token. Too many invalid attempts lock the OTP.
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
@@ -258,13 +809,10 @@ func (ac *AuthController) ForgotPassword(ctx *gin.Context) {
 // @Success      200   {object}  models.Response
 // @Failure      400   {object}  models.Response
 // @Failure      401   {object}  models.Response
+// @Failure      429   {object}  models.Response
 // @Router       /auth/verify-otp [post]
 func (ac *AuthController) VerifyOTP(ctx *gin.Context) {
-	var req struct {
-		Email string `json:"email" binding:"required,email"`
-		OTP   string `json:"otp" binding:"required,len=6"`
-	}
-
+	var req models.VerifyOTPRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(400, models.Response{
 			Success: false,
@@ -273,40 +821,67 @@ func (ac *AuthController) VerifyOTP(ctx *gin.Context) {
 		return
 	}
 
-	var userID int64
-	err := ac.DB.QueryRow(context.Background(), "SELECT id FROM users WHERE email=$1", req.Email).Scan(&userID)
-	if err != nil {
-		ctx.JSON(404, models.Response{
+	otpService := libs.NewOTPService()
+	if !otpService.ValidFormat(req.OTP) {
+		ctx.JSON(400, models.Response{
 			Success: false,
-			Message: "Email not found"})
+			Message: fmt.Sprintf("OTP must be %d digits", otpService.Length),
+		})
 		return
 	}
 
-	fp, err := models.GetForgotPasswordByToken(ac.DB, req.OTP)
-	if err != nil || fp.UserID != userID {
+	var userID int64
+	err := ac.DB.QueryRow(context.Background(), "SELECT id FROM users WHERE email=$1", req.Email).Scan(&userID)
+	if err != nil {
 		ctx.JSON(401, models.Response{
 			Success: false,
 			Message: "Invalid OTP"})
 		return
 	}
 
-	if time.Now().After(fp.ExpiresAt) {
-		ctx.JSON(401, models.Response{
+	fp, err := models.VerifyPasswordResetOTP(ac.DB, otpService, userID, req.OTP)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrOTPLocked):
+			setRetryAfter(ctx, *fp.LockedUntil)
+			ctx.JSON(429, models.Response{
+				Success: false,
+				Message: "Too many invalid attempts, please try again later"})
+		case errors.Is(err, models.ErrOTPExpired):
+			ctx.JSON(401, models.Response{
+				Success: false,
+				Message: "OTP expired, please request a new one"})
+		case errors.Is(err, models.ErrOTPInvalid):
+			ctx.JSON(401, models.Response{
+				Success: false,
+				Message: "Invalid OTP"})
+		default:
+			ctx.JSON(500, models.Response{
+				Success: false,
+				Message: "Failed to verify OTP"})
+		}
+		return
+	}
+
+	ttl := libs.GetEnvDuration("OTP_RESET_TTL", 10*time.Minute)
+	token, _, err := libs.GenerateActionTokenWithRef("password-reset", strconv.FormatInt(userID, 10), req.Email, strconv.Itoa(fp.ID), ttl)
+	if err != nil {
+		ctx.JSON(500, models.Response{
 			Success: false,
-			Message: "OTP expired"})
+			Message: "Failed to generate reset token"})
 		return
 	}
 
 	ctx.JSON(200, models.Response{
 		Success: true,
 		Message: "OTP verified successfully",
-		Data:    map[string]string{"token": req.OTP},
+		Data:    map[string]string{"token": token},
 	})
 }
 
 // ResetPassword godoc
 // @Summary      Reset password
-// @Description  Reset user password using OTP token
+// @Description  Reset user password using the token returned by verify-otp
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
@@ -317,11 +892,7 @@ func (ac *AuthController) VerifyOTP(ctx *gin.Context) {
 // @Failure      500   {object}  models.Response
 // @Router       /auth/reset-password [patch]
 func (ac *AuthController) ResetPassword(ctx *gin.Context) {
-	var req struct {
-		Token    string `json:"token" binding:"required"`
-		Password string `json:"password" binding:"required,min=6"`
-	}
-
+	var req models.ResetPasswordRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(400, models.Response{
 			Success: false,
@@ -330,7 +901,23 @@ func (ac *AuthController) ResetPassword(ctx *gin.Context) {
 		return
 	}
 
-	fp, err := models.GetForgotPasswordByToken(ac.DB, req.Token)
+	claims, err := libs.ParseActionToken(req.Token, "password-reset")
+	if err != nil {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired token"})
+		return
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired token"})
+		return
+	}
+
+	fpID, err := strconv.Atoi(claims.Ref)
 	if err != nil {
 		ctx.JSON(401, models.Response{
 			Success: false,
@@ -338,6 +925,21 @@ func (ac *AuthController) ResetPassword(ctx *gin.Context) {
 		return
 	}
 
+	if fieldErrors, err := checkNewPassword(ac.DB, userID, "password", req.Password); err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to check password",
+		})
+		return
+	} else if fieldErrors != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    fieldErrors,
+		})
+		return
+	}
+
 	hashed, err := libs.HashPassword(req.Password)
 	if err != nil {
 		ctx.JSON(500, models.Response{
@@ -346,10 +948,15 @@ func (ac *AuthController) ResetPassword(ctx *gin.Context) {
 		return
 	}
 
-	_, err = ac.DB.Exec(context.Background(),
-		"UPDATE users SET password=$1 WHERE id=$2",
-		hashed, fp.UserID,
-	)
+	// The verified OTP request is consumed together with the password
+	// change, so each reset token works once and only for its own request.
+	err = models.ResetPasswordWithOTP(ac.DB, fpID, userID, hashed)
+	if errors.Is(err, models.ErrOTPInvalid) {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired token"})
+		return
+	}
 	if err != nil {
 		ctx.JSON(500, models.Response{
 			Success: false,
@@ -357,10 +964,23 @@ func (ac *AuthController) ResetPassword(ctx *gin.Context) {
 		return
 	}
 
-	models.DeleteForgotPassword(ac.DB, fp.ID)
+	models.RevokeUserRefreshTokens(ac.DB, userID)
+	libs.RevokeUserAccessTokens(int(userID))
 
 	ctx.JSON(200, models.Response{
 		Success: true,
 		Message: "Password has been reset successfully",
 	})
 }
+
+// JWKS godoc
+// @Summary      JSON Web Key Set
+// @Description  Public keys used to verify access tokens, selected by the token's kid header
+// @Tags         Auth
+// @Produce      json
+// @Success      200   {object}  libs.JWKSet
+// @Router       /.well-known/jwks.json [get]
+func (ac *AuthController) JWKS(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(200, libs.JWKS())
+}
@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentUserID reads the user id stored by middlewares.AuthMiddleware.
+func currentUserID(ctx *gin.Context) (int64, bool) {
+	value, exists := ctx.Get("userID")
+	if !exists {
+		return 0, false
+	}
+
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	case string:
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return id, true
+	}
+	return 0, false
+}
+
+// setRetryAfter sets the Retry-After header (in whole seconds) for a wait ending at until.
+func setRetryAfter(ctx *gin.Context, until time.Time) {
+	seconds := int(math.Ceil(time.Until(until).Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	ctx.Header("Retry-After", strconv.Itoa(seconds))
+}
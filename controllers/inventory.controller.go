@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"coffeeder-backend/libs"
+	"coffeeder-backend/models"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func lowStockThreshold() int {
+	return libs.GetEnvInt("LOW_STOCK_THRESHOLD", 5)
+}
+
+var errNoLowStockRecipients = errors.New("no recipients for low stock alerts")
+
+// NotifyLowStock emails the SKUs that dropped to LOW_STOCK_THRESHOLD or below
+// since the last alert and returns how many were reported. Recipients are
+// LOW_STOCK_ALERT_EMAILS (comma separated) or, when unset, every user allowed
+// to adjust stock. SKUs are only marked as reported once the email is sent, so
+// a failed or interrupted run is retried by the next one.
+func NotifyLowStock(db *pgxpool.Pool) (int, error) {
+	skus, err := models.GetUnalertedLowStockSKUs(db, lowStockThreshold())
+	if err != nil || len(skus) == 0 {
+		return 0, err
+	}
+
+	ids := make([]int64, 0, len(skus))
+	lines := make([]string, 0, len(skus))
+	for _, k := range skus {
+		ids = append(ids, k.SkuID)
+		name := k.Title
+		var options []string
+		if k.SizeName != nil {
+			options = append(options, *k.SizeName)
+		}
+		if k.VariantName != nil {
+			options = append(options, *k.VariantName)
+		}
+		if len(options) > 0 {
+			name += " (" + strings.Join(options, " / ") + ")"
+		}
+		lines = append(lines, fmt.Sprintf("- %s: %d left (SKU %d)", name, k.Stock, k.SkuID))
+	}
+
+	var recipients []string
+	for _, email := range strings.Split(os.Getenv("LOW_STOCK_ALERT_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			recipients = append(recipients, email)
+		}
+	}
+	if len(recipients) == 0 {
+		recipients, err = models.GetInventoryManagerEmails(db)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if len(recipients) == 0 {
+		return 0, errNoLowStockRecipients
+	}
+
+	err = libs.SendOTPEmail(libs.SendOptions{
+		To:      recipients,
+		Subject: fmt.Sprintf("Low stock: %d item(s) at or below %d", len(skus), lowStockThreshold()),
+		Body:    "These items are running low and should be restocked:\n\n" + strings.Join(lines, "\n"),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(skus), models.MarkLowStockAlerted(db, ids)
+}
+
+// RunLowStockAlerts godoc
+// @Summary Send low-stock alerts
+// @Description Mengirim email low-stock untuk SKU yang belum dilaporkan. Server biasa menjalankannya otomatis (LOW_STOCK_SWEEP_INTERVAL); di deployment serverless panggil endpoint ini dari cron job
+// @Tags Inventory
+// @Produce json
+// @Success 200 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/inventory/low-stock/notify [post]
+func (pc *ProductController) RunLowStockAlerts(ctx *gin.Context) {
+	count, err := NotifyLowStock(pc.DB)
+	if err != nil {
+		fmt.Println("Failed to send low stock alerts:", err)
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to send low stock alerts",
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Low stock alerts sent",
+		Data:    map[string]int{"alerted": count},
+	})
+}
+
+// AdjustStock godoc
+// @Summary Record a stock adjustment
+// @Description Menambah atau mengurangi stok satu SKU dan mencatatnya di stock ledger. quantity bertanda (negatif = kurangi); restock/refund harus positif, waste harus negatif
+// @Tags Inventory
+// @Accept json
+// @Produce json
+// @Param body body models.StockAdjustmentRequest true "Adjustment"
+// @Success 201 {object} models.Response{data=models.StockMovement}
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 409 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/inventory/adjustments [post]
+func (pc *ProductController) AdjustStock(ctx *gin.Context) {
+	var req models.StockAdjustmentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+			Data:    err.Error(),
+		})
+		return
+	}
+	if err := libs.Validate.Struct(req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	userID, _ := currentUserID(ctx)
+	movement, err := models.AdjustStock(pc.DB, req, userID)
+	switch {
+	case errors.Is(err, models.ErrStockReasonSign):
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	case errors.Is(err, pgx.ErrNoRows):
+		ctx.JSON(404, models.Response{
+			Success: false,
+			Message: "SKU not found",
+		})
+		return
+	case errors.Is(err, models.ErrStockSKUNotInOrder):
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "SKU is not part of this order",
+		})
+		return
+	case errors.Is(err, models.ErrStockOrderNotFound):
+		ctx.JSON(404, models.Response{
+			Success: false,
+			Message: "Order not found",
+		})
+		return
+	case errors.Is(err, models.ErrInsufficientStock):
+		ctx.JSON(409, models.Response{
+			Success: false,
+			Message: "Not enough stock for this adjustment",
+		})
+		return
+	case err != nil:
+		fmt.Println("Failed to adjust stock:", err)
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to adjust stock",
+		})
+		return
+	}
+
+	ClearProductCache()
+
+	ctx.JSON(201, models.Response{
+		Success: true,
+		Message: "Stock adjusted successfully",
+		Data:    movement,
+	})
+}
+
+// GetStockMovements godoc
+// @Summary Product stock movement history
+// @Description Riwayat perubahan stok product (sale, restock, adjustment, refund, waste), terbaru dulu
+// @Tags Inventory
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param sku_id query int false "Filter by SKU"
+// @Param reason query string false "Filter by reason (sale, restock, adjustment, refund, waste)"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(10)
+// @Success 200 {object} models.ProductListResponse{data=[]models.StockMovement}
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/products/{id}/stock-movements [get]
+func (pc *ProductController) GetStockMovements(ctx *gin.Context) {
+	productID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid product ID",
+		})
+		return
+	}
+
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 10
+	}
+	skuID, _ := strconv.ParseInt(ctx.Query("sku_id"), 10, 64)
+
+	reason := ctx.Query("reason")
+	switch reason {
+	case "", models.StockReasonSale, models.StockReasonRestock, models.StockReasonAdjustment,
+		models.StockReasonRefund, models.StockReasonWaste:
+	default:
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid reason",
+		})
+		return
+	}
+
+	if _, err := models.GetProductByID(pc.DB, productID); err != nil {
+		ctx.JSON(404, models.Response{
+			Success: false,
+			Message: "Product not found",
+		})
+		return
+	}
+
+	movements, total, err := models.GetStockMovements(pc.DB, productID, skuID, reason, page, limit)
+	if err != nil {
+		fmt.Println("Failed to fetch stock movements:", err)
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to fetch stock movements",
+		})
+		return
+	}
+
+	basePath := fmt.Sprintf("/admin/products/%d/stock-movements", productID)
+	pagination, links := libs.BuildHateoasGlobal(basePath, page, limit, total, ctx.Request.URL.Query())
+	ctx.JSON(200, models.ProductListResponse{
+		Success:    true,
+		Message:    "Stock movements fetched successfully",
+		Pagination: pagination,
+		Links:      links,
+		Data:       movements,
+	})
+}
+
+// GetLowStock godoc
+// @Summary List low-stock SKUs
+// @Description Mengambil SKU aktif dengan stok di bawah atau sama dengan threshold (default LOW_STOCK_THRESHOLD)
+// @Tags Inventory
+// @Produce json
+// @Param threshold query int false "Stock threshold"
+// @Success 200 {object} models.Response{data=[]models.LowStockSKU}
+// @Failure 500 {object} models.Response
+// @Router /admin/inventory/low-stock [get]
+func (pc *ProductController) GetLowStock(ctx *gin.Context) {
+	threshold := lowStockThreshold()
+	if t, err := strconv.Atoi(ctx.Query("threshold")); err == nil && t >= 0 {
+		threshold = t
+	}
+
+	skus, err := models.GetLowStockSKUs(pc.DB, threshold)
+	if err != nil {
+		fmt.Println("Failed to fetch low stock SKUs:", err)
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to fetch low stock SKUs",
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Low stock SKUs fetched successfully",
+		Data:    skus,
+	})
+}
@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"coffeeder-backend/libs"
+	"coffeeder-backend/models"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type InvitationController struct {
+	DB *pgxpool.Pool
+}
+
+// CreateInvitation godoc
+// @Summary Invite a new admin or staff member
+// @Description Membuat undangan admin/staff (admin, manager, barista) yang ditandatangani, berlaku sementara dan hanya bisa dipakai sekali, lalu mengirim link ke email
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param body body models.InvitationRequest true "Invitation payload"
+// @Success 201 {object} models.Response{data=models.Invitation}
+// @Failure 400 {object} models.Response
+// @Failure 409 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/users/invitations [post]
+func (ic *InvitationController) CreateInvitation(ctx *gin.Context) {
+	adminID, ok := currentUserID(ctx)
+	if !ok {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	var req models.InvitationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	if err := libs.Validate.Struct(req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    libs.FormatAdminUserValidationError(err),
+		})
+		return
+	}
+	if req.Role == "" {
+		req.Role = "admin"
+	}
+
+	exists, err := models.IsEmailRegistered(ic.DB, req.Email)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to check email",
+		})
+		return
+	}
+	if exists {
+		ctx.JSON(409, models.Response{
+			Success: false,
+			Message: "Email already registered",
+		})
+		return
+	}
+
+	ttl := libs.GetEnvDuration("INVITE_TTL", 72*time.Hour)
+	token, claims, err := libs.GenerateActionToken("admin-invite", "", req.Email, ttl)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to generate invitation",
+		})
+		return
+	}
+
+	inv, err := models.CreateInvitation(ic.DB, req.Email, req.Role, adminID, libs.HashToken(claims.ID), claims.ExpiresAt.Time)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to create invitation",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	link := libs.FrontendURL("/invitations/accept", url.Values{"token": {token}})
+	err = libs.SendOTPEmail(libs.SendOptions{
+		To:      []string{req.Email},
+		Subject: "You are invited to Coffeeder",
+		Body: fmt.Sprintf("You have been invited to join Coffeeder as %s.\n\nSet your password here: %s\n\nThis link expires at %s and can only be used once.",
+			inv.Role, link, inv.ExpiresAt.Format(time.RFC1123)),
+	})
+	if err != nil {
+		models.RevokeInvitation(ic.DB, inv.ID)
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to send invitation email, please check SMTP configuration",
+		})
+		return
+	}
+
+	ctx.JSON(201, models.Response{
+		Success: true,
+		Message: "Invitation sent successfully",
+		Data:    inv,
+	})
+}
+
+// GetInvitations godoc
+// @Summary List admin invitations
+// @Description Menampilkan semua undangan admin beserta statusnya (pending, accepted, revoked, expired)
+// @Tags Users
+// @Produce json
+// @Success 200 {object} models.Response{data=[]models.Invitation}
+// @Failure 500 {object} models.Response
+// @Router /admin/users/invitations [get]
+func (ic *InvitationController) GetInvitations(ctx *gin.Context) {
+	invitations, err := models.GetInvitations(ic.DB)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to fetch invitations",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Invitations fetched successfully",
+		Data:    invitations,
+	})
+}
+
+// RevokeInvitation godoc
+// @Summary Revoke an admin invitation
+// @Description Membatalkan undangan admin yang masih pending
+// @Tags Users
+// @Produce json
+// @Param id path int true "Invitation ID"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/users/invitations/{id} [delete]
+func (ic *InvitationController) RevokeInvitation(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid invitation ID",
+		})
+		return
+	}
+
+	if err := models.RevokeInvitation(ic.DB, id); err != nil {
+		if errors.Is(err, models.ErrInvitationNotPending) {
+			ctx.JSON(404, models.Response{
+				Success: false,
+				Message: "Invitation not found or no longer pending",
+			})
+			return
+		}
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to revoke invitation",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Invitation revoked successfully",
+	})
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"coffeeder-backend/libs"
+	"coffeeder-backend/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type LockoutController struct {
+	DB *pgxpool.Pool
+}
+
+// GetLockouts godoc
+// @Summary List login lockouts
+// @Description Menampilkan akun dengan percobaan login gagal. Gunakan locked=true untuk hanya akun yang sedang terkunci
+// @Tags Users
+// @Produce json
+// @Param locked query bool false "Only currently locked accounts"
+// @Success 200 {object} models.Response{data=[]models.LoginLockout}
+// @Failure 500 {object} models.Response
+// @Router /admin/lockouts [get]
+func (lc *LockoutController) GetLockouts(ctx *gin.Context) {
+	lockouts, err := models.GetLoginLockouts(lc.DB, ctx.Query("locked") == "true")
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to fetch lockouts",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Lockouts fetched successfully",
+		Data:    lockouts,
+	})
+}
+
+// ClearLockout godoc
+// @Summary Clear a login lockout
+// @Description Membuka kunci akun dan mereset hitungan login gagal untuk email tersebut
+// @Tags Users
+// @Produce json
+// @Param email path string true "Account email"
+// @Success 200 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/lockouts/{email} [delete]
+func (lc *LockoutController) ClearLockout(ctx *gin.Context) {
+	email := strings.ToLower(strings.TrimSpace(ctx.Param("email")))
+
+	cleared, err := models.ClearLoginLockout(lc.DB, email)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to clear lockout",
+			Data:    err.Error(),
+		})
+		return
+	}
+	if !cleared {
+		ctx.JSON(404, models.Response{
+			Success: false,
+			Message: "No lockout found for this email",
+		})
+		return
+	}
+
+	libs.ResetRateLimit("login-email", email)
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Lockout cleared successfully",
+	})
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"coffeeder-backend/libs"
+	"coffeeder-backend/models"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestMagicLink godoc
+// @Summary      Request a magic login link
+// @Description  Email a single-use, short-lived login link. The link only works on the device (User-Agent, Accept-Language and optional deviceId) that requested it. The response is the same whether or not the email is registered.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      models.MagicLinkRequest  true  "Email and optional device ID"
+// @Success      200   {object}  models.Response
+// @Failure      400   {object}  models.Response
+// @Failure      429   {object}  models.Response
+// @Failure      500   {object}  models.Response
+// @Router       /auth/magic-link [post]
+func (ac *AuthController) RequestMagicLink(ctx *gin.Context) {
+	var req models.MagicLinkRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	if err := libs.Validate.Struct(req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    libs.FormatValidationError(err),
+		})
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "If the email is registered, a login link has been sent",
+	}
+
+	user, _, _, err := models.LoginUser(ac.DB, strings.TrimSpace(req.Email))
+	if err != nil {
+		ctx.JSON(200, response)
+		return
+	}
+
+	ttl := libs.GetEnvDuration("MAGIC_LINK_TTL", 15*time.Minute)
+	token, claims, err := libs.GenerateActionToken("magic-link", strconv.FormatInt(user.ID, 10), user.Email, ttl)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to generate token",
+		})
+		return
+	}
+
+	fingerprint := libs.DeviceFingerprint(ctx.Request, req.DeviceID)
+	err = models.CreateMagicLink(ac.DB, user.ID, libs.HashToken(claims.ID), fingerprint, ctx.ClientIP(), claims.ExpiresAt.Time)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to create login link",
+		})
+		return
+	}
+
+	link := libs.FrontendURL("/magic-link", url.Values{"token": {token}})
+	err = libs.SendOTPEmail(libs.SendOptions{
+		To:      []string{user.Email},
+		Subject: "Your Coffeeder login link",
+		Body: fmt.Sprintf("Open this link on the device where you requested it to log in to Coffeeder: %s\n\nThe link expires in %s and can be used once. If you didn't request it, you can ignore this email.",
+			link, ttl),
+	})
+	if err != nil {
+		fmt.Println("Failed to send magic link:", err)
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to send login link, please check SMTP configuration",
+		})
+		return
+	}
+
+	ctx.JSON(200, response)
+}
+
+// ConsumeMagicLink godoc
+// @Summary      Log in with a magic link
+// @Description  Exchange the token from a magic link for the usual access and refresh tokens (or a 2FA challenge). Must be called from the device that requested the link, with the same deviceId if one was sent.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      models.MagicLinkConsumeRequest  true  "Magic link token"
+// @Success      200   {object}  models.Response{data=models.UserResponse}
+// @Failure      400   {object}  models.Response
+// @Failure      401   {object}  models.Response
+// @Failure      500   {object}  models.Response
+// @Router       /auth/magic-link/consume [post]
+func (ac *AuthController) ConsumeMagicLink(ctx *gin.Context) {
+	var req models.MagicLinkConsumeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	if err := libs.Validate.Struct(req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    libs.FormatValidationError(err),
+		})
+		return
+	}
+
+	claims, err := libs.ParseActionToken(req.Token, "magic-link")
+	if err != nil {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired login link",
+		})
+		return
+	}
+
+	fingerprint := libs.DeviceFingerprint(ctx.Request, req.DeviceID)
+	userID, err := models.ConsumeMagicLink(ac.DB, libs.HashToken(claims.ID), fingerprint)
+	if errors.Is(err, models.ErrMagicLinkMismatch) {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Open the login link on the device where you requested it",
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired login link",
+		})
+		return
+	}
+
+	user, err := models.GetUserByID(ac.DB, userID)
+	if err != nil || !strings.EqualFold(user.Email, claims.Email) {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired login link",
+		})
+		return
+	}
+
+	// Opening the link proves the mailbox.
+	if user.EmailVerifiedAt == nil {
+		verified, err := models.MarkEmailVerified(ac.DB, user.ID, user.Email)
+		if err != nil {
+			fmt.Println("Failed to mark email verified:", err)
+		} else if verified {
+			now := time.Now()
+			user.EmailVerifiedAt = &now
+		}
+	}
+
+	ac.completeLogin(ctx, user)
+}
@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"coffeeder-backend/libs"
+	"coffeeder-backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetOIDCProviders godoc
+// @Summary      List social login providers
+// @Description  Names of the configured OIDC providers, for rendering "Sign in with ..." buttons
+// @Tags         Auth
+// @Produce      json
+// @Success      200   {object}  models.Response{data=[]string}
+// @Router       /auth/oidc/providers [get]
+func (ac *AuthController) GetOIDCProviders(ctx *gin.Context) {
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "OIDC providers fetched successfully",
+		Data:    libs.OIDCProviderNames(),
+	})
+}
+
+// StartOIDCLogin godoc
+// @Summary      Start social login
+// @Description  Create state, nonce and a PKCE verifier and return the provider's authorization URL. The frontend redirects there; the provider sends the user back to the configured redirect URL with code and state.
+// @Tags         Auth
+// @Produce      json
+// @Param        provider  path      string  true  "Provider name, e.g. google"
+// @Success      200   {object}  models.Response{data=models.OIDCStartResponse}
+// @Failure      404   {object}  models.Response
+// @Failure      502   {object}  models.Response
+// @Router       /auth/oidc/{provider}/start [get]
+func (ac *AuthController) StartOIDCLogin(ctx *gin.Context) {
+	provider, err := libs.GetOIDCProvider(ctx.Param("provider"))
+	if err != nil {
+		ctx.JSON(404, models.Response{
+			Success: false,
+			Message: "Login provider not found",
+		})
+		return
+	}
+
+	state, err1 := libs.GenerateRandomToken(32)
+	nonce, err2 := libs.GenerateRandomToken(32)
+	verifier, err3 := libs.GenerateRandomToken(32)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to generate token",
+		})
+		return
+	}
+
+	encryptedNonce, err1 := libs.EncryptString(nonce)
+	encryptedVerifier, err2 := libs.EncryptString(verifier)
+	if err := errors.Join(err1, err2); err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to start login",
+		})
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		fmt.Println("OIDC discovery failed:", err)
+		ctx.JSON(502, models.Response{
+			Success: false,
+			Message: "Login provider is unavailable",
+		})
+		return
+	}
+
+	ttl := libs.GetEnvDuration("OIDC_STATE_TTL", 10*time.Minute)
+	err = models.CreateOIDCLoginState(ac.DB, provider.Name, libs.HashToken(state), encryptedNonce, encryptedVerifier,
+		libs.DeviceFingerprint(ctx.Request, ""), time.Now().Add(ttl))
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to start login",
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Redirect the user to the authorization URL",
+		Data: models.OIDCStartResponse{
+			AuthorizationURL: authURL,
+			State:            state,
+		},
+	})
+}
+
+// OIDCCallback godoc
+// @Summary      Finish social login
+// @Description  Exchange the code from the provider redirect, verify the ID token and log in. A provider account is linked to the user with the same verified email, or a new customer account is created. An existing account whose email is not verified yet is not linked (409). Returns tokens, or a 2FA challenge when enabled.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        provider  path      string                      true  "Provider name, e.g. google"
+// @Param        body      body      models.OIDCCallbackRequest  true  "Code and state from the redirect"
+// @Success      200   {object}  models.Response{data=models.UserResponse}
+// @Failure      400   {object}  models.Response
+// @Failure      401   {object}  models.Response
+// @Failure      404   {object}  models.Response
+// @Failure      409   {object}  models.Response
+// @Failure      500   {object}  models.Response
+// @Router       /auth/oidc/{provider}/callback [post]
+func (ac *AuthController) OIDCCallback(ctx *gin.Context) {
+	provider, err := libs.GetOIDCProvider(ctx.Param("provider"))
+	if err != nil {
+		ctx.JSON(404, models.Response{
+			Success: false,
+			Message: "Login provider not found",
+		})
+		return
+	}
+
+	var req models.OIDCCallbackRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	if err := libs.Validate.Struct(req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    libs.FormatValidationError(err),
+		})
+		return
+	}
+
+	st, err := models.ConsumeOIDCLoginState(ac.DB, provider.Name, libs.HashToken(req.State), libs.DeviceFingerprint(ctx.Request, ""))
+	if err != nil {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired login request, please start again",
+		})
+		return
+	}
+
+	nonce, err1 := libs.DecryptString(st.Nonce)
+	verifier, err2 := libs.DecryptString(st.CodeVerifier)
+	if err := errors.Join(err1, err2); err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to finish login",
+		})
+		return
+	}
+
+	claims, err := ac.verifyOIDCCode(ctx.Request.Context(), provider, req.Code, verifier, nonce)
+	if err != nil {
+		fmt.Println("OIDC login failed:", err)
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Could not sign in with " + provider.Name,
+		})
+		return
+	}
+
+	user, err := ac.oidcUser(provider.Name, claims)
+	if err != nil {
+		if errors.Is(err, errOIDCEmailUnverified) {
+			ctx.JSON(401, models.Response{
+				Success: false,
+				Message: "The provider did not return a verified email",
+			})
+			return
+		}
+		if errors.Is(err, errOIDCAccountUnverified) {
+			ctx.JSON(409, models.Response{
+				Success: false,
+				Message: "An account with this email already exists but is not verified; log in with your password and verify your email first",
+			})
+			return
+		}
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to finish login",
+		})
+		return
+	}
+
+	ac.completeLogin(ctx, user)
+}
+
+func (ac *AuthController) verifyOIDCCode(ctx context.Context, provider *libs.OIDCProvider, code, verifier, nonce string) (*libs.OIDCClaims, error) {
+	rawIDToken, err := provider.Exchange(ctx, code, verifier)
+	if err != nil {
+		return nil, err
+	}
+	return provider.VerifyIDToken(ctx, rawIDToken, nonce)
+}
+
+var (
+	errOIDCEmailUnverified   = errors.New("oidc email not verified")
+	errOIDCAccountUnverified = errors.New("local account email not verified")
+)
+
+// oidcUser resolves the local user for an ID token: an already linked account
+// first, then the user with the same (provider-verified) email, otherwise a new
+// customer. The provider account is linked to the result.
+//
+// A local account whose email was never verified is not linked: whoever
+// registered it may not own the address, and linking would leave their
+// password working on the account the real owner then uses.
+func (ac *AuthController) oidcUser(provider string, claims *libs.OIDCClaims) (*models.UserResponse, error) {
+	user, err := models.GetUserByIdentity(ac.DB, provider, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		email := strings.TrimSpace(claims.Email)
+		if email == "" || !claims.IsEmailVerified() {
+			return nil, errOIDCEmailUnverified
+		}
+
+		user, err = models.FindUserByEmail(ac.DB, email)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil && user.EmailVerifiedAt == nil {
+			return nil, errOIDCAccountUnverified
+		}
+		if user == nil {
+			user, err = ac.createOIDCUser(email, claims.Name)
+			if err != nil {
+				return nil, err
+			}
+			if verified, err := models.MarkEmailVerified(ac.DB, user.ID, user.Email); err == nil && verified {
+				now := time.Now()
+				user.EmailVerifiedAt = &now
+			}
+		}
+	}
+
+	if err := models.LinkIdentity(ac.DB, user.ID, provider, claims.Subject, claims.Email); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// createOIDCUser registers a customer that signs in through a provider. The
+// random password is never shown; the user can set one with forgot-password.
+func (ac *AuthController) createOIDCUser(email, name string) (*models.UserResponse, error) {
+	password, err := libs.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashed, err := libs.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	fullname := strings.TrimSpace(name)
+	if fullname == "" {
+		fullname, _, _ = strings.Cut(email, "@")
+	}
+
+	user, err := models.RegisterUser(ac.DB, models.UserRegister{Fullname: fullname, Email: email}, hashed)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -4,9 +4,11 @@ import (
 	"coffeeder-backend/libs"
 	"coffeeder-backend/models"
 	"context"
+	"errors"
 	"net/http"
 
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -24,11 +26,13 @@ type TransactionController struct {
 // @Produce json
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Limit per page" default(10)
+// @Param cursor query string false "Keyset pagination: kosongkan untuk halaman pertama, lalu pakai links.nextCursor / links.prevCursor. Menggantikan page"
 // @Param search query string false "Search by user fullname or invoice number"
 // @Param sort query string false "Sort by column e.g. created_at, total" default("created_at")
 // @Param order query string false "Sort order asc or desc" default("desc")
 // @Success 200 {object} models.Response
 // @Failure 500 {object} models.Response
+// @Failure 503 {object} models.Response
 // @Router /admin/transactions [get]
 func (tc *TransactionController) GetTransactions(ctx *gin.Context) {
 	pageStr := ctx.DefaultQuery("page", "1")
@@ -47,7 +51,49 @@ func (tc *TransactionController) GetTransactions(ctx *gin.Context) {
 	}
 	offset := (page - 1) * limit
 
-	transactions, err := models.GetAllTransactions(tc.DB, search, sort, order, limit, offset)
+	allowedSort := map[string]bool{"created_at": true, "total": true, "invoice_number": true}
+	if !allowedSort[sort] {
+		sort = "created_at"
+	}
+
+	if token, ok := ctx.GetQuery("cursor"); ok {
+		ks, err := models.NewKeyset(token, sort, !strings.EqualFold(order, "asc"), limit)
+		if errors.Is(err, libs.ErrMissingCursorSecret) {
+			ctx.JSON(503, models.Response{
+				Success: false,
+				Message: "Cursor pagination is not configured on this server",
+			})
+			return
+		}
+		if err != nil {
+			ctx.JSON(400, models.Response{
+				Success: false,
+				Message: "Invalid cursor",
+			})
+			return
+		}
+
+		transactions, err := models.GetAllTransactions(tc.DB, search, sort, order, limit, 0, ks)
+		if err != nil {
+			ctx.JSON(500, gin.H{
+				"success": false,
+				"message": "Failed to fetch transactions",
+				"data":    err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(200, models.ProductListResponse{
+			Success:    true,
+			Message:    "Transactions fetched successfully",
+			Pagination: libs.CursorPagination{Limit: limit},
+			Links:      libs.BuildCursorLinks("/transactions", limit, ks.Next, ks.Prev, ctx.Request.URL.Query()),
+			Data:       transactions,
+		})
+		return
+	}
+
+	transactions, err := models.GetAllTransactions(tc.DB, search, sort, order, limit, offset, nil)
 	if err != nil {
 		ctx.JSON(500, gin.H{
 			"success": false,
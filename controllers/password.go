@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"coffeeder-backend/libs"
+	"coffeeder-backend/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// checkNewPassword applies the password policy and, for an existing user
+// (userID != 0), the reuse history. Failures come back keyed by field, in the
+// same shape as libs.FormatValidationError.
+func checkNewPassword(db *pgxpool.Pool, userID int64, field, password string) (map[string]string, error) {
+	if err := libs.CheckPasswordPolicy(password); err != nil {
+		return map[string]string{field: err.Error()}, nil
+	}
+
+	if userID != 0 {
+		reused, err := models.IsPasswordReused(db, userID, password)
+		if err != nil {
+			return nil, err
+		}
+		if reused {
+			return map[string]string{field: "Password tidak boleh sama dengan password yang pernah dipakai sebelumnya"}, nil
+		}
+	}
+	return nil, nil
+}
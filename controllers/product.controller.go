@@ -5,6 +5,7 @@ import (
 	"coffeeder-backend/models"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -14,6 +15,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -21,7 +23,16 @@ type ProductController struct {
 	DB *pgxpool.Pool
 }
 
+// A query must be searched by at least this many clients before it is
+// suggested, whatever SEARCH_SUGGEST_MIN_HITS says.
+const searchSuggestMinHitsFloor = 2
+
+var searchRecordLimiter = libs.NewRateLimiter("search-record", 20, time.Hour)
+
 func ClearProductCache() {
+	if libs.RedisClient == nil {
+		return
+	}
 	pattern := "products:*"
 	iter := libs.RedisClient.Scan(libs.Ctx, 0, pattern, 0).Iterator()
 	for iter.Next(libs.Ctx) {
@@ -42,6 +53,7 @@ func ClearProductCache() {
 // @Param category_id formData int true "Category ID"
 // @Param variant_ids formData string false "Comma-separated Variant IDs (example: 1,2,3)"
 // @Param sizes formData string false "Comma-separated Size IDs (example: 1,3)"
+// @Param skus formData string false "JSON array of per size/variant stock & price, e.g. [{\"sizeId\":1,\"variantId\":2,\"stock\":10,\"price\":30000}]. Without it, stock is spread over every size x variant"
 // @Param images formData file false "Upload product image (repeat for multiple)"
 // @Success 201 {object} models.Response
 // @Failure 400 {object} models.Response
@@ -58,6 +70,14 @@ func (pc *ProductController) CreateProduct(ctx *gin.Context) {
 		})
 		return
 	}
+	if err := bindSKURequests(ctx, &req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid skus",
+			Data:    err.Error(),
+		})
+		return
+	}
 
 	if err := libs.Validate.Struct(req); err != nil {
 		ctx.JSON(400, models.Response{
@@ -166,7 +186,15 @@ func (pc *ProductController) CreateProduct(ctx *gin.Context) {
 		savedFiles = append(savedFiles, filename)
 	}
 
-	product, err := models.CreateProduct(pc.DB, req, savedFiles)
+	userID, _ := currentUserID(ctx)
+	product, err := models.CreateProduct(pc.DB, req, savedFiles, userID)
+	if errors.Is(err, models.ErrSKUNotOffered) {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		ctx.JSON(500, models.Response{
 			Success: false,
@@ -191,25 +219,70 @@ func (pc *ProductController) CreateProduct(ctx *gin.Context) {
 // @Tags Products
 // @Accept json
 // @Produce json
-// @Param search query string false "Search by title or description"
+// @Param search query string false "Full-text search over title, category and description, tolerant of typos. Matches are highlighted with <mark>"
 // @Param limit query int false "Number of products per page" default(10)
 // @Param page query int false "Page number" default(1)
-// @Param sort_by query string false "Sort field (id, title, base_price, created_at)" default(created_at)
+// @Param cursor query string false "Keyset pagination: send an empty cursor for the first page, then links.nextCursor or links.prevCursor. Replaces page"
+// @Param sort_by query string false "Sort field (id, title, base_price, created_at, relevance). Defaults to relevance when searching" default(created_at)
 // @Param order query string false "Sort order (ASC or DESC)" default(DESC)
 // @Success 200 {object} models.Response{data=map[string]interface{}}
 // @Failure 400 {object} models.Response
 // @Failure 500 {object} models.Response
+// @Failure 503 {object} models.Response
 // @Router /admin/products [get]
 func (pc *ProductController) GetProducts(ctx *gin.Context) {
 	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
 	search := ctx.Query("search")
 	sortBy := ctx.DefaultQuery("sort_by", "created_at")
+	if search != "" && ctx.Query("sort_by") == "" {
+		sortBy = "relevance"
+	}
 	order := strings.ToUpper(ctx.DefaultQuery("order", "ASC"))
 	if order != "ASC" && order != "DESC" {
 		order = "ASC"
 	}
 
+	if token, ok := ctx.GetQuery("cursor"); ok {
+		if limit < 1 {
+			limit = 10
+		}
+		ks, err := models.NewKeyset(token, sortBy, order == "DESC" || sortBy == "relevance", limit)
+		if errors.Is(err, libs.ErrMissingCursorSecret) {
+			ctx.JSON(http.StatusServiceUnavailable, models.Response{
+				Success: false,
+				Message: "Cursor pagination is not configured on this server",
+			})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Message: "Invalid cursor",
+			})
+			return
+		}
+
+		products, _, err := models.GetProducts(pc.DB, 1, limit, search, sortBy, order, ks)
+		if err != nil {
+			fmt.Println("Failed to fetch products:", err)
+			ctx.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Message: "Failed to fetch products",
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, models.ProductListResponse{
+			Success:    true,
+			Message:    "Products fetched successfully",
+			Pagination: libs.CursorPagination{Limit: limit},
+			Links:      libs.BuildCursorLinks("/products", limit, ks.Next, ks.Prev, ctx.Request.URL.Query()),
+			Data:       products,
+		})
+		return
+	}
+
 	cacheKey := fmt.Sprintf("products:page:%d:limit:%d:search:%s:sort:%s:order:%s",
 		page, limit, search, sortBy, order)
 
@@ -237,7 +310,7 @@ func (pc *ProductController) GetProducts(ctx *gin.Context) {
 		}
 	}
 
-	products, total, err := models.GetProducts(pc.DB, page, limit, search, sortBy, order)
+	products, total, err := models.GetProducts(pc.DB, page, limit, search, sortBy, order, nil)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -321,6 +394,7 @@ func (pc *ProductController) GetProductByID(ctx *gin.Context) {
 // @Param category_id formData int true "Category ID"
 // @Param variant_id formData []int false "Variant IDs (array)"
 // @Param sizes formData []int false "Size IDs (array)"
+// @Param skus formData string false "JSON array of per size/variant stock & price (see create). stock alone only works for products with a single SKU"
 // @Param images formData file false "Product images"
 // @Success 200 {object} models.Response{data=models.ProductResponse} "Product updated successfully"
 // @Failure 400 {object} models.Response "Invalid request or product ID"
@@ -346,6 +420,14 @@ func (pc *ProductController) UpdateProduct(ctx *gin.Context) {
 		})
 		return
 	}
+	if err := bindSKURequests(ctx, &req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid skus",
+			Data:    err.Error(),
+		})
+		return
+	}
 
 	if ctx.PostForm("basePrice") != "" {
 		if req.BasePrice < 1 {
@@ -444,7 +526,15 @@ func (pc *ProductController) UpdateProduct(ctx *gin.Context) {
 		savedFiles = append(savedFiles, filename)
 	}
 
-	product, err := models.UpdateProduct(pc.DB, productID, req, savedFiles, productOld)
+	userID, _ := currentUserID(ctx)
+	product, err := models.UpdateProduct(pc.DB, productID, req, savedFiles, productOld, userID)
+	if errors.Is(err, models.ErrSKUNotOffered) || errors.Is(err, models.ErrStockPerSKU) {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		ctx.JSON(500, models.Response{
 			Success: false,
@@ -465,7 +555,7 @@ func (pc *ProductController) UpdateProduct(ctx *gin.Context) {
 
 // DeleteProduct godoc
 // @Summary Delete a product
-// @Description Menghapus product berdasarkan ID
+// @Description Memindahkan product ke trash (soft delete). Riwayat order tetap menampilkan product ini; product bisa dikembalikan lewat restore
 // @Tags Products
 // @Accept json
 // @Produce json
@@ -485,135 +575,179 @@ func (pc *ProductController) DeleteProduct(ctx *gin.Context) {
 		return
 	}
 
-	ctxDB := context.Background()
-
-	tx, err := pc.DB.Begin(ctxDB)
+	deleted, err := models.SoftDeleteProduct(pc.DB, id)
 	if err != nil {
+		fmt.Println("Failed to delete product:", err)
 		ctx.JSON(500, models.Response{
 			Success: false,
-			Message: "Failed to start transaction",
-			Data:    err.Error(),
+			Message: "Failed to delete product",
 		})
 		return
 	}
-	defer func() {
-		if p := recover(); p != nil {
-			tx.Rollback(ctxDB)
-			panic(p)
-		}
-	}()
-
-	_, err = tx.Exec(ctxDB, `DELETE FROM transaction_items WHERE product_id=$1`, id)
-	if err != nil {
-		tx.Rollback(ctxDB)
-		ctx.JSON(500, gin.H{
-			"success": false,
-			"message": "Failed to delete transaction items",
-			"data":    err.Error(),
+	if !deleted {
+		ctx.JSON(404, models.Response{
+			Success: false,
+			Message: "Product not found",
 		})
 		return
 	}
 
-	_, err = tx.Exec(ctxDB, `DELETE FROM product_images WHERE product_id=$1`, id)
-	if err != nil {
-		tx.Rollback(ctxDB)
-		ctx.JSON(500, gin.H{
-			"success": false,
-			"message": "Failed to delete product images",
-			"data":    err.Error(),
-		})
-		return
+	ClearProductCache()
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Product moved to trash",
+	})
+}
+
+// GetTrashedProducts godoc
+// @Summary List deleted products
+// @Description Mengambil daftar product di trash beserta jumlah order yang memakainya (Admin Only)
+// @Tags Products
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Limit per page" default(10)
+// @Success 200 {object} models.Response{data=[]models.TrashedProduct}
+// @Failure 500 {object} models.Response
+// @Router /admin/products/trash [get]
+func (pc *ProductController) GetTrashedProducts(ctx *gin.Context) {
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 10
 	}
 
-	_, err = tx.Exec(ctxDB, `DELETE FROM product_variants WHERE product_id=$1`, id)
+	products, total, err := models.GetTrashedProducts(pc.DB, page, limit)
 	if err != nil {
-		tx.Rollback(ctxDB)
-		ctx.JSON(500, gin.H{
-			"success": false,
-			"message": "Failed to delete product variants",
-			"data":    err.Error(),
+		fmt.Println("Failed to fetch trashed products:", err)
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to fetch trashed products",
 		})
 		return
 	}
 
-	_, err = tx.Exec(ctxDB, `DELETE FROM product_sizes WHERE product_id=$1`, id)
+	pagination, links := libs.BuildHateoasGlobal("/admin/products/trash", page, limit, total, ctx.Request.URL.Query())
+	ctx.JSON(200, models.ProductListResponse{
+		Success:    true,
+		Message:    "Trashed products fetched successfully",
+		Pagination: pagination,
+		Links:      links,
+		Data:       products,
+	})
+}
+
+// RestoreProduct godoc
+// @Summary Restore a deleted product
+// @Description Mengembalikan product dari trash (Admin Only)
+// @Tags Products
+// @Produce json
+// @Param id path int true "Product ID"
+// @Success 200 {object} models.Response{data=models.ProductResponse}
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/products/{id}/restore [post]
+func (pc *ProductController) RestoreProduct(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
 	if err != nil {
-		tx.Rollback(ctxDB)
-		ctx.JSON(500, gin.H{
-			"success": false,
-			"message": "Failed to delete product sizes",
-			"data":    err.Error(),
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid product ID",
 		})
 		return
 	}
 
-	_, err = tx.Exec(ctxDB, `DELETE FROM products_categories WHERE product_id=$1`, id)
+	restored, err := models.RestoreProduct(pc.DB, id)
 	if err != nil {
-		tx.Rollback(ctxDB)
-		ctx.JSON(500, gin.H{
-			"success": false,
-			"message": "Failed to delete product categories",
-			"data":    err.Error(),
+		fmt.Println("Failed to restore product:", err)
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to restore product",
 		})
 		return
 	}
-
-	_, err = tx.Exec(ctxDB, `DELETE FROM carts WHERE product_id=$1`, id)
-	if err != nil {
-		tx.Rollback(ctxDB)
-		ctx.JSON(500, gin.H{
-			"success": false,
-			"message": "Failed to delete carts",
-			"data":    err.Error(),
+	if !restored {
+		ctx.JSON(404, models.Response{
+			Success: false,
+			Message: "Product not found in trash",
 		})
 		return
 	}
 
-	_, err = tx.Exec(ctxDB, `DELETE FROM recommended_products WHERE product_id=$1 OR recommended_id=$1`, id)
+	ClearProductCache()
+
+	product, err := models.GetProductByID(pc.DB, id)
 	if err != nil {
-		tx.Rollback(ctxDB)
-		ctx.JSON(500, gin.H{
-			"success": false,
-			"message": "Failed to delete recommended products",
-			"data":    err.Error(),
-		})
-		return
+		fmt.Println("Failed to fetch restored product:", err)
 	}
 
-	result, err := tx.Exec(ctxDB, `DELETE FROM products WHERE id=$1`, id)
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Product restored successfully",
+		Data:    product,
+	})
+}
+
+// PurgeProduct godoc
+// @Summary Permanently delete a product
+// @Description Menghapus permanen product yang sudah ada di trash beserta gambar, size, variant dan rekomendasinya. Ditolak (409) jika product belum di-trash atau sudah pernah dipesan (Admin Only)
+// @Tags Products
+// @Produce json
+// @Param id path int true "Product ID"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 409 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/products/{id}/purge [delete]
+func (pc *ProductController) PurgeProduct(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
 	if err != nil {
-		tx.Rollback(ctxDB)
-		ctx.JSON(500, gin.H{
-			"success": false,
-			"message": "Failed to delete product",
-			"data":    err.Error(),
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid product ID",
 		})
 		return
 	}
 
-	if result.RowsAffected() == 0 {
-		tx.Rollback(ctxDB)
-		ctx.JSON(404, gin.H{
-			"success": false,
-			"message": "Product not found",
+	err = models.PurgeProduct(pc.DB, id)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		ctx.JSON(404, models.Response{
+			Success: false,
+			Message: "Product not found",
 		})
 		return
-	}
-
-	if err := tx.Commit(ctxDB); err != nil {
-		ctx.JSON(500, gin.H{
-			"success": false,
-			"message": "Failed to commit transaction",
-			"data":    err.Error(),
+	case errors.Is(err, models.ErrProductNotInTrash):
+		ctx.JSON(409, models.Response{
+			Success: false,
+			Message: "Move the product to trash before deleting it permanently",
+		})
+		return
+	case errors.Is(err, models.ErrProductHasOrders):
+		ctx.JSON(409, models.Response{
+			Success: false,
+			Message: "Product appears in orders and cannot be deleted permanently",
+		})
+		return
+	case err != nil:
+		fmt.Println("Failed to purge product:", err)
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to delete product",
 		})
 		return
 	}
 
 	ClearProductCache()
 
-	ctx.JSON(200, gin.H{
-		"success": true,
-		"message": "Product deleted successfully",
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Product deleted permanently",
 	})
 }
 
@@ -926,7 +1060,7 @@ func (pc *ProductController) GetFavoriteProducts(ctx *gin.Context) {
 		SELECT p.id, p.title, p.description, p.base_price, pi.image
 		FROM products p
 		LEFT JOIN product_images pi ON pi.product_id = p.id
-		WHERE p.is_favorite = true
+		WHERE p.is_favorite = true AND p.deleted_at IS NULL
 		GROUP BY p.id, pi.image
 		ORDER BY p.updated_at DESC
 		LIMIT $1
@@ -976,7 +1110,7 @@ func (pc *ProductController) GetFavoriteProducts(ctx *gin.Context) {
 
 // FilterProducts godoc
 // @Summary      Filter dan ambil daftar produk
-// @Description  Endpoint ini mengambil daftar produk berdasarkan kategori, favorit, rentang harga, dan urutan (sort by). Semua parameter opsional.
+// @Description  Endpoint ini mengambil daftar produk berdasarkan kategori, favorit, rentang harga, size, variant, stok, promo, rating, dan urutan (sort by). Semua parameter opsional. Response menyertakan facets: jumlah produk per kategori, rentang harga, size, variant dan stok; setiap facet menghormati filter lain yang aktif kecuali filternya sendiri.
 // @Tags         Products
 // @Accept       json
 // @Produce      json
@@ -984,20 +1118,28 @@ func (pc *ProductController) GetFavoriteProducts(ctx *gin.Context) {
 // @Param        favorite    query bool   false  "Filter produk favorit"  example(true)
 // @Param        price_min   query number false  "Batas harga minimum"  example(10000)
 // @Param        price_max   query number false  "Batas harga maksimum"  example(50000)
-// @Param        sortby      query string false "Urutkan hasil: name=A-Z, baseprice=termurah ke termahal"  Enums(name, baseprice)  example(baseprice)
+// @Param        size        query []int  false  "ID size, bisa lebih dari satu" collectionFormat(multi)  example(1)
+// @Param        variant     query []int  false  "ID variant, bisa lebih dari satu" collectionFormat(multi)  example(2)
+// @Param        in_stock    query bool   false  "true = hanya yang ada stok, false = hanya yang habis"  example(true)
+// @Param        on_promo    query bool   false  "true = hanya yang sedang promo"  example(true)
+// @Param        min_rating  query number false  "Rating minimum"  example(4)
+// @Param        q           query string false  "Cari di judul, kategori dan deskripsi (toleran typo), hasil diberi peringkat dan kata yang cocok ditandai <mark>"  example(capucino)
+// @Param        sortby      query string false "Urutkan hasil: name=A-Z, baseprice=termurah ke termahal, relevance=paling relevan (default saat q diisi)"  Enums(name, baseprice, relevance)  example(baseprice)
 // @Success      200  {object} map[string]interface{} "Data produk berhasil difilter"
 // @Failure      500  {object} map[string]interface{} "Terjadi kesalahan server"
 // @Router       /products [get]
 func (pc *ProductController) FilterProducts(ctx *gin.Context) {
 	var filter models.ProductFilter
 
-	cats := ctx.QueryArray("cat")
 	fav := ctx.Query("favorite")
 	pmin := ctx.Query("price_min")
 	pmax := ctx.Query("price_max")
-	searchQuery := ctx.Query("q")
+	search := models.NewProductSearch(ctx.Query("q"))
 
 	sortBy := ctx.DefaultQuery("sortby", "name")
+	if search != nil && ctx.Query("sortby") == "" {
+		sortBy = "relevance"
+	}
 	order := strings.ToUpper(ctx.DefaultQuery("order", "ASC"))
 	if order != "ASC" && order != "DESC" {
 		order = "ASC"
@@ -1015,11 +1157,12 @@ func (pc *ProductController) FilterProducts(ctx *gin.Context) {
 		limit = 10
 	}
 
-	for _, c := range cats {
-		if id, err := strconv.ParseInt(c, 10, 64); err == nil {
-			filter.Categories = append(filter.Categories, id)
-		}
-	}
+	filter.Categories = queryIDs(ctx, "cat")
+	filter.Sizes = queryIDs(ctx, "size")
+	filter.Variants = queryIDs(ctx, "variant")
+	filter.InStock = queryBool(ctx, "in_stock")
+	filter.OnPromo = queryBool(ctx, "on_promo")
+	filter.Search = search
 
 	if fav != "" {
 		v := fav == "true"
@@ -1038,40 +1181,18 @@ func (pc *ProductController) FilterProducts(ctx *gin.Context) {
 		}
 	}
 
-	filter.SortBy = sortBy
+	if r := ctx.Query("min_rating"); r != "" {
+		if f, err := strconv.ParseFloat(r, 64); err == nil {
+			filter.MinRating = &f
+		}
+	}
 
-	countQuery := `SELECT COUNT(*) FROM products p WHERE 1=1`
-	var countArgs []interface{}
-	idx := 1
+	filter.SortBy = sortBy
 
-	if len(filter.Categories) > 0 {
-		countQuery += fmt.Sprintf(" AND p.category_id = ANY($%d)", idx)
-		countArgs = append(countArgs, filter.Categories)
-		idx++
-	}
-	if filter.IsFavorite != nil {
-		countQuery += fmt.Sprintf(" AND p.is_favorite = $%d", idx)
-		countArgs = append(countArgs, *filter.IsFavorite)
-		idx++
-	}
-	if filter.PriceMin != nil {
-		countQuery += fmt.Sprintf(" AND p.base_price >= $%d", idx)
-		countArgs = append(countArgs, *filter.PriceMin)
-		idx++
-	}
-	if filter.PriceMax != nil {
-		countQuery += fmt.Sprintf(" AND p.base_price <= $%d", idx)
-		countArgs = append(countArgs, *filter.PriceMax)
-		idx++
-	}
-	if searchQuery != "" {
-		countQuery += fmt.Sprintf(" AND LOWER(p.title) LIKE LOWER($%d)", idx)
-		countArgs = append(countArgs, "%"+searchQuery+"%")
-		idx++
-	}
+	where, args := filter.Where(1)
 
 	var totalItems int
-	_ = pc.DB.QueryRow(context.Background(), countQuery, countArgs...).Scan(&totalItems)
+	_ = pc.DB.QueryRow(context.Background(), `SELECT COUNT(*) FROM products p WHERE 1=1`+where, args...).Scan(&totalItems)
 
 	offset := (page - 1) * limit
 
@@ -1079,40 +1200,14 @@ func (pc *ProductController) FilterProducts(ctx *gin.Context) {
         SELECT 
             p.id, p.title, p.description, p.base_price, p.stock, p.category_id,
             p.created_at, p.updated_at,
-            (SELECT image FROM product_images WHERE product_id = p.id LIMIT 1) AS image
+            (SELECT image FROM product_images WHERE product_id = p.id LIMIT 1) AS image,
+            ` + filter.Rank(1) + ` AS rank
         FROM products p
-        WHERE 1=1`
-
-	var args []interface{}
-	a := 1
-
-	if len(filter.Categories) > 0 {
-		query += fmt.Sprintf(" AND p.category_id = ANY($%d)", a)
-		args = append(args, filter.Categories)
-		a++
-	}
-	if filter.IsFavorite != nil {
-		query += fmt.Sprintf(" AND p.is_favorite = $%d", a)
-		args = append(args, *filter.IsFavorite)
-		a++
-	}
-	if filter.PriceMin != nil {
-		query += fmt.Sprintf(" AND p.base_price >= $%d", a)
-		args = append(args, *filter.PriceMin)
-		a++
-	}
-	if filter.PriceMax != nil {
-		query += fmt.Sprintf(" AND p.base_price <= $%d", a)
-		args = append(args, *filter.PriceMax)
-		a++
-	}
-	if searchQuery != "" {
-		query += fmt.Sprintf(" AND LOWER(p.title) LIKE LOWER($%d)", a)
-		args = append(args, "%"+searchQuery+"%")
-		a++
-	}
+        WHERE 1=1` + where
 
 	switch filter.SortBy {
+	case "relevance":
+		query += " ORDER BY rank DESC, p.id ASC"
 	case "baseprice":
 		query += fmt.Sprintf(" ORDER BY p.base_price %s", order)
 	case "name":
@@ -1142,8 +1237,9 @@ func (pc *ProductController) FilterProducts(ctx *gin.Context) {
 		var price float64
 		var stock int
 		var createdAt, updatedAt time.Time
+		var rank float64
 
-		rows.Scan(&id, &title, &desc, &price, &stock, &categoryID, &createdAt, &updatedAt, &image)
+		rows.Scan(&id, &title, &desc, &price, &stock, &categoryID, &createdAt, &updatedAt, &image, &rank)
 
 		sizes := []models.SizeObj{}
 
@@ -1183,6 +1279,11 @@ func (pc *ProductController) FilterProducts(ctx *gin.Context) {
 		}
 		variantRows.Close()
 
+		var highlight *models.ProductHighlight
+		if search != nil {
+			highlight = search.Highlight(title, desc)
+		}
+
 		products = append(products, models.ProductResponseFilter{
 			ID:          id,
 			Title:       title,
@@ -1195,9 +1296,22 @@ func (pc *ProductController) FilterProducts(ctx *gin.Context) {
 			Variants:    variants,
 			CreatedAt:   createdAt,
 			UpdatedAt:   updatedAt,
+			Rank:        rank,
+			Highlight:   highlight,
 		})
 	}
 
+	// Only searches that found something become suggestions. Each client is
+	// counted once per query and may only record a few queries an hour.
+	if search != nil && totalItems > 0 && page == 1 {
+		if allowed, _ := searchRecordLimiter.Allow(ctx.ClientIP()); allowed {
+			searcher := libs.HashToken("search:" + ctx.ClientIP())
+			if err := models.RecordSearchQuery(pc.DB, search.Query, searcher); err != nil {
+				fmt.Println("Failed to record search query:", err)
+			}
+		}
+	}
+
 	pagination, links := libs.BuildHateoasGlobal(
 		"/products",
 		page,
@@ -1206,20 +1320,125 @@ func (pc *ProductController) FilterProducts(ctx *gin.Context) {
 		ctx.Request.URL.Query(),
 	)
 
+	facets, err := models.GetProductFacets(pc.DB, &filter)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Gagal menghitung facet produk",
+			"error":   err.Error(),
+		})
+		return
+	}
+
 	response := models.ProductListResponse{
 		Success:    true,
 		Message:    "Filtered products fetched successfully",
 		Pagination: pagination,
 		Links:      links,
 		Data:       products,
+		Facets:     facets,
 	}
 
 	ctx.JSON(http.StatusOK, response)
 }
 
+// SuggestProducts godoc
+// @Summary      Search autocomplete
+// @Description  Saran saat user mengetik: judul produk, kategori dan pencarian populer yang diawali q (atau salah satu katanya diawali q), diurutkan berdasarkan kecocokan prefix lalu jumlah terjual. Hasil di-cache di Redis.
+// @Tags         Products
+// @Produce      json
+// @Param        q      query string false "Teks yang sedang diketik"  example(capp)
+// @Param        limit  query int    false "Jumlah saran per jenis (maks 10)"  default(5)
+// @Success      200  {object} models.Response{data=models.SearchSuggestions}
+// @Failure      500  {object} models.Response
+// @Router       /products/suggest [get]
+func (pc *ProductController) SuggestProducts(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "5"))
+	if err != nil || limit < 1 {
+		limit = 5
+	}
+	if limit > 10 {
+		limit = 10
+	}
+
+	search := models.NewProductSearch(ctx.Query("q"))
+	if search == nil {
+		ctx.JSON(http.StatusOK, models.Response{
+			Success: true,
+			Message: "Suggestions fetched successfully",
+			Data: models.SearchSuggestions{
+				Products:   []models.ProductSuggestion{},
+				Categories: []models.CategorySuggestion{},
+				Queries:    []string{},
+			},
+		})
+		return
+	}
+
+	// Cached under products:* so ClearProductCache drops stale titles.
+	cacheKey := fmt.Sprintf("products:suggest:limit:%d:q:%s", limit, search.Query)
+	if libs.RedisClient != nil {
+		if cached, err := libs.RedisClient.Get(libs.Ctx, cacheKey).Result(); err == nil {
+			var suggestions models.SearchSuggestions
+			if err := json.Unmarshal([]byte(cached), &suggestions); err == nil {
+				ctx.JSON(http.StatusOK, models.Response{
+					Success: true,
+					Message: "Suggestions fetched from cache",
+					Data:    suggestions,
+				})
+				return
+			}
+		}
+	}
+
+	suggestions, err := models.GetSearchSuggestions(pc.DB, search.Query, limit, max(libs.GetEnvInt("SEARCH_SUGGEST_MIN_HITS", 3), searchSuggestMinHitsFloor))
+	if err != nil {
+		fmt.Println("Failed to fetch suggestions:", err)
+		ctx.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Message: "Failed to fetch suggestions",
+		})
+		return
+	}
+
+	if libs.RedisClient != nil {
+		if data, err := json.Marshal(suggestions); err == nil {
+			libs.RedisClient.Set(libs.Ctx, cacheKey, data, libs.GetEnvDuration("SEARCH_SUGGEST_CACHE_TTL", 5*time.Minute))
+		}
+	}
+
+	ctx.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: "Suggestions fetched successfully",
+		Data:    suggestions,
+	})
+}
+
+// queryIDs reads repeated (?size=1&size=2) or comma-separated (?size=1,2) IDs,
+// skipping anything that isn't a number.
+func queryIDs(ctx *gin.Context, key string) []int64 {
+	var ids []int64
+	for _, value := range ctx.QueryArray(key) {
+		for _, part := range strings.Split(value, ",") {
+			if id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64); err == nil {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+func queryBool(ctx *gin.Context, key string) *bool {
+	v, err := strconv.ParseBool(ctx.Query(key))
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
 // GetProductDetail godoc
 // @Summary Get product detail by ID
-// @Description Returns detailed information of a product including images, sizes, and recommended products
+// @Description Returns detailed information of a product including images, sizes, SKUs (stock and price per size/variant) and recommended products
 // @Tags Products
 // @Param id path int true "Product ID"
 // @Produce json
@@ -1245,7 +1464,7 @@ func (pc *ProductController) GetProductDetail(ctx *gin.Context) {
 	query := `
 		SELECT id, title, description, base_price, stock, category_id
 		FROM products
-		WHERE id=$1
+		WHERE id=$1 AND deleted_at IS NULL
 	`
 	err = pc.DB.QueryRow(context.Background(), query, productID).Scan(
 		&product.ID, &product.Title, &product.Description,
@@ -1318,12 +1537,24 @@ func (pc *ProductController) GetProductDetail(ctx *gin.Context) {
 		}
 	}
 
+	product.SKUs, err = models.GetProductSKUs(pc.DB, product.ID, true)
+	if err != nil {
+		fmt.Println("Failed to fetch product SKUs:", err)
+		product.SKUs = []models.ProductSKU{}
+	} else {
+		// Shoppers see what can still be bought, not units held in other carts.
+		product.Stock = 0
+		for _, sku := range product.SKUs {
+			product.Stock += sku.Available
+		}
+	}
+
 	product.Recommended = []models.RecommendedProductInfo{}
 	recQuery := `
 		SELECT p.id, p.title, p.description, p.base_price, p.stock, p.category_id
 		FROM recommended_products rp
 		JOIN products p ON rp.recommended_id = p.id
-		WHERE rp.product_id=$1
+		WHERE rp.product_id=$1 AND p.deleted_at IS NULL
 	`
 	rowsRec, err := pc.DB.Query(context.Background(), recQuery, product.ID)
 	if err == nil {
@@ -1453,9 +1684,21 @@ func (pc *ProductController) AddToCart(ctx *gin.Context) {
 		return
 	}
 
+	for _, c := range carts {
+		if c.Quantity <= 0 {
+			ctx.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Message: "Quantity must be greater than 0",
+			})
+			return
+		}
+	}
+
+	ttl := libs.GetEnvDuration("CART_RESERVATION_TTL", 15*time.Minute)
+	maxQuantity := libs.GetEnvInt("CART_MAX_QUANTITY_PER_ITEM", 10)
 	var results []models.CartItemResponse
 	for _, c := range carts {
-		item, err := models.AddOrUpdateCart(pc.DB, userID, c.ProductID, c.SizeID, c.VariantID, c.Quantity)
+		item, err := models.AddOrUpdateCart(pc.DB, userID, c.ProductID, c.SkuID, c.SizeID, c.VariantID, c.Quantity, maxQuantity, ttl)
 		if err != nil {
 			ctx.JSON(http.StatusBadRequest, models.Response{
 				Success: false,
@@ -1612,6 +1855,7 @@ func (pc *ProductController) GetCart(ctx *gin.Context) {
 // @Success 201 {object} models.Response{data=models.OrderTransaction} "Transaction created successfully"
 // @Failure 400 {object} models.Response "Invalid request or missing user info"
 // @Failure 401 {object} models.Response "User not authenticated"
+// @Failure 403 {object} models.Response "Email not verified"
 // @Failure 500 {object} models.Response "Failed to create transaction"
 // @Security ApiKeyAuth
 // @Router /transactions [post]
@@ -1651,6 +1895,24 @@ func (pc *ProductController) CreateTransaction(ctx *gin.Context) {
 		return
 	}
 
+	if libs.GetEnvBool("REQUIRE_VERIFIED_EMAIL_FOR_CHECKOUT", true) {
+		verified, err := models.IsEmailVerified(pc.DB, userID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Message: "Failed to fetch user info",
+			})
+			return
+		}
+		if !verified {
+			ctx.JSON(http.StatusForbidden, models.Response{
+				Success: false,
+				Message: "Please verify your email before checking out",
+			})
+			return
+		}
+	}
+
 	var req models.OrderTransactionRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, models.Response{
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"coffeeder-backend/libs"
+	"coffeeder-backend/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// bindSKURequests reads the optional "skus" form field, a JSON array of
+// models.SKURequest, into req.
+func bindSKURequests(ctx *gin.Context, req *models.ProductRequest) error {
+	raw := ctx.PostForm("skus")
+	if raw == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(raw), &req.SKUs); err != nil {
+		return err
+	}
+	for _, sku := range req.SKUs {
+		if err := libs.Validate.Struct(sku); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetProductSKUs godoc
+// @Summary List product SKUs
+// @Description Mengambil semua SKU (kombinasi size/variant) product beserta stok, harga dan status aktif
+// @Tags Products
+// @Produce json
+// @Param id path int true "Product ID"
+// @Success 200 {object} models.Response{data=[]models.ProductSKU}
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/products/{id}/skus [get]
+func (pc *ProductController) GetProductSKUs(ctx *gin.Context) {
+	productID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid product ID",
+		})
+		return
+	}
+
+	if _, err := models.GetProductByID(pc.DB, productID); err != nil {
+		ctx.JSON(404, models.Response{
+			Success: false,
+			Message: "Product not found",
+		})
+		return
+	}
+
+	skus, err := models.GetProductSKUs(pc.DB, productID, false)
+	if err != nil {
+		fmt.Println("Failed to fetch product SKUs:", err)
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to fetch product SKUs",
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Product SKUs fetched successfully",
+		Data:    skus,
+	})
+}
+
+// UpdateProductSKU godoc
+// @Summary Update a product SKU
+// @Description Mengubah stok, harga override (0 = hapus override) atau status aktif satu SKU
+// @Tags Products
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param sku_id path int true "SKU ID"
+// @Param body body models.UpdateSKURequest true "SKU changes"
+// @Success 200 {object} models.Response{data=models.ProductSKU}
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/products/{id}/skus/{sku_id} [patch]
+func (pc *ProductController) UpdateProductSKU(ctx *gin.Context) {
+	productID, err1 := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	skuID, err2 := strconv.ParseInt(ctx.Param("sku_id"), 10, 64)
+	if err1 != nil || err2 != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid product ID or SKU ID",
+		})
+		return
+	}
+
+	var req models.UpdateSKURequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+			Data:    err.Error(),
+		})
+		return
+	}
+	if err := libs.Validate.Struct(req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	userID, _ := currentUserID(ctx)
+	sku, err := models.UpdateProductSKU(pc.DB, productID, skuID, req, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(404, models.Response{
+			Success: false,
+			Message: "SKU not found",
+		})
+		return
+	}
+	if err != nil {
+		fmt.Println("Failed to update product SKU:", err)
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to update product SKU",
+		})
+		return
+	}
+
+	ClearProductCache()
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Product SKU updated successfully",
+		Data:    sku,
+	})
+}
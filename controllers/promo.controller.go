@@ -0,0 +1,382 @@
+package controllers
+
+import (
+	"coffeeder-backend/libs"
+	"coffeeder-backend/models"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PromoController struct {
+	DB *pgxpool.Pool
+}
+
+// respondPromoError answers the errors shared by the promo write endpoints.
+func respondPromoError(ctx *gin.Context, err error, action string) {
+	var overlap *models.PromoOverlapError
+	switch {
+	case errors.As(err, &overlap):
+		ctx.JSON(409, models.Response{
+			Success: false,
+			Message: overlap.Error(),
+			Data:    overlap.Conflicts,
+		})
+	case errors.Is(err, models.ErrPromoPeriod), errors.Is(err, models.ErrPromoProductNotFound):
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	case errors.Is(err, pgx.ErrNoRows):
+		ctx.JSON(404, models.Response{
+			Success: false,
+			Message: "Promo not found",
+		})
+	default:
+		fmt.Println("Failed to "+action+":", err)
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to " + action,
+		})
+	}
+}
+
+func bindPromoJSON(ctx *gin.Context, req any) bool {
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+			Data:    err.Error(),
+		})
+		return false
+	}
+	if err := libs.Validate.Struct(req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Validation failed",
+			Data:    err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+func promoIDParam(ctx *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid promo ID",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// GetPromos godoc
+// @Summary List promos
+// @Description Mengambil daftar promo beserta product-nya, bisa difilter status (active, upcoming, expired)
+// @Tags Promos
+// @Produce json
+// @Param status query string false "active, upcoming or expired"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(10)
+// @Success 200 {object} models.ProductListResponse{data=[]models.Promo}
+// @Failure 400 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/promos [get]
+func (pc *PromoController) GetPromos(ctx *gin.Context) {
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 10
+	}
+
+	status := ctx.Query("status")
+	switch status {
+	case "", "active", "upcoming", "expired":
+	default:
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid status",
+		})
+		return
+	}
+
+	promos, total, err := models.GetPromos(pc.DB, status, page, limit)
+	if err != nil {
+		fmt.Println("Failed to fetch promos:", err)
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to fetch promos",
+		})
+		return
+	}
+
+	pagination, links := libs.BuildHateoasGlobal("/admin/promos", page, limit, total, ctx.Request.URL.Query())
+	ctx.JSON(200, models.ProductListResponse{
+		Success:    true,
+		Message:    "Promos fetched successfully",
+		Pagination: pagination,
+		Links:      links,
+		Data:       promos,
+	})
+}
+
+// GetPromoByID godoc
+// @Summary Get promo by ID
+// @Description Mengambil satu promo beserta product-nya
+// @Tags Promos
+// @Produce json
+// @Param id path int true "Promo ID"
+// @Success 200 {object} models.Response{data=models.Promo}
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/promos/{id} [get]
+func (pc *PromoController) GetPromoByID(ctx *gin.Context) {
+	id, ok := promoIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	promo, err := models.GetPromoByID(pc.DB, id)
+	if err != nil {
+		respondPromoError(ctx, err, "fetch promo")
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Promo fetched successfully",
+		Data:    promo,
+	})
+}
+
+// CreatePromo godoc
+// @Summary Create promo
+// @Description Membuat promo (discount = potongan harga per unit) dan opsional langsung memasang product. start harus sebelum end; product yang sudah ada di promo lain pada periode yang sama ditolak (409)
+// @Tags Promos
+// @Accept json
+// @Produce json
+// @Param body body models.PromoRequest true "Promo"
+// @Success 201 {object} models.Response{data=models.Promo}
+// @Failure 400 {object} models.Response
+// @Failure 409 {object} models.Response{data=[]models.PromoConflict}
+// @Failure 500 {object} models.Response
+// @Router /admin/promos [post]
+func (pc *PromoController) CreatePromo(ctx *gin.Context) {
+	var req models.PromoRequest
+	if !bindPromoJSON(ctx, &req) {
+		return
+	}
+
+	promo, err := models.CreatePromo(pc.DB, req)
+	if err != nil {
+		respondPromoError(ctx, err, "create promo")
+		return
+	}
+
+	ClearProductCache()
+
+	ctx.JSON(201, models.Response{
+		Success: true,
+		Message: "Promo created successfully",
+		Data:    promo,
+	})
+}
+
+// UpdatePromo godoc
+// @Summary Update promo
+// @Description Mengubah judul, deskripsi, discount atau periode promo. Periode baru dicek terhadap promo lain dari product-nya
+// @Tags Promos
+// @Accept json
+// @Produce json
+// @Param id path int true "Promo ID"
+// @Param body body models.UpdatePromoRequest true "Promo changes"
+// @Success 200 {object} models.Response{data=models.Promo}
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 409 {object} models.Response{data=[]models.PromoConflict}
+// @Failure 500 {object} models.Response
+// @Router /admin/promos/{id} [patch]
+func (pc *PromoController) UpdatePromo(ctx *gin.Context) {
+	id, ok := promoIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	var req models.UpdatePromoRequest
+	if !bindPromoJSON(ctx, &req) {
+		return
+	}
+
+	promo, err := models.UpdatePromo(pc.DB, id, req)
+	if err != nil {
+		respondPromoError(ctx, err, "update promo")
+		return
+	}
+
+	ClearProductCache()
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Promo updated successfully",
+		Data:    promo,
+	})
+}
+
+// DeletePromo godoc
+// @Summary Delete promo
+// @Description Menghapus promo (soft delete); discount-nya langsung tidak berlaku lagi
+// @Tags Promos
+// @Produce json
+// @Param id path int true "Promo ID"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/promos/{id} [delete]
+func (pc *PromoController) DeletePromo(ctx *gin.Context) {
+	id, ok := promoIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	deleted, err := models.DeletePromo(pc.DB, id)
+	if err != nil {
+		respondPromoError(ctx, err, "delete promo")
+		return
+	}
+	if !deleted {
+		respondPromoError(ctx, pgx.ErrNoRows, "delete promo")
+		return
+	}
+
+	ClearProductCache()
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Promo deleted successfully",
+	})
+}
+
+// AddPromoProducts godoc
+// @Summary Assign products to a promo
+// @Description Memasang product ke promo. Product yang sudah ada di promo lain pada periode yang sama ditolak (409)
+// @Tags Promos
+// @Accept json
+// @Produce json
+// @Param id path int true "Promo ID"
+// @Param body body models.PromoProductsRequest true "Product IDs"
+// @Success 200 {object} models.Response{data=models.Promo}
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 409 {object} models.Response{data=[]models.PromoConflict}
+// @Failure 500 {object} models.Response
+// @Router /admin/promos/{id}/products [post]
+func (pc *PromoController) AddPromoProducts(ctx *gin.Context) {
+	id, ok := promoIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	var req models.PromoProductsRequest
+	if !bindPromoJSON(ctx, &req) {
+		return
+	}
+
+	promo, err := models.AddPromoProducts(pc.DB, id, req.ProductIDs)
+	if err != nil {
+		respondPromoError(ctx, err, "assign promo products")
+		return
+	}
+
+	ClearProductCache()
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Products assigned to promo successfully",
+		Data:    promo,
+	})
+}
+
+// RemovePromoProduct godoc
+// @Summary Unassign a product from a promo
+// @Description Melepas satu product dari promo
+// @Tags Promos
+// @Produce json
+// @Param id path int true "Promo ID"
+// @Param product_id path int true "Product ID"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/promos/{id}/products/{product_id} [delete]
+func (pc *PromoController) RemovePromoProduct(ctx *gin.Context) {
+	id, ok := promoIDParam(ctx)
+	if !ok {
+		return
+	}
+	productID, err := strconv.ParseInt(ctx.Param("product_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid product ID",
+		})
+		return
+	}
+
+	removed, err := models.RemovePromoProduct(pc.DB, id, productID)
+	if err != nil {
+		respondPromoError(ctx, err, "unassign promo product")
+		return
+	}
+	if !removed {
+		ctx.JSON(404, models.Response{
+			Success: false,
+			Message: "Product is not in this promo",
+		})
+		return
+	}
+
+	ClearProductCache()
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Product removed from promo successfully",
+	})
+}
+
+// GetActivePromos godoc
+// @Summary List running promos
+// @Description Mengambil promo yang sedang berjalan beserta product-nya, yang paling cepat berakhir dulu
+// @Tags Promos
+// @Produce json
+// @Success 200 {object} models.Response{data=[]models.Promo}
+// @Failure 500 {object} models.Response
+// @Router /promos/active [get]
+func (pc *PromoController) GetActivePromos(ctx *gin.Context) {
+	promos, err := models.GetActivePromos(pc.DB)
+	if err != nil {
+		fmt.Println("Failed to fetch active promos:", err)
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to fetch active promos",
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Active promos fetched successfully",
+		Data:    promos,
+	})
+}
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"coffeeder-backend/libs"
+	"coffeeder-backend/models"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type SessionController struct {
+	DB *pgxpool.Pool
+}
+
+// GetSessions godoc
+// @Summary List my active sessions
+// @Description Menampilkan semua sesi login yang masih aktif (user agent, IP, waktu dibuat dan terakhir dipakai). Sesi dari token saat ini ditandai current=true
+// @Tags Sessions
+// @Produce json
+// @Success 200 {object} models.Response{data=[]models.UserSession}
+// @Failure 401 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Security BearerAuth
+// @Router /sessions [get]
+func (sc *SessionController) GetSessions(ctx *gin.Context) {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	sc.listSessions(ctx, userID, ctx.GetString("sessionID"))
+}
+
+// RevokeSession godoc
+// @Summary End one of my sessions
+// @Description Mengakhiri sesi (misalnya perangkat yang hilang). Refresh token sesi dicabut dan access token-nya langsung ditolak
+// @Tags Sessions
+// @Produce json
+// @Param id path string true "Session ID"
+// @Success 200 {object} models.Response
+// @Failure 401 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Security BearerAuth
+// @Router /sessions/{id} [delete]
+func (sc *SessionController) RevokeSession(ctx *gin.Context) {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	sc.revokeSession(ctx, userID, ctx.Param("id"))
+}
+
+// GetUserSessions godoc
+// @Summary List active sessions of a user
+// @Description Menampilkan semua sesi login aktif milik user
+// @Tags Users
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} models.Response{data=[]models.UserSession}
+// @Failure 400 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Security BearerAuth
+// @Router /admin/users/{id}/sessions [get]
+func (sc *SessionController) GetUserSessions(ctx *gin.Context) {
+	userID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	sc.listSessions(ctx, userID, ctx.GetString("sessionID"))
+}
+
+// RevokeUserSession godoc
+// @Summary End a session of a user
+// @Description Mengakhiri satu sesi login milik user
+// @Tags Users
+// @Produce json
+// @Param id path int true "User ID"
+// @Param sessionId path string true "Session ID"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Security BearerAuth
+// @Router /admin/users/{id}/sessions/{sessionId} [delete]
+func (sc *SessionController) RevokeUserSession(ctx *gin.Context) {
+	userID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	sc.revokeSession(ctx, userID, ctx.Param("sessionId"))
+}
+
+func (sc *SessionController) listSessions(ctx *gin.Context, userID int64, currentSID string) {
+	sessions, err := models.GetActiveSessions(sc.DB, userID)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to fetch sessions",
+		})
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = currentSID != "" && sessions[i].ID == currentSID
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Sessions fetched successfully",
+		Data:    sessions,
+	})
+}
+
+func (sc *SessionController) revokeSession(ctx *gin.Context, userID int64, sid string) {
+	err := models.RevokeSession(sc.DB, userID, sid)
+	if errors.Is(err, models.ErrSessionNotFound) {
+		ctx.JSON(404, models.Response{
+			Success: false,
+			Message: "Session not found",
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to end session",
+		})
+		return
+	}
+
+	if err := libs.RevokeSessionAccessTokens(sid); err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to revoke access tokens",
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Session ended successfully",
+	})
+}
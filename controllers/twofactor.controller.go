@@ -0,0 +1,435 @@
+package controllers
+
+import (
+	"coffeeder-backend/libs"
+	"coffeeder-backend/models"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const twoFactorChallengeMaxAttempts = 5
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery
+// code for an enrolled user.
+func (ac *AuthController) verifySecondFactor(totp *models.UserTOTP, code string) (bool, error) {
+	secret, err := libs.DecryptString(totp.SecretEncrypted)
+	if err != nil {
+		return false, err
+	}
+
+	if step, ok := libs.ValidateTOTP(secret, code, time.Now()); ok {
+		return models.ConsumeTOTPStep(ac.DB, totp.UserID, step)
+	}
+
+	return models.ConsumeRecoveryCode(ac.DB, totp.UserID, libs.HashRecoveryCode(code))
+}
+
+// SetupTwoFactor godoc
+// @Summary      Start two-factor enrollment
+// @Description  Generate a new TOTP secret for the current user and return it with an otpauth:// URI and a QR code (PNG data URL). It becomes active after /auth/2fa/enable.
+// @Tags         Auth
+// @Produce      json
+// @Success      200   {object}  models.Response{data=models.TwoFactorSetupResponse}
+// @Failure      401   {object}  models.Response
+// @Failure      409   {object}  models.Response
+// @Failure      500   {object}  models.Response
+// @Failure      503   {object}  models.Response
+// @Security     ApiKeyAuth
+// @Router       /auth/2fa/setup [post]
+func (ac *AuthController) SetupTwoFactor(ctx *gin.Context) {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	secret, err := libs.GenerateTOTPSecret()
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to generate secret",
+		})
+		return
+	}
+
+	encrypted, err := libs.EncryptString(secret)
+	if errors.Is(err, libs.ErrMissingSecretKey) {
+		ctx.JSON(503, models.Response{
+			Success: false,
+			Message: "Two-factor authentication is not configured on this server",
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to generate secret",
+		})
+		return
+	}
+
+	if err := models.SavePendingTOTP(ac.DB, userID, encrypted); err != nil {
+		if errors.Is(err, models.ErrTOTPAlreadyEnabled) {
+			ctx.JSON(409, models.Response{
+				Success: false,
+				Message: "Two-factor authentication is already enabled",
+			})
+			return
+		}
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to save secret",
+		})
+		return
+	}
+
+	uri := libs.TOTPURI(secret, ctx.GetString("userEmail"))
+	qr, err := libs.TOTPQRCode(uri)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to generate QR code",
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Scan the QR code with your authenticator app, then confirm with a code",
+		Data: models.TwoFactorSetupResponse{
+			Secret:     secret,
+			OtpauthURI: uri,
+			QRCode:     qr,
+		},
+	})
+}
+
+// EnableTwoFactor godoc
+// @Summary      Confirm two-factor enrollment
+// @Description  Confirm the pending TOTP secret with a code. Returns one-time recovery codes (shown only once) and new tokens for a two-factor session.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      models.TwoFactorCodeRequest  true  "TOTP code"
+// @Success      200   {object}  models.Response{data=models.TwoFactorEnableResponse}
+// @Failure      400   {object}  models.Response
+// @Failure      401   {object}  models.Response
+// @Failure      409   {object}  models.Response
+// @Failure      500   {object}  models.Response
+// @Security     ApiKeyAuth
+// @Router       /auth/2fa/enable [post]
+func (ac *AuthController) EnableTwoFactor(ctx *gin.Context) {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	var req models.TwoFactorCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	totp, err := models.GetUserTOTP(ac.DB, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			ctx.JSON(400, models.Response{
+				Success: false,
+				Message: "Two-factor setup has not been started",
+			})
+			return
+		}
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to fetch two-factor settings",
+		})
+		return
+	}
+	if totp.EnabledAt != nil {
+		ctx.JSON(409, models.Response{
+			Success: false,
+			Message: "Two-factor authentication is already enabled",
+		})
+		return
+	}
+
+	secret, err := libs.DecryptString(totp.SecretEncrypted)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to read two-factor secret",
+		})
+		return
+	}
+
+	step, valid := libs.ValidateTOTP(secret, req.Code, time.Now())
+	if !valid {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid code",
+		})
+		return
+	}
+
+	codes, err := libs.GenerateRecoveryCodes(libs.GetEnvInt("TWO_FACTOR_RECOVERY_CODES", 10))
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to generate recovery codes",
+		})
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = libs.HashRecoveryCode(code)
+	}
+
+	if err := models.EnableTOTP(ac.DB, userID, step, hashes); err != nil {
+		if errors.Is(err, models.ErrTOTPAlreadyEnabled) {
+			ctx.JSON(409, models.Response{
+				Success: false,
+				Message: "Two-factor authentication is already enabled",
+			})
+			return
+		}
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to enable two-factor authentication",
+		})
+		return
+	}
+
+	user, err := models.GetUserByID(ac.DB, userID)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to fetch user",
+		})
+		return
+	}
+	if err := ac.issueTokens(ctx, user, true); err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to generate token",
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Two-factor authentication enabled, store your recovery codes safely",
+		Data: models.TwoFactorEnableResponse{
+			RecoveryCodes: codes,
+			Token:         user.Token,
+			RefreshToken:  user.RefreshToken,
+		},
+	})
+}
+
+// DisableTwoFactor godoc
+// @Summary      Disable two-factor authentication
+// @Description  Remove TOTP and recovery codes after confirming the password and a current code. Not allowed for roles where two-factor is mandatory.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      models.TwoFactorDisableRequest  true  "Password and TOTP or recovery code"
+// @Success      200   {object}  models.Response
+// @Failure      400   {object}  models.Response
+// @Failure      401   {object}  models.Response
+// @Failure      403   {object}  models.Response
+// @Failure      500   {object}  models.Response
+// @Security     ApiKeyAuth
+// @Router       /auth/2fa/disable [post]
+func (ac *AuthController) DisableTwoFactor(ctx *gin.Context) {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	var req models.TwoFactorDisableRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	user, hashedPassword, role, err := models.LoginUser(ac.DB, ctx.GetString("userEmail"))
+	if err != nil || user.ID != userID {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	if libs.TwoFactorRequiredForRole(role) {
+		ctx.JSON(403, models.Response{
+			Success: false,
+			Message: "Two-factor authentication is mandatory for your role",
+		})
+		return
+	}
+
+	if ok, err := libs.VerifyPassword(req.Password, hashedPassword); err != nil || !ok {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Password incorrect",
+		})
+		return
+	}
+
+	totp, err := models.GetUserTOTP(ac.DB, userID)
+	if err != nil || totp.EnabledAt == nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Two-factor authentication is not enabled",
+		})
+		return
+	}
+
+	valid, err := ac.verifySecondFactor(totp, req.Code)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to verify code",
+		})
+		return
+	}
+	if !valid {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid code",
+		})
+		return
+	}
+
+	if err := models.DisableTOTP(ac.DB, userID); err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to disable two-factor authentication",
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Two-factor authentication disabled",
+	})
+}
+
+// VerifyTwoFactor godoc
+// @Summary      Complete a two-factor login
+// @Description  Exchange the challenge token from /auth/login and a TOTP or recovery code for the access token and refresh token
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      models.TwoFactorVerifyRequest  true  "Challenge token and code"
+// @Success      200   {object}  models.Response{data=models.UserResponse}
+// @Failure      400   {object}  models.Response
+// @Failure      401   {object}  models.Response
+// @Failure      500   {object}  models.Response
+// @Router       /auth/2fa/verify [post]
+func (ac *AuthController) VerifyTwoFactor(ctx *gin.Context) {
+	var req models.TwoFactorVerifyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	claims, err := libs.ParseActionToken(req.ChallengeToken, "2fa")
+	if err != nil || libs.IsTokenDenied(claims.ID) {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired challenge, please login again",
+		})
+		return
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired challenge, please login again",
+		})
+		return
+	}
+
+	totp, err := models.GetUserTOTP(ac.DB, userID)
+	if err != nil || totp.EnabledAt == nil {
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid or expired challenge, please login again",
+		})
+		return
+	}
+
+	valid, err := ac.verifySecondFactor(totp, req.Code)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to verify code",
+		})
+		return
+	}
+	if !valid {
+		// A challenge only allows a few guesses before a new login is needed.
+		attempts, _ := libs.CountAttempt("auth:2fa-attempts:"+claims.ID, time.Until(claims.ExpiresAt.Time))
+		if attempts >= twoFactorChallengeMaxAttempts {
+			libs.DenyToken(claims.ID, claims.ExpiresAt.Time)
+		}
+		ctx.JSON(401, models.Response{
+			Success: false,
+			Message: "Invalid code",
+		})
+		return
+	}
+
+	// The challenge is single use.
+	libs.DenyToken(claims.ID, claims.ExpiresAt.Time)
+
+	user, err := models.GetUserByID(ac.DB, userID)
+	if err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to fetch user",
+		})
+		return
+	}
+
+	if err := ac.issueTokens(ctx, user, true); err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to generate token",
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "Login success",
+		Data:    user,
+	})
+}
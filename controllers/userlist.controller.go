@@ -4,6 +4,7 @@ import (
 	"coffeeder-backend/libs"
 	"coffeeder-backend/models"
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -31,11 +32,13 @@ type UserController struct {
 // @Produce json
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Limit per page" default(10)
+// @Param cursor query string false "Keyset pagination: kosongkan untuk halaman pertama, lalu pakai links.nextCursor / links.prevCursor. Menggantikan page"
 // @Param search query string false "Search by fullname or email"
 // @Param sort_by query string false "Sort by field (fullname, email, created_at)" default(created_at)
 // @Param sort_order query string false "Sort order (asc or desc)" default(desc)
 // @Success 200 {object} models.Response
 // @Failure 500 {object} models.Response
+// @Failure 503 {object} models.Response
 // @Router /admin/users [get]
 func (uc *UserController) GetUsersList(ctx *gin.Context) {
 	pageStr := ctx.DefaultQuery("page", "1")
@@ -66,11 +69,44 @@ func (uc *UserController) GetUsersList(ctx *gin.Context) {
 		sortOrder = "desc"
 	}
 
+	var ks *models.Keyset
+	if token, ok := ctx.GetQuery("cursor"); ok {
+		var err error
+		ks, err = models.NewKeyset(token, sortBy, sortOrder == "desc", limit)
+		if errors.Is(err, libs.ErrMissingCursorSecret) {
+			ctx.JSON(503, models.Response{
+				Success: false,
+				Message: "Cursor pagination is not configured on this server",
+			})
+			return
+		}
+		if err != nil {
+			ctx.JSON(400, models.Response{
+				Success: false,
+				Message: "Invalid cursor",
+			})
+			return
+		}
+		switch sortBy {
+		case "fullname":
+			ks.SetSortKey("u.fullname", "text", "u.id")
+		case "email":
+			ks.SetSortKey("u.email", "text", "u.id")
+		default:
+			ks.SetSortKey("COALESCE(u.created_at, 'epoch'::timestamp)", "timestamp", "u.id")
+		}
+	}
+
+	keyColumn := "''"
+	if ks != nil {
+		keyColumn = ks.KeyColumn()
+	}
+
 	baseQuery := `
 		SELECT 
 			u.id, u.fullname, u.email, u.role,
 			p.image, p.phone, p.address,
-			u.created_at, u.updated_at
+			u.created_at, u.updated_at, ` + keyColumn + `
 		FROM users u
 		LEFT JOIN profile p ON p.user_id = u.id
 		WHERE 1=1
@@ -88,25 +124,37 @@ func (uc *UserController) GetUsersList(ctx *gin.Context) {
 		argIndex++
 	}
 
-	countQuery := "SELECT COUNT(*) FROM users u LEFT JOIN profile p ON p.user_id = u.id WHERE 1=1"
-	if search != "" {
-		countQuery += fmt.Sprintf(
-			" AND (LOWER(u.fullname) LIKE LOWER($1) OR LOWER(u.email) LIKE LOWER($1))",
-		)
-	}
 	var total int
-	if err := uc.DB.QueryRow(context.Background(), countQuery, args...).Scan(&total); err != nil {
-		ctx.JSON(500, models.Response{
-			Success: false,
-			Message: "Failed to count users",
-			Data:    err.Error(),
-		})
-		return
-	}
+	var orderClause, limitClause string
+	if ks != nil {
+		keyWhere, keyArgs := ks.Where(argIndex)
+		baseQuery += keyWhere
+		args = append(args, keyArgs...)
+		argIndex += len(keyArgs)
+
+		orderClause = ks.OrderBy()
+		limitClause = fmt.Sprintf(" LIMIT $%d", argIndex)
+		args = append(args, limit+1)
+	} else {
+		countQuery := "SELECT COUNT(*) FROM users u LEFT JOIN profile p ON p.user_id = u.id WHERE 1=1"
+		if search != "" {
+			countQuery += fmt.Sprintf(
+				" AND (LOWER(u.fullname) LIKE LOWER($1) OR LOWER(u.email) LIKE LOWER($1))",
+			)
+		}
+		if err := uc.DB.QueryRow(context.Background(), countQuery, args...).Scan(&total); err != nil {
+			ctx.JSON(500, models.Response{
+				Success: false,
+				Message: "Failed to count users",
+				Data:    err.Error(),
+			})
+			return
+		}
 
-	orderClause := fmt.Sprintf(" ORDER BY u.%s %s", sortBy, sortOrder)
-	limitClause := fmt.Sprintf(" LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
-	args = append(args, limit, offset)
+		orderClause = fmt.Sprintf(" ORDER BY u.%s %s", sortBy, sortOrder)
+		limitClause = fmt.Sprintf(" LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+		args = append(args, limit, offset)
+	}
 
 	query := baseQuery + orderClause + limitClause
 
@@ -122,16 +170,18 @@ func (uc *UserController) GetUsersList(ctx *gin.Context) {
 	defer rows.Close()
 
 	var users []models.UserList
+	var keys []models.KeysetKey
 	for rows.Next() {
 		var u models.UserList
 		p := &models.Profile{}
 
 		var img, phone, address *string
+		var cursorKey string
 
 		err := rows.Scan(
 			&u.ID, &u.Fullname, &u.Email, &u.Role,
 			&img, &phone, &address,
-			&u.CreatedAt, &u.UpdatedAt,
+			&u.CreatedAt, &u.UpdatedAt, &cursorKey,
 		)
 		if err != nil {
 			continue
@@ -149,6 +199,19 @@ func (uc *UserController) GetUsersList(ctx *gin.Context) {
 
 		u.Profile = p
 		users = append(users, u)
+		keys = append(keys, models.KeysetKey{Key: cursorKey, ID: u.ID})
+	}
+
+	if ks != nil {
+		users = models.KeysetPage(ks, users, keys)
+		ctx.JSON(200, models.ProductListResponse{
+			Success:    true,
+			Message:    "Users fetched successfully",
+			Pagination: libs.CursorPagination{Limit: limit},
+			Links:      libs.BuildCursorLinks("/users", limit, ks.Next, ks.Prev, ctx.Request.URL.Query()),
+			Data:       users,
+		})
+		return
 	}
 
 	pagination, links := libs.BuildHateoasGlobal("/users", page, limit, total, ctx.Request.URL.Query())
@@ -233,7 +296,7 @@ func (uc *UserController) GetUserByID(ctx *gin.Context) {
 // @Param fullname formData string true "Full Name"
 // @Param email formData string true "Email"
 // @Param password formData string true "Password"
-// @Param role formData string true "User Role (admin/user)"
+// @Param role formData string true "User Role (admin/manager/barista/customer)"
 // @Param phone formData string false "Phone number"
 // @Param address formData string false "Address"
 // @Param image formData file false "Profile Image (max 2MB, jpg/png only)"
@@ -267,6 +330,21 @@ func (auc *UserController) AddUser(ctx *gin.Context) {
         return
     }
 
+    if fieldErrors, err := checkNewPassword(auc.DB, 0, "password", req.Password); err != nil {
+        ctx.JSON(500, models.Response{
+            Success: false,
+            Message: "Gagal memeriksa password",
+        })
+        return
+    } else if fieldErrors != nil {
+        ctx.JSON(400, models.Response{
+            Success: false,
+            Message: "Validasi gagal",
+            Data:    fieldErrors,
+        })
+        return
+    }
+
     if req.Image != nil {
         const maxSize = 2 * 1024 * 1024
         if req.Image.Size > maxSize {
@@ -419,6 +497,23 @@ func (auc *UserController) EditUser(ctx *gin.Context) {
 	phone := ctx.PostForm("phone")
 	address := ctx.PostForm("address")
 
+	if password != "" {
+		if fieldErrors, err := checkNewPassword(auc.DB, userID, "password", password); err != nil {
+			ctx.JSON(500, models.Response{
+				Success: false,
+				Message: "Gagal memeriksa password",
+			})
+			return
+		} else if fieldErrors != nil {
+			ctx.JSON(400, models.Response{
+				Success: false,
+				Message: "Validasi gagal",
+				Data:    fieldErrors,
+			})
+			return
+		}
+	}
+
 	file, _ := ctx.FormFile("image")
 
 	if file != nil {
@@ -505,6 +600,10 @@ func (uc *UserController) DeleteUser(ctx *gin.Context) {
 		return
 	}
 
+	if userID, err := strconv.Atoi(id); err == nil {
+		libs.RevokeUserAccessTokens(userID)
+	}
+
 	ctx.JSON(200, models.Response{
 		Success: true,
 		Message: "User deleted successfully",
@@ -512,15 +611,62 @@ func (uc *UserController) DeleteUser(ctx *gin.Context) {
 	})
 }
 
+// RevokeUserTokens godoc
+// @Summary Revoke all tokens of a user
+// @Description Mencabut semua access token dan refresh token milik user (misalnya setelah perubahan role)
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} models.Response
+// @Failure 500 {object} models.Response
+// @Router /admin/users/{id}/revoke-tokens [post]
+func (uc *UserController) RevokeUserTokens(ctx *gin.Context) {
+	userID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(400, models.Response{
+			Success: false,
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	if err := models.RevokeUserRefreshTokens(uc.DB, userID); err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to revoke refresh tokens",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	if err := libs.RevokeUserAccessTokens(int(userID)); err != nil {
+		ctx.JSON(500, models.Response{
+			Success: false,
+			Message: "Failed to revoke access tokens",
+			Data:    err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(200, models.Response{
+		Success: true,
+		Message: "User tokens revoked successfully",
+	})
+}
+
 // UpdateProfile godoc
 // @Summary      Update user profile
-// @Description  Update phone, address, and profile image
+// @Description  Update phone, address, and profile image. A new email is not applied directly; a confirmation link is sent to it instead
 // @Tags         Profile
 // @Accept       multipart/form-data
 // @Produce      json
 // @Param        Authorization header string true "Bearer <JWT token>"
 // @Param        phone formData string false "Phone number"
 // @Param        address formData string false "Address"
+// @Param        fullname formData string false "Fullname"
+// @Param        email formData string false "New email (confirmed via link)"
 // @Param        image formData file false "Profile image (jpg, jpeg, png, max 2MB)"
 // @Success      200 {object} models.ProfileUser
 // @Failure      400 {object} map[string]string
@@ -577,7 +723,7 @@ func (uc *UserController) UpdateProfile(ctx *gin.Context) {
 		}
 	}
 
-	profileResp, err := models.UpdateProfile(uc.DB, userID, phone, address, fullname, email, file)
+	profileResp, err := models.UpdateProfile(uc.DB, userID, phone, address, fullname, file)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, models.Response{
 			Success: false,
@@ -587,9 +733,23 @@ func (uc *UserController) UpdateProfile(ctx *gin.Context) {
 		return
 	}
 
+	message := "Profile updated successfully"
+	if email != "" && !strings.EqualFold(email, profileResp.Email) {
+		status, emailMessage := uc.startEmailChange(userID, profileResp.Email, email)
+		if status != http.StatusOK {
+			ctx.JSON(status, models.Response{
+				Success: false,
+				Message: "Profile updated, but the email was not changed: " + emailMessage,
+				Data:    profileResp,
+			})
+			return
+		}
+		message = "Profile updated successfully, confirm the new email via the link sent to it"
+	}
+
 	ctx.JSON(http.StatusOK, models.Response{
 		Success: true,
-		Message: "Profile updated successfully",
+		Message: message,
 		Data:    profileResp,
 	})
 }
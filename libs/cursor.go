@@ -0,0 +1,129 @@
+package libs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the position of a keyset page: the sort key and id of the row the
+// next (or, with Prev, previous) page starts after. Clients get it as an
+// opaque, HMAC-signed token so they cannot forge positions or mix sorts.
+type Cursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d,omitempty"`
+	Key  string `json:"k"`
+	ID   int64  `json:"i"`
+	Prev bool   `json:"p,omitempty"`
+}
+
+// CursorPagination replaces Pagination in cursor mode: there are no page
+// numbers or totals, only the page size.
+type CursorPagination struct {
+	Limit int `json:"limit"`
+}
+
+// ErrMissingCursorSecret is returned when neither CURSOR_SECRET nor
+// JWT_SECRET is set; cursors signed with an empty key could be forged.
+var ErrMissingCursorSecret = errors.New("CURSOR_SECRET or JWT_SECRET is not set")
+
+// cursorKey is CURSOR_SECRET, falling back to JWT_SECRET so existing
+// deployments keep working.
+func cursorKey() ([]byte, error) {
+	key := os.Getenv("CURSOR_SECRET")
+	if key == "" {
+		key = os.Getenv("JWT_SECRET")
+	}
+	if key == "" {
+		return nil, ErrMissingCursorSecret
+	}
+	return []byte("cursor:" + key), nil
+}
+
+// CheckCursorSecret reports whether cursor mode can be used.
+func CheckCursorSecret() error {
+	_, err := cursorKey()
+	return err
+}
+
+func cursorMAC(payload string) (string, error) {
+	key, err := cursorKey()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func EncodeCursor(c Cursor) (string, error) {
+	data, _ := json.Marshal(c)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	sig, err := cursorMAC(payload)
+	if err != nil {
+		return "", err
+	}
+	return payload + "." + sig, nil
+}
+
+// DecodeCursor verifies the token and that it was issued for the same sort
+// column and direction as the current request.
+func DecodeCursor(token, sort string, desc bool) (*Cursor, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	want, err := cursorMAC(payload)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return nil, ErrInvalidCursor
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.Sort != sort || c.Desc != desc {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// BuildCursorLinks fills the HATEOAS links for cursor mode. The links keep the
+// other query parameters and replace page with cursor. A link whose cursor
+// cannot be signed is left out.
+func BuildCursorLinks(basePath string, limit int, next, prev *Cursor, query url.Values) HateoasLinks {
+	var links HateoasLinks
+	link := func(c *Cursor) (*string, *string) {
+		token, err := EncodeCursor(*c)
+		if err != nil {
+			return nil, nil
+		}
+		q := cloneQuery(query)
+		q.Del("page")
+		q.Set("cursor", token)
+		q.Set("limit", strconv.Itoa(limit))
+		href := basePath + "?" + q.Encode()
+		return &href, &token
+	}
+	if next != nil {
+		links.Next, links.NextCursor = link(next)
+	}
+	if prev != nil {
+		links.Back, links.PrevCursor = link(prev)
+	}
+	return links
+}
@@ -0,0 +1,205 @@
+package libs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Revoked access tokens live in Redis until they would have expired anyway.
+// When Redis is not configured the denylist falls back to process memory, which
+// only protects the current instance.
+var (
+	denylistMu          sync.Mutex
+	denylistMemory      = map[string]denylistEntry{}
+	denylistSweeperOnce sync.Once
+)
+
+type denylistEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+func deniedTokenKey(jti string) string {
+	return "auth:denylist:" + jti
+}
+
+func revokedUserKey(userID int) string {
+	return fmt.Sprintf("auth:revoked-user:%d", userID)
+}
+
+func revokedSessionKey(sid string) string {
+	return "auth:revoked-session:" + sid
+}
+
+func setDenylistValue(key, value string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	if RedisClient != nil {
+		return RedisClient.Set(Ctx, key, value, ttl).Err()
+	}
+
+	startDenylistSweeper()
+	denylistMu.Lock()
+	defer denylistMu.Unlock()
+	denylistMemory[key] = denylistEntry{value: value, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// startDenylistSweeper drops expired in-memory entries once a minute; keys
+// that are never read again would otherwise stay forever.
+func startDenylistSweeper() {
+	denylistSweeperOnce.Do(func() {
+		StartSweeper("in-memory denylist", time.Minute, func() error {
+			now := time.Now()
+			denylistMu.Lock()
+			defer denylistMu.Unlock()
+			for key, entry := range denylistMemory {
+				if now.After(entry.expiresAt) {
+					delete(denylistMemory, key)
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func getDenylistValue(key string) (string, bool) {
+	if RedisClient != nil {
+		value, err := RedisClient.Get(Ctx, key).Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) {
+				log.Println("denylist lookup failed:", err)
+			}
+			return "", false
+		}
+		return value, true
+	}
+
+	denylistMu.Lock()
+	defer denylistMu.Unlock()
+	entry, ok := denylistMemory[key]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(denylistMemory, key)
+		return "", false
+	}
+	return entry.value, true
+}
+
+// DenyToken revokes a single access token until its expiry.
+func DenyToken(jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return nil
+	}
+	return setDenylistValue(deniedTokenKey(jti), "1", time.Until(expiresAt))
+}
+
+func IsTokenDenied(jti string) bool {
+	if jti == "" {
+		return false
+	}
+	_, denied := getDenylistValue(deniedTokenKey(jti))
+	return denied
+}
+
+// RevokeUserAccessTokens invalidates every access token issued to the user up to
+// now. Times are kept in milliseconds, like iat, so a login right after the
+// revoke is not caught by it. The marker only has to outlive the longest
+// access token.
+func RevokeUserAccessTokens(userID int) error {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	return setDenylistValue(revokedUserKey(userID), now, AccessTokenTTL())
+}
+
+func IsUserTokenRevoked(userID int, issuedAt time.Time) bool {
+	value, ok := getDenylistValue(revokedUserKey(userID))
+	if !ok {
+		return false
+	}
+	revokedAt, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false
+	}
+	// Markers written before times had milliseconds are in seconds.
+	if revokedAt < 1e12 {
+		revokedAt = revokedAt*1000 + 999
+	}
+	return issuedAt.UnixMilli() <= revokedAt
+}
+
+// RevokeSessionAccessTokens invalidates the access tokens bound to a session
+// so ending it takes effect before they expire.
+func RevokeSessionAccessTokens(sid string) error {
+	if sid == "" {
+		return nil
+	}
+	return setDenylistValue(revokedSessionKey(sid), "1", AccessTokenTTL())
+}
+
+func IsSessionRevoked(sid string) bool {
+	if sid == "" {
+		return false
+	}
+	_, revoked := getDenylistValue(revokedSessionKey(sid))
+	return revoked
+}
+
+// ShouldTouchSession reports whether last-seen data for the session is due for
+// a write, allowing at most one per interval.
+func ShouldTouchSession(sid string, interval time.Duration) bool {
+	key := "auth:session-seen:" + sid
+	if RedisClient != nil {
+		ok, err := RedisClient.SetNX(Ctx, key, "1", interval).Result()
+		if err != nil {
+			log.Println("session touch check failed:", err)
+			return false
+		}
+		return ok
+	}
+
+	startDenylistSweeper()
+	denylistMu.Lock()
+	defer denylistMu.Unlock()
+	if entry, ok := denylistMemory[key]; ok && time.Now().Before(entry.expiresAt) {
+		return false
+	}
+	denylistMemory[key] = denylistEntry{value: "1", expiresAt: time.Now().Add(interval)}
+	return true
+}
+
+// CountAttempt increments the counter stored under key and returns the new
+// value. The counter expires ttl after the first attempt.
+func CountAttempt(key string, ttl time.Duration) (int64, error) {
+	if RedisClient != nil {
+		count, err := RedisClient.Incr(Ctx, key).Result()
+		if err != nil {
+			return 0, err
+		}
+		if count == 1 {
+			RedisClient.Expire(Ctx, key, ttl)
+		}
+		return count, nil
+	}
+
+	startDenylistSweeper()
+	denylistMu.Lock()
+	defer denylistMu.Unlock()
+	entry, ok := denylistMemory[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		entry = denylistEntry{value: "0", expiresAt: time.Now().Add(ttl)}
+	}
+	count, _ := strconv.ParseInt(entry.value, 10, 64)
+	count++
+	entry.value = strconv.FormatInt(count, 10)
+	denylistMemory[key] = entry
+	return count, nil
+}
@@ -0,0 +1,15 @@
+package libs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+// DeviceFingerprint identifies the requesting browser or app from its
+// User-Agent and Accept-Language plus an optional client-generated deviceID.
+// The IP is left out so a phone switching networks keeps its fingerprint.
+func DeviceFingerprint(r *http.Request, deviceID string) string {
+	sum := sha256.Sum256([]byte(r.UserAgent() + "\n" + r.Header.Get("Accept-Language") + "\n" + deviceID))
+	return hex.EncodeToString(sum[:])
+}
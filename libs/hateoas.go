@@ -6,8 +6,10 @@ import (
 )
 
 type HateoasLinks struct {
-	Next *string `json:"next"`
-	Back *string `json:"back"`
+	Next       *string `json:"next"`
+	Back       *string `json:"back"`
+	NextCursor *string `json:"nextCursor,omitempty"`
+	PrevCursor *string `json:"prevCursor,omitempty"`
 }
 
 type Pagination struct {
@@ -0,0 +1,71 @@
+package libs
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var highlightWordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// highlightSimilarity is pg_trgm's default similarity threshold, so a word
+// found through the trigram fallback is also the one that gets marked.
+const highlightSimilarity = 0.3
+
+// HighlightTerms HTML-escapes text and wraps every word that starts with one of
+// terms, or is a close typo of one, in <mark></mark>.
+func HighlightTerms(text string, terms []string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range highlightWordPattern.FindAllStringIndex(text, -1) {
+		word := text[loc[0]:loc[1]]
+		if !matchesTerm(strings.ToLower(word), terms) {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[last:loc[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(word))
+		b.WriteString("</mark>")
+		last = loc[1]
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String()
+}
+
+func matchesTerm(word string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+		if utf8.RuneCountInString(term) >= 3 && trigramSimilarity(word, term) >= highlightSimilarity {
+			return true
+		}
+	}
+	return false
+}
+
+// trigramSimilarity mirrors pg_trgm's similarity() for single lower-case words.
+func trigramSimilarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	common := 0
+	for t := range ta {
+		if tb[t] {
+			common++
+		}
+	}
+	union := len(ta) + len(tb) - common
+	if union == 0 {
+		return 0
+	}
+	return float64(common) / float64(union)
+}
+
+func trigrams(word string) map[string]bool {
+	runes := []rune("  " + word + " ")
+	set := make(map[string]bool, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		set[string(runes[i:i+3])] = true
+	}
+	return set
+}
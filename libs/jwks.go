@@ -0,0 +1,298 @@
+package libs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Access tokens are signed with an asymmetric key so other services can verify
+// them from /.well-known/jwks.json without sharing a secret.
+//
+// Keys come from JWT_PRIVATE_KEYS (PEM blocks) or JWT_PRIVATE_KEYS_FILE, and
+// are required outside ENVIRONMENT=development. A block may carry a
+// "Kid: <id>" header; otherwise the kid is derived from the public key. JWT_ACTIVE_KID picks the signing key (default: the first one);
+// the others stay valid for verification so keys can be rotated without
+// logging everybody out.
+type signingKey struct {
+	Kid    string
+	Method jwt.SigningMethod
+	Signer crypto.Signer
+}
+
+var (
+	jwtKeysOnce sync.Once
+	jwtKeys     map[string]*signingKey
+	jwtKeyOrder []string
+	activeKey   *signingKey
+)
+
+func JWTIssuer() string {
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "coffeeshop"
+}
+
+func JWTAudience() string {
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		return audience
+	}
+	return "coffeeder-api"
+}
+
+// InitJWTKeys loads the signing keys and stops the process on invalid config.
+// It runs lazily on first use as well, so calling it at startup is optional.
+func InitJWTKeys() {
+	jwtKeysOnce.Do(func() {
+		if err := loadJWTKeys(); err != nil {
+			log.Fatalf("Invalid JWT key configuration: %v", err)
+		}
+		if os.Getenv("JWT_SECRET") == "" {
+			log.Println("WARNING: JWT_SECRET not set; invitation, verification, 2FA, password reset, magic link and email change links are disabled")
+		}
+	})
+}
+
+func loadJWTKeys() error {
+	data := os.Getenv("JWT_PRIVATE_KEYS")
+	if path := os.Getenv("JWT_PRIVATE_KEYS_FILE"); data == "" && path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		data = string(b)
+	}
+	// Allow single-line env values with escaped newlines.
+	data = strings.ReplaceAll(data, `\n`, "\n")
+
+	jwtKeys = map[string]*signingKey{}
+	jwtKeyOrder = nil
+
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		key, err := parseSigningKey(block)
+		if err != nil {
+			return err
+		}
+		if _, exists := jwtKeys[key.Kid]; exists {
+			return fmt.Errorf("duplicate kid %q", key.Kid)
+		}
+		jwtKeys[key.Kid] = key
+		jwtKeyOrder = append(jwtKeyOrder, key.Kid)
+	}
+
+	if len(jwtKeys) == 0 {
+		// Every instance would sign with its own throwaway key, so tokens
+		// would fail on whichever instance didn't issue them.
+		if os.Getenv("ENVIRONMENT") != "development" {
+			return errors.New("JWT_PRIVATE_KEYS or JWT_PRIVATE_KEYS_FILE is required (a temporary key is only used with ENVIRONMENT=development)")
+		}
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		key := &signingKey{Method: jwt.SigningMethodEdDSA, Signer: priv}
+		key.Kid = deriveKid(priv.Public())
+		jwtKeys[key.Kid] = key
+		jwtKeyOrder = append(jwtKeyOrder, key.Kid)
+		log.Println("WARNING: JWT_PRIVATE_KEYS not set, using an ephemeral signing key; tokens will not survive a restart or be shared between instances")
+	}
+
+	activeKid := os.Getenv("JWT_ACTIVE_KID")
+	if activeKid == "" {
+		activeKid = jwtKeyOrder[0]
+	}
+	activeKey = jwtKeys[activeKid]
+	if activeKey == nil {
+		return fmt.Errorf("JWT_ACTIVE_KID %q does not match any configured key", activeKid)
+	}
+	return nil
+}
+
+func parseSigningKey(block *pem.Block) (*signingKey, error) {
+	var parsed any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		key.Method = jwt.SigningMethodRS256
+		key.Signer = k
+	case ed25519.PrivateKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.Signer = k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	key.Kid = strings.TrimSpace(block.Headers["Kid"])
+	if key.Kid == "" {
+		key.Kid = deriveKid(key.Signer.Public())
+	}
+	return key, nil
+}
+
+func deriveKid(pub crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "default"
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:])[:16]
+}
+
+func activeSigningKey() *signingKey {
+	InitJWTKeys()
+	return activeKey
+}
+
+// verificationKey resolves the key named by the token's kid and pins the
+// algorithm to the one that key was configured with.
+func verificationKey(t *jwt.Token) (any, error) {
+	InitJWTKeys()
+
+	kid, _ := t.Header["kid"].(string)
+	key, ok := jwtKeys[kid]
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, jwt.ErrTokenSignatureInvalid
+	}
+	return key.Signer.Public(), nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// PublicKey decodes an RSA, EC or Ed25519 JWK, e.g. from an OIDC provider.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return pub, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every configured key.
+func JWKS() JWKSet {
+	InitJWTKeys()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, kid := range jwtKeyOrder {
+		key := jwtKeys[kid]
+		jwk := JWK{Kid: kid, Use: "sig", Alg: key.Method.Alg()}
+
+		switch pub := key.Signer.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
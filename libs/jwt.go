@@ -1,6 +1,7 @@
 package libs
 
 import (
+	"errors"
 	"net/http"
 	"os"
 	"strings"
@@ -10,28 +11,85 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Token times carry milliseconds so a user-wide revoke can tell tokens issued
+// just before it from a login right after it (see IsUserTokenRevoked).
+func init() {
+	jwt.TimePrecision = time.Millisecond
+}
+
 type UserPayload struct {
-	Id    int    `json:"id"`
-	Email string `json:"email"`
-	Role  string `json:"role"`
+	Id          int      `json:"id"`
+	Email       string   `json:"email"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"perms,omitempty"`
+	MFA         bool     `json:"mfa,omitempty"`
+	SessionID   string   `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(id int, email, role string) (string, error) {
-	secretKey := os.Getenv("JWT_SECRET")
-	claims := &UserPayload{
-		Id:    id,
-		Email: email,
-		Role:  role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "coffeeshop",
-		},
+func (p *UserPayload) HasPermission(permission string) bool {
+	for _, granted := range p.Permissions {
+		if granted == permission {
+			return true
+		}
 	}
+	return false
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secretKey))
+func AccessTokenTTL() time.Duration {
+	return GetEnvDuration("JWT_ACCESS_TTL", 15*time.Minute)
+}
+
+func RefreshTokenTTL() time.Duration {
+	return GetEnvDuration("JWT_REFRESH_TTL", 30*24*time.Hour)
+}
+
+// GenerateToken signs an access token for payload with the active key (see
+// jwks.go). Permissions are resolved from the role when the token is issued,
+// so role changes apply on the next refresh. MFA records that the session
+// passed a second factor, which roles listed in TWO_FACTOR_REQUIRED_ROLES
+// depend on.
+func GenerateToken(payload UserPayload) (string, error) {
+	key := activeSigningKey()
+	jti, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims := &payload
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL())),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Issuer:    JWTIssuer(),
+		Audience:  jwt.ClaimStrings{JWTAudience()},
+		ID:        jti,
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.Kid
+	return token.SignedString(key.Signer)
+}
+
+// ParseAccessToken verifies signature, algorithm, issuer, audience and expiry.
+func ParseAccessToken(tokenString string) (*UserPayload, error) {
+	claims := &UserPayload{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKey,
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(JWTIssuer()),
+		jwt.WithAudience(JWTAudience()),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
+
+func GenerateRefreshToken() (string, error) {
+	return GenerateRandomToken(32)
 }
 
 func JWTMiddleware() gin.HandlerFunc {
@@ -54,19 +112,8 @@ func JWTMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		tokenStr := parts[1]
-		secretKey := os.Getenv("JWT_SECRET")
-
-		claims := &UserPayload{}
-
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrInvalidKeyType
-			}
-			return []byte(secretKey), nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := ParseAccessToken(parts[1])
+		if err != nil {
 			ctx.JSON(http.StatusUnauthorized, gin.H{"message": "invalid token", "success": false})
 			ctx.Abort()
 			return
@@ -79,3 +126,75 @@ func JWTMiddleware() gin.HandlerFunc {
 		ctx.Next()
 	}
 }
+
+// ActionPayload is carried by short-lived, single-purpose links such as
+// invitations. Purpose stops a token minted for one flow being replayed in another.
+type ActionPayload struct {
+	Purpose string `json:"purpose"`
+	Email   string `json:"email,omitempty"`
+	// Ref ties the token to the state it was issued for (e.g. the verified
+	// reset request), so it stops working once that state is gone.
+	Ref string `json:"ref,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// ErrMissingJWTSecret is returned when JWT_SECRET is unset. jwt accepts an
+// empty HMAC key, which would let anyone forge action tokens.
+var ErrMissingJWTSecret = errors.New("JWT_SECRET is not set")
+
+func actionTokenKey() ([]byte, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return nil, ErrMissingJWTSecret
+	}
+	return []byte(secret), nil
+}
+
+func GenerateActionToken(purpose, subject, email string, ttl time.Duration) (string, *ActionPayload, error) {
+	return GenerateActionTokenWithRef(purpose, subject, email, "", ttl)
+}
+
+func GenerateActionTokenWithRef(purpose, subject, email, ref string, ttl time.Duration) (string, *ActionPayload, error) {
+	key, err := actionTokenKey()
+	if err != nil {
+		return "", nil, err
+	}
+	jti, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", nil, err
+	}
+
+	claims := &ActionPayload{
+		Purpose: purpose,
+		Email:   email,
+		Ref:     ref,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    "coffeeshop",
+			ID:        jti,
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(key)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+func ParseActionToken(tokenString, purpose string) (*ActionPayload, error) {
+	claims := &ActionPayload{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return actionTokenKey()
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer("coffeeshop"))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || claims.Purpose != purpose {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
@@ -0,0 +1,25 @@
+package libs
+
+import (
+	"net/url"
+	"os"
+	"strings"
+)
+
+// FrontendURL builds a link into the web app for emails (invitations,
+// verification links, ...).
+func FrontendURL(path string, query url.Values) string {
+	base := os.Getenv("FRONTEND_URL")
+	if base == "" {
+		base = os.Getenv("ALLOW_ORIGIN")
+	}
+	if base == "" {
+		base = "http://localhost:5173"
+	}
+
+	link := strings.TrimRight(base, "/") + "/" + strings.TrimLeft(path, "/")
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+	return link
+}
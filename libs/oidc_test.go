@@ -0,0 +1,333 @@
+package libs
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testOIDCClientID = "coffeeder-test"
+
+// stubOIDCProvider is a minimal OIDC provider: discovery, JWKS and a token
+// endpoint that checks the PKCE verifier before handing out the ID token.
+type stubOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+
+	mu    sync.Mutex
+	codes map[string]stubOIDCCode
+}
+
+type stubOIDCCode struct {
+	challenge string
+	idToken   string
+}
+
+func newStubOIDCProvider(t *testing.T) *stubOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stubOIDCProvider{key: key, kid: "stub-key", codes: map[string]stubOIDCCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 s.server.URL,
+			"authorization_endpoint": s.server.URL + "/authorize",
+			"token_endpoint":         s.server.URL + "/token",
+			"jwks_uri":               s.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{{
+			Kty: "RSA",
+			Kid: s.kid,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		code, ok := s.codes[r.PostForm.Get("code")]
+		delete(s.codes, r.PostForm.Get("code"))
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ok || r.PostForm.Get("grant_type") != "authorization_code" ||
+			r.PostForm.Get("client_id") != testOIDCClientID ||
+			PKCEChallenge(r.PostForm.Get("code_verifier")) != code.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": code.idToken})
+	})
+
+	s.server = httptest.NewServer(mux)
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// register adds the stand-in under name, as the app would from OIDC_* env vars.
+func (s *stubOIDCProvider) register(t *testing.T, name string) *OIDCProvider {
+	t.Helper()
+
+	RegisterOIDCProvider(&OIDCProvider{
+		Name:        name,
+		Issuer:      s.server.URL,
+		ClientID:    testOIDCClientID,
+		RedirectURL: "http://localhost:5173/oauth/" + name + "/callback",
+		HTTPClient:  s.server.Client(),
+	})
+	p, err := GetOIDCProvider(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// claims returns valid ID token claims for nonce.
+func (s *stubOIDCProvider) claims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            s.server.URL,
+		"aud":            testOIDCClientID,
+		"sub":            "user-123",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice",
+		"nonce":          nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+}
+
+func (s *stubOIDCProvider) sign(t *testing.T, claims jwt.MapClaims, key *rsa.PrivateKey, kid string) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// authorize plays the user approving the login at authURL and returns the
+// code the provider would redirect back with.
+func (s *stubOIDCProvider) authorize(t *testing.T, authURL, idToken string) string {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("authorization URL has no S256 PKCE challenge: %s", authURL)
+	}
+
+	code, err := GenerateRandomToken(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	s.codes[code] = stubOIDCCode{challenge: q.Get("code_challenge"), idToken: idToken}
+	s.mu.Unlock()
+	return code
+}
+
+func TestOIDCLogin(t *testing.T) {
+	stub := newStubOIDCProvider(t)
+	provider := stub.register(t, "stub")
+	ctx := context.Background()
+
+	rogueKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// edit changes the claims or signing of the ID token the provider issues.
+		edit func(claims jwt.MapClaims) (*rsa.PrivateKey, string)
+		// exchangeVerifier replaces the PKCE verifier sent to the token endpoint.
+		exchangeVerifier string
+		// verifyNonce replaces the nonce the ID token is checked against.
+		verifyNonce     string
+		wantExchangeErr bool
+		wantVerify      error
+		wantAnyVerify   bool
+		wantVerified    bool
+	}{
+		{
+			name:         "happy path",
+			wantVerified: true,
+		},
+		{
+			name:        "wrong nonce",
+			verifyNonce: "another-nonce",
+			wantVerify:  ErrOIDCNonceMismatch,
+		},
+		{
+			name: "wrong audience",
+			edit: func(c jwt.MapClaims) (*rsa.PrivateKey, string) {
+				c["aud"] = "some-other-client"
+				return nil, ""
+			},
+			wantVerify: jwt.ErrTokenInvalidAudience,
+		},
+		{
+			name: "wrong issuer",
+			edit: func(c jwt.MapClaims) (*rsa.PrivateKey, string) {
+				c["iss"] = "https://evil.example.com"
+				return nil, ""
+			},
+			wantVerify: jwt.ErrTokenInvalidIssuer,
+		},
+		{
+			name: "expired token",
+			edit: func(c jwt.MapClaims) (*rsa.PrivateKey, string) {
+				c["iat"] = time.Now().Add(-2 * time.Hour).Unix()
+				c["exp"] = time.Now().Add(-time.Hour).Unix()
+				return nil, ""
+			},
+			wantVerify: jwt.ErrTokenExpired,
+		},
+		{
+			name: "unknown kid",
+			edit: func(c jwt.MapClaims) (*rsa.PrivateKey, string) {
+				return rogueKey, "rogue-key"
+			},
+			wantAnyVerify: true,
+		},
+		{
+			name:             "PKCE verifier mismatch",
+			exchangeVerifier: "not-the-verifier",
+			wantExchangeErr:  true,
+		},
+		{
+			name: "email not verified",
+			edit: func(c jwt.MapClaims) (*rsa.PrivateKey, string) {
+				c["email_verified"] = false
+				return nil, ""
+			},
+			wantVerified: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, _ := GenerateRandomToken(16)
+			nonce, _ := GenerateRandomToken(16)
+			verifier, _ := GenerateRandomToken(32)
+
+			authURL, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+			if err != nil {
+				t.Fatalf("AuthCodeURL: %v", err)
+			}
+			u, err := url.Parse(authURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q := u.Query(); q.Get("state") != state || q.Get("nonce") != nonce || q.Get("client_id") != testOIDCClientID {
+				t.Fatalf("authorization URL is missing state, nonce or client_id: %s", authURL)
+			}
+
+			claims := stub.claims(nonce)
+			key, kid := stub.key, stub.kid
+			if tt.edit != nil {
+				if k, id := tt.edit(claims); k != nil {
+					key, kid = k, id
+				}
+			}
+			code := stub.authorize(t, authURL, stub.sign(t, claims, key, kid))
+
+			exchangeVerifier := verifier
+			if tt.exchangeVerifier != "" {
+				exchangeVerifier = tt.exchangeVerifier
+			}
+			rawIDToken, err := provider.Exchange(ctx, code, exchangeVerifier)
+			if tt.wantExchangeErr {
+				if err == nil {
+					t.Fatal("Exchange succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+
+			verifyNonce := nonce
+			if tt.verifyNonce != "" {
+				verifyNonce = tt.verifyNonce
+			}
+			got, err := provider.VerifyIDToken(ctx, rawIDToken, verifyNonce)
+			switch {
+			case tt.wantAnyVerify:
+				if err == nil {
+					t.Fatal("VerifyIDToken succeeded, want an error")
+				}
+				return
+			case tt.wantVerify != nil:
+				if !errors.Is(err, tt.wantVerify) {
+					t.Fatalf("VerifyIDToken error = %v, want %v", err, tt.wantVerify)
+				}
+				return
+			case err != nil:
+				t.Fatalf("VerifyIDToken: %v", err)
+			}
+
+			if got.Subject != "user-123" || got.Email != "alice@example.com" {
+				t.Fatalf("claims = %+v", got)
+			}
+			if got.IsEmailVerified() != tt.wantVerified {
+				t.Fatalf("IsEmailVerified() = %v, want %v", got.IsEmailVerified(), tt.wantVerified)
+			}
+		})
+	}
+}
+
+func TestOIDCClaimsIsEmailVerified(t *testing.T) {
+	for _, tt := range []struct {
+		value any
+		want  bool
+	}{
+		{true, true},
+		{"true", true},
+		{"TRUE", true},
+		{false, false},
+		{"false", false},
+		{nil, false},
+		{1, false},
+	} {
+		c := OIDCClaims{EmailVerified: tt.value}
+		if got := c.IsEmailVerified(); got != tt.want {
+			t.Errorf("IsEmailVerified(%v) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
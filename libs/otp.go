@@ -1,31 +1,95 @@
 package libs
 
 import (
-	"math/rand"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
 	"os"
+	"strconv"
 	"time"
-
-	"github.com/golang-jwt/jwt/v5"
 )
 
-func GenerateOTP(length int) string {
-	var digits = "0123456789"
-	otp := make([]byte, length)
+// OTPService holds the OTP policy. Codes are never stored: only an HMAC keyed
+// with OTP_SECRET and bound to the user, so a leaked table can't be replayed
+// and a code issued to one user can't match another user's row.
+type OTPService struct {
+	Length          int
+	TTL             time.Duration
+	MaxAttempts     int
+	LockoutDuration time.Duration
+	ResendCooldown  time.Duration
+	secret          []byte
+}
+
+// ErrMissingOTPSecret is returned when none of OTP_SECRET, JWT_OTP and
+// JWT_SECRET is set; an empty HMAC key would let anyone compute code hashes.
+var ErrMissingOTPSecret = errors.New("OTP_SECRET is not set")
 
-	for i := range otp{
-		otp[i] = digits[rand.Intn(len(digits))]
+func NewOTPService() *OTPService {
+	length := GetEnvInt("OTP_LENGTH", 6)
+	if length < 4 || length > 10 {
+		length = 6
 	}
 
-	return string(otp)
+	secret := os.Getenv("OTP_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_OTP")
+	}
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+
+	return &OTPService{
+		Length:          length,
+		TTL:             GetEnvDuration("OTP_TTL", 2*time.Minute),
+		MaxAttempts:     GetEnvInt("OTP_MAX_ATTEMPTS", 5),
+		LockoutDuration: GetEnvDuration("OTP_LOCKOUT", 15*time.Minute),
+		ResendCooldown:  GetEnvDuration("OTP_RESEND_COOLDOWN", time.Minute),
+		secret:          []byte(secret),
+	}
 }
 
-func GenerateTokenForReset(email string) (string, error){
-	secretKey := os.Getenv("JWT_OTP")
+func (s *OTPService) Generate() (string, error) {
+	if len(s.secret) == 0 {
+		return "", ErrMissingOTPSecret
+	}
+	otp := make([]byte, s.Length)
+	ten := big.NewInt(10)
+	for i := range otp {
+		n, err := rand.Int(rand.Reader, ten)
+		if err != nil {
+			return "", err
+		}
+		otp[i] = byte('0' + n.Int64())
+	}
+	return string(otp), nil
+}
+
+func (s *OTPService) Hash(userID int64, code string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(strconv.FormatInt(userID, 10) + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *OTPService) Matches(userID int64, code, hash string) bool {
+	if len(s.secret) == 0 {
+		return false
+	}
+	return hmac.Equal([]byte(s.Hash(userID, code)), []byte(hash))
+}
 
-	claims := jwt.MapClaims{
-		"email": email,
-		"exp":   time.Now().Add(1 * time.Minute).Unix(),
+// ValidFormat reports whether code has the configured length and only digits.
+func (s *OTPService) ValidFormat(code string) bool {
+	if len(code) != s.Length {
+		return false
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secretKey))
-}
\ No newline at end of file
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+package libs
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// PasswordPolicy is read from the environment:
+//
+//	PASSWORD_MIN_LENGTH      minimum length in characters (default 8)
+//	PASSWORD_REQUIRE_LOWER   at least one lowercase letter (default false)
+//	PASSWORD_REQUIRE_UPPER   at least one uppercase letter (default false)
+//	PASSWORD_REQUIRE_LETTER  at least one letter (default true)
+//	PASSWORD_REQUIRE_DIGIT   at least one digit (default true)
+//	PASSWORD_REQUIRE_SYMBOL  at least one symbol (default false)
+//	PASSWORD_CHECK_BREACHED  reject passwords on the breached list (default true)
+//	PASSWORD_HISTORY         previous passwords that may not be reused (default 5)
+type PasswordPolicy struct {
+	MinLength     int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireLetter bool
+	RequireDigit  bool
+	RequireSymbol bool
+	CheckBreached bool
+	HistorySize   int
+}
+
+func LoadPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:     GetEnvInt("PASSWORD_MIN_LENGTH", 8),
+		RequireLower:  GetEnvBool("PASSWORD_REQUIRE_LOWER", false),
+		RequireUpper:  GetEnvBool("PASSWORD_REQUIRE_UPPER", false),
+		RequireLetter: GetEnvBool("PASSWORD_REQUIRE_LETTER", true),
+		RequireDigit:  GetEnvBool("PASSWORD_REQUIRE_DIGIT", true),
+		RequireSymbol: GetEnvBool("PASSWORD_REQUIRE_SYMBOL", false),
+		CheckBreached: GetEnvBool("PASSWORD_CHECK_BREACHED", true),
+		HistorySize:   GetEnvInt("PASSWORD_HISTORY", 5),
+	}
+}
+
+// Check returns a user-facing reason when password breaks the policy. Reuse
+// of previous passwords needs the database and is checked in models.
+func (p PasswordPolicy) Check(password string) error {
+	if len([]rune(password)) < p.MinLength {
+		return fmt.Errorf("Password minimal %d karakter", p.MinLength)
+	}
+
+	var lower, upper, letter, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower, letter = true, true
+		case unicode.IsUpper(r):
+			upper, letter = true, true
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	switch {
+	case p.RequireLower && !lower:
+		return errors.New("Password harus mengandung huruf kecil")
+	case p.RequireUpper && !upper:
+		return errors.New("Password harus mengandung huruf besar")
+	case p.RequireLetter && !letter:
+		return errors.New("Password harus mengandung huruf")
+	case p.RequireDigit && !digit:
+		return errors.New("Password harus mengandung angka")
+	case p.RequireSymbol && !symbol:
+		return errors.New("Password harus mengandung simbol")
+	}
+
+	if p.CheckBreached && IsBreachedPassword(password) {
+		return errors.New("Password ini pernah bocor di data breach, gunakan password lain")
+	}
+	return nil
+}
+
+// CheckPasswordPolicy checks password against the policy from the environment.
+func CheckPasswordPolicy(password string) error {
+	return LoadPasswordPolicy().Check(password)
+}
+
+// The bundled list holds SHA-1 hashes split as PREFIX:SUFFIX, the same format
+// as the Have I Been Pwned range API. PASSWORD_BREACHED_FILE adds hashes from
+// a larger file in the same format or a full HIBP "HASH:COUNT" dump.
+//
+//go:embed breached_passwords.txt
+var bundledBreachedPasswords []byte
+
+var (
+	breachedOnce   sync.Once
+	breachedHashes map[string]struct{}
+)
+
+func loadBreachedHashes() {
+	breachedHashes = map[string]struct{}{}
+	readBreachedHashes(bundledBreachedPasswords)
+
+	if path := os.Getenv("PASSWORD_BREACHED_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Println("failed to read PASSWORD_BREACHED_FILE:", err)
+			return
+		}
+		readBreachedHashes(data)
+	}
+}
+
+func readBreachedHashes(data []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		first, rest, _ := strings.Cut(line, ":")
+		switch len(first) {
+		case 40:
+			// Full HIBP dumps: HASH:COUNT.
+			breachedHashes[strings.ToUpper(first)] = struct{}{}
+		case 5:
+			suffix, _, _ := strings.Cut(rest, ":")
+			breachedHashes[strings.ToUpper(first+suffix)] = struct{}{}
+		}
+	}
+}
+
+// IsBreachedPassword reports whether password, or its lowercase form, is on
+// the breached list.
+func IsBreachedPassword(password string) bool {
+	breachedOnce.Do(loadBreachedHashes)
+
+	for _, candidate := range []string{password, strings.ToLower(password)} {
+		sum := sha1.Sum([]byte(candidate))
+		if _, ok := breachedHashes[strings.ToUpper(hex.EncodeToString(sum[:]))]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package libs
+
+import "time"
+
+const (
+	PrincipalUser   = "user"
+	PrincipalAPIKey = "api_key"
+)
+
+// Principal is the authenticated caller stored in the gin context under
+// "principal", whether it came from a bearer JWT or an X-API-Key.
+type Principal struct {
+	Type        string
+	UserID      int
+	Email       string
+	Role        string
+	Permissions []string
+	MFA         bool
+	APIKeyID    int64
+	TokenID     string
+	SessionID   string
+	ExpiresAt   time.Time
+}
+
+func (p *Principal) HasPermission(permission string) bool {
+	for _, granted := range p.Permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func PrincipalFromClaims(claims *UserPayload) *Principal {
+	p := &Principal{
+		Type:        PrincipalUser,
+		UserID:      claims.Id,
+		Email:       claims.Email,
+		Role:        claims.Role,
+		Permissions: claims.Permissions,
+		MFA:         claims.MFA,
+		TokenID:     claims.ID,
+		SessionID:   claims.SessionID,
+	}
+	if claims.ExpiresAt != nil {
+		p.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return p
+}
@@ -0,0 +1,156 @@
+package libs
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimiter allows at most Limit hits per key within any Window (sliding
+// window log). Hits are kept in a Redis sorted set, or in process memory when
+// Redis is not configured.
+type RateLimiter struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+var (
+	rateLimitMu          sync.Mutex
+	rateLimitMemory      = map[string]*rateLimitHits{}
+	rateLimitSweeperOnce sync.Once
+)
+
+type rateLimitHits struct {
+	window time.Duration
+	hits   []time.Time
+}
+
+// startRateLimitSweeper drops in-memory keys whose newest hit has left its
+// window. Keys are caller-chosen (IPs, emails), so without this every new one
+// would stay in memory forever.
+func startRateLimitSweeper() {
+	rateLimitSweeperOnce.Do(func() {
+		StartSweeper("in-memory rate limiter", time.Minute, func() error {
+			now := time.Now()
+			rateLimitMu.Lock()
+			defer rateLimitMu.Unlock()
+			for key, entry := range rateLimitMemory {
+				if len(entry.hits) == 0 || !entry.hits[len(entry.hits)-1].After(now.Add(-entry.window)) {
+					delete(rateLimitMemory, key)
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// The check and the insert must happen atomically, otherwise concurrent
+// requests could all see room in the window.
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], 0, now - window)
+if redis.call('ZCARD', KEYS[1]) < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], window)
+	return 0
+end
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return tonumber(oldest[2]) + window - now
+`)
+
+// NewRateLimiter builds a limiter whose limit can be overridden with
+// RATE_LIMIT_<NAME>, written as "<limit>/<window>" (e.g. "10/15m").
+func NewRateLimiter(name string, limit int, window time.Duration) *RateLimiter {
+	envKey := "RATE_LIMIT_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+	if value := os.Getenv(envKey); value != "" {
+		parts := strings.SplitN(value, "/", 2)
+		if n, err := strconv.Atoi(strings.TrimSpace(parts[0])); err == nil && n > 0 {
+			limit = n
+		}
+		if len(parts) == 2 {
+			if d, err := time.ParseDuration(strings.TrimSpace(parts[1])); err == nil && d > 0 {
+				window = d
+			}
+		}
+	}
+	return &RateLimiter{Name: name, Limit: limit, Window: window}
+}
+
+// Allow records a hit for key. When the limit is reached it returns false and
+// how long until the oldest hit leaves the window.
+func (rl *RateLimiter) Allow(key string) (bool, time.Duration) {
+	storeKey := "ratelimit:" + rl.Name + ":" + key
+	now := time.Now()
+
+	if RedisClient != nil {
+		member, _ := GenerateRandomToken(8)
+		wait, err := slidingWindowScript.Run(Ctx, RedisClient, []string{storeKey},
+			now.UnixMilli(), rl.Window.Milliseconds(), rl.Limit, fmt.Sprintf("%d-%s", now.UnixNano(), member),
+		).Int64()
+		if err != nil {
+			// Fail open: an unavailable Redis must not lock everyone out.
+			log.Println("rate limiter failed:", err)
+			return true, 0
+		}
+		if wait > 0 {
+			return false, time.Duration(wait) * time.Millisecond
+		}
+		return true, 0
+	}
+
+	startRateLimitSweeper()
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+
+	entry := rateLimitMemory[storeKey]
+	if entry == nil {
+		entry = &rateLimitHits{}
+		rateLimitMemory[storeKey] = entry
+	}
+	entry.window = rl.Window
+
+	cutoff := now.Add(-rl.Window)
+	kept := entry.hits[:0]
+	for _, hit := range entry.hits {
+		if hit.After(cutoff) {
+			kept = append(kept, hit)
+		}
+	}
+
+	if len(kept) >= rl.Limit {
+		entry.hits = kept
+		return false, kept[0].Add(rl.Window).Sub(now)
+	}
+
+	entry.hits = append(kept, now)
+	return true, 0
+}
+
+// Reset forgets every hit recorded for key.
+func (rl *RateLimiter) Reset(key string) {
+	ResetRateLimit(rl.Name, key)
+}
+
+// ResetRateLimit clears key for the limiter registered under name, e.g. when
+// an admin lifts a lockout.
+func ResetRateLimit(name, key string) {
+	storeKey := "ratelimit:" + name + ":" + key
+
+	if RedisClient != nil {
+		RedisClient.Del(Ctx, storeKey)
+		return
+	}
+
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	delete(rateLimitMemory, storeKey)
+}
@@ -0,0 +1,83 @@
+package libs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+)
+
+// Secrets that must be recoverable (unlike passwords) are sealed with
+// AES-256-GCM. The key is derived from SECRET_ENCRYPTION_KEY, falling back to
+// JWT_SECRET so existing deployments keep working. With neither set there is
+// no key: sha256("") would be one anyone can compute.
+var ErrMissingSecretKey = errors.New("SECRET_ENCRYPTION_KEY is not set")
+
+func secretKey() ([]byte, error) {
+	key := os.Getenv("SECRET_ENCRYPTION_KEY")
+	if key == "" {
+		key = os.Getenv("JWT_SECRET")
+	}
+	if key == "" {
+		return nil, ErrMissingSecretKey
+	}
+	sum := sha256.Sum256([]byte(key))
+	return sum[:], nil
+}
+
+func EncryptString(plaintext string) (string, error) {
+	key, err := secretKey()
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func DecryptString(ciphertext string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := secretKey()
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
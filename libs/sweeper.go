@@ -0,0 +1,23 @@
+package libs
+
+import (
+	"log"
+	"time"
+)
+
+// StartSweeper runs sweep now and then every interval in the background, for
+// cleanup jobs of the long-running server. Serverless deployments have no
+// background goroutines and should call the matching admin endpoint from a
+// cron job instead.
+func StartSweeper(name string, interval time.Duration, sweep func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := sweep(); err != nil {
+				log.Printf("%s sweeper: %v", name, err)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,39 @@
+package libs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// GenerateRandomToken returns n random bytes encoded as URL-safe base64.
+func GenerateRandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken is used for high-entropy opaque tokens that are looked up by value,
+// so a fast hash is enough. Passwords must keep using HashPassword.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateAPIKey returns a new API key and its display prefix. Only the prefix
+// and HashToken(key) are stored.
+func GenerateAPIKey() (key, prefix string, err error) {
+	id, err := GenerateRandomToken(6)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	prefix = "cfk_" + id
+	return prefix + "_" + secret, prefix, nil
+}
@@ -42,6 +42,29 @@ func FormatValidationError(err error) map[string]string {
 			if tag == "min" {
 				errors[field] = "Password minimal 6 karakter"
 			}
+
+		case "currentpassword":
+			if tag == "required" {
+				errors[field] = "Password saat ini wajib diisi"
+			}
+
+		case "newpassword":
+			if tag == "required" {
+				errors[field] = "Password baru wajib diisi"
+			}
+
+		case "newemail":
+			if tag == "required" {
+				errors[field] = "Email baru wajib diisi"
+			}
+			if tag == "email" {
+				errors[field] = "Format email tidak valid"
+			}
+
+		case "token":
+			if tag == "required" {
+				errors[field] = "Token wajib diisi"
+			}
 		}
 	}
 
@@ -157,3 +180,28 @@ func FormatAdminUserValidationError(err error) map[string]string {
 	return errors
 }
 
+
+func FormatAPIKeyValidationError(err error) map[string]string {
+	errors := map[string]string{}
+
+	ve, ok := err.(validator.ValidationErrors)
+	if !ok {
+		errors["error"] = "Invalid input"
+		return errors
+	}
+
+	for _, e := range ve {
+		switch e.Field() {
+		case "Name":
+			if e.ActualTag() == "max" {
+				errors["name"] = "Name maksimal " + e.Param() + " karakter"
+			} else {
+				errors["name"] = "Name wajib diisi"
+			}
+		default:
+			errors["scopes"] = "Minimal satu scope wajib diisi"
+		}
+	}
+
+	return errors
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"coffeeder-backend/configs"
+	"coffeeder-backend/controllers"
 	_ "coffeeder-backend/docs" 
 	"coffeeder-backend/libs"
+	"coffeeder-backend/models"
 	"coffeeder-backend/routers"
+	"time"
 
 	"github.com/joho/godotenv"
 	swaggerFiles "github.com/swaggo/files"
@@ -22,6 +25,20 @@ func main() {
 	pg := configs.InitDbConfig()
 	r := routers.InitRouter(pg)
 	libs.InitRedis()
+	libs.InitJWTKeys()
+
+	libs.StartSweeper("account deletion", libs.GetEnvDuration("ACCOUNT_DELETION_SWEEP_INTERVAL", time.Hour), func() error {
+		_, err := controllers.SweepAccountDeletions(pg)
+		return err
+	})
+	libs.StartSweeper("cart reservations", libs.GetEnvDuration("CART_RESERVATION_SWEEP_INTERVAL", time.Minute), func() error {
+		_, err := models.ReleaseExpiredReservations(pg)
+		return err
+	})
+	libs.StartSweeper("low stock alerts", libs.GetEnvDuration("LOW_STOCK_SWEEP_INTERVAL", 5*time.Minute), func() error {
+		_, err := controllers.NotifyLowStock(pg)
+		return err
+	})
 
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
@@ -1,18 +1,42 @@
 package middlewares
 
 import (
+	"coffeeder-backend/configs"
 	"coffeeder-backend/libs"
-	"os"
+	"coffeeder-backend/models"
+	"errors"
+	"log"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// AuthMiddleware accepts either "Authorization: Bearer <jwt>" or "X-API-Key".
+// Both resolve to a *libs.Principal stored under "principal"; the older
+// userID/userEmail/userRole keys are still set for handlers that use them.
 func AuthMiddleware(requiredRole string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 
 		authHeader := ctx.GetHeader("Authorization")
+		if authHeader == "" {
+			if apiKey := ctx.GetHeader("X-API-Key"); apiKey != "" {
+				principal, ok := authenticateAPIKey(ctx, apiKey)
+				if !ok {
+					return
+				}
+				setPrincipal(ctx, principal)
+				if requiredRole != "" && principal.Role != requiredRole {
+					ctx.JSON(403, gin.H{"success": false, "message": "Not permission"})
+					ctx.Abort()
+					return
+				}
+				ctx.Next()
+				return
+			}
+		}
+
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
 			ctx.JSON(401, gin.H{"success": false, "message": "Missing or invalid Authorization header"})
 			ctx.Abort()
@@ -21,27 +45,45 @@ func AuthMiddleware(requiredRole string) gin.HandlerFunc {
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		secret := os.Getenv("JWT_SECRET")
-		if secret == "" {
-			ctx.JSON(500, gin.H{"success": false, "message": "Server missing JWT secret"})
+		claims, err := libs.ParseAccessToken(tokenString)
+
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			ctx.JSON(401, gin.H{"success": false, "message": "Token expired"})
 			ctx.Abort()
 			return
 		}
 
-		claims := &libs.UserPayload{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-			return []byte(secret), nil
-		})
-
-		if err != nil || !token.Valid {
+		if err != nil {
 			ctx.JSON(401, gin.H{"success": false, "message": "Invalid token"})
 			ctx.Abort()
 			return
 		}
 
-		ctx.Set("userID", claims.Id)
-		ctx.Set("userEmail", claims.Email)
-		ctx.Set("userRole", claims.Role)
+		if libs.IsTokenDenied(claims.ID) {
+			ctx.JSON(401, gin.H{"success": false, "message": "Token has been revoked"})
+			ctx.Abort()
+			return
+		}
+
+		if claims.IssuedAt != nil && libs.IsUserTokenRevoked(claims.Id, claims.IssuedAt.Time) {
+			ctx.JSON(401, gin.H{"success": false, "message": "Token has been revoked"})
+			ctx.Abort()
+			return
+		}
+
+		if libs.IsSessionRevoked(claims.SessionID) {
+			ctx.JSON(401, gin.H{"success": false, "message": "Session has been revoked"})
+			ctx.Abort()
+			return
+		}
+
+		if claims.SessionID != "" && libs.ShouldTouchSession(claims.SessionID, time.Minute) {
+			if err := models.TouchSession(configs.DB, claims.SessionID, ctx.ClientIP(), nil); err != nil {
+				log.Println("failed to record session activity:", err)
+			}
+		}
+
+		setPrincipal(ctx, libs.PrincipalFromClaims(claims))
 
 		if requiredRole != "" && claims.Role != requiredRole {
 			ctx.JSON(403, gin.H{"success": false, "message": "Not permission"})
@@ -49,6 +91,115 @@ func AuthMiddleware(requiredRole string) gin.HandlerFunc {
 			return
 		}
 
+		if requiredRole != "" && libs.TwoFactorRequiredForRole(claims.Role) && !claims.MFA {
+			ctx.JSON(403, gin.H{"success": false, "message": "Two-factor authentication required"})
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+func setPrincipal(ctx *gin.Context, p *libs.Principal) {
+	ctx.Set("principal", p)
+	if p.UserID != 0 {
+		ctx.Set("userID", p.UserID)
+		ctx.Set("userEmail", p.Email)
+		ctx.Set("userRole", p.Role)
+	}
+	ctx.Set("permissions", p.Permissions)
+	if p.TokenID != "" {
+		ctx.Set("tokenID", p.TokenID)
+		ctx.Set("tokenExpiresAt", p.ExpiresAt)
+	}
+	if p.SessionID != "" {
+		ctx.Set("sessionID", p.SessionID)
+	}
+	ctx.Set("mfa", p.MFA)
+}
+
+// authenticateAPIKey resolves an X-API-Key. A key acting as a user never gets
+// more than that user's role allows.
+func authenticateAPIKey(ctx *gin.Context, rawKey string) (*libs.Principal, bool) {
+	key, role, err := models.GetAPIKeyByHash(configs.DB, libs.HashToken(rawKey))
+	if err != nil || key.Status != "active" {
+		ctx.JSON(401, gin.H{"success": false, "message": "Invalid or expired API key"})
+		ctx.Abort()
+		return nil, false
+	}
+
+	permissions := key.Scopes
+	principal := &libs.Principal{
+		Type:     libs.PrincipalAPIKey,
+		APIKeyID: key.ID,
+	}
+
+	if key.UserID != nil {
+		rolePermissions, err := models.GetRolePermissions(configs.DB, role)
+		if err != nil {
+			ctx.JSON(500, gin.H{"success": false, "message": "Failed to resolve API key permissions"})
+			ctx.Abort()
+			return nil, false
+		}
+		permissions = intersect(key.Scopes, rolePermissions)
+
+		principal.UserID = int(*key.UserID)
+		principal.Role = role
+		if key.UserEmail != nil {
+			principal.Email = *key.UserEmail
+		}
+	}
+	principal.Permissions = permissions
+
+	if err := models.TouchAPIKey(configs.DB, key.ID, ctx.ClientIP()); err != nil {
+		log.Println("failed to record API key usage:", err)
+	}
+
+	return principal, true
+}
+
+func intersect(a, b []string) []string {
+	allowed := make(map[string]bool, len(b))
+	for _, v := range b {
+		allowed[v] = true
+	}
+	out := []string{}
+	for _, v := range a {
+		if allowed[v] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// RequirePermission must run after AuthMiddleware. It allows the request only
+// when the principal (token or API key) grants every listed permission.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		value, exists := ctx.Get("principal")
+		principal, ok := value.(*libs.Principal)
+		if !exists || !ok {
+			ctx.JSON(401, gin.H{"success": false, "message": "Missing or invalid Authorization header"})
+			ctx.Abort()
+			return
+		}
+
+		for _, permission := range permissions {
+			if !principal.HasPermission(permission) {
+				ctx.JSON(403, gin.H{"success": false, "message": "Not permission"})
+				ctx.Abort()
+				return
+			}
+		}
+
+		// API keys are a separate credential and are not subject to 2FA.
+		if principal.Type == libs.PrincipalUser && libs.TwoFactorRequiredForRole(principal.Role) && !principal.MFA {
+			ctx.JSON(403, gin.H{"success": false, "message": "Two-factor authentication required"})
+			ctx.Abort()
+			return
+		}
+
 		ctx.Next()
 	}
 }
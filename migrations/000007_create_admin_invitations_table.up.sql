@@ -0,0 +1,14 @@
+CREATE TABLE admin_invitations (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(100) NOT NULL,
+    role VARCHAR(100) NOT NULL DEFAULT 'admin',
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    invited_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    accepted_user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX idx_admin_invitations_email ON admin_invitations(email);
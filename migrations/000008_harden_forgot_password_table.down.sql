@@ -0,0 +1,10 @@
+DELETE FROM forgot_password;
+
+ALTER TABLE forgot_password
+    DROP COLUMN IF EXISTS attempts,
+    DROP COLUMN IF EXISTS locked_until,
+    DROP COLUMN IF EXISTS last_sent_at,
+    DROP COLUMN IF EXISTS verified_at;
+
+ALTER TABLE forgot_password ALTER COLUMN code_hash TYPE VARCHAR(100);
+ALTER TABLE forgot_password RENAME COLUMN code_hash TO token;
@@ -0,0 +1,11 @@
+-- Existing rows hold plaintext OTPs; they are dropped so only hashed codes remain.
+DELETE FROM forgot_password;
+
+ALTER TABLE forgot_password RENAME COLUMN token TO code_hash;
+ALTER TABLE forgot_password ALTER COLUMN code_hash TYPE VARCHAR(64);
+
+ALTER TABLE forgot_password
+    ADD COLUMN attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN locked_until TIMESTAMP,
+    ADD COLUMN last_sent_at TIMESTAMP DEFAULT now(),
+    ADD COLUMN verified_at TIMESTAMP;
@@ -0,0 +1,4 @@
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS mfa;
+
+DROP TABLE IF EXISTS totp_recovery_codes;
+DROP TABLE IF EXISTS user_totp;
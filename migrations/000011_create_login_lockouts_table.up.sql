@@ -0,0 +1,9 @@
+CREATE TABLE login_lockouts (
+    email VARCHAR(100) PRIMARY KEY,
+    failed_count INT NOT NULL DEFAULT 0,
+    last_failed_ip VARCHAR(64),
+    last_failed_at TIMESTAMP,
+    locked_until TIMESTAMP,
+    created_at TIMESTAMP DEFAULT now(),
+    updated_at TIMESTAMP DEFAULT now()
+);
@@ -0,0 +1,10 @@
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_fkey;
+ALTER TABLE users ALTER COLUMN role DROP NOT NULL;
+ALTER TABLE users ALTER COLUMN role DROP DEFAULT;
+
+UPDATE users SET role = 'user' WHERE role = 'customer';
+UPDATE users SET role = 'staff' WHERE role IN ('barista', 'manager');
+
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
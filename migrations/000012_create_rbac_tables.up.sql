@@ -0,0 +1,87 @@
+CREATE TABLE roles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description VARCHAR(255),
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE TABLE permissions (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description VARCHAR(255),
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE TABLE role_permissions (
+    role_id INT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id INT NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+INSERT INTO roles (name, description) VALUES
+('admin', 'Full access to the shop back office'),
+('manager', 'Manages catalogue and orders'),
+('barista', 'Processes orders'),
+('customer', 'Shops and manages their own account');
+
+INSERT INTO permissions (name, description) VALUES
+('profile:read', 'View own profile'),
+('profile:update', 'Update own profile'),
+('cart:manage', 'Add, view and clear own cart'),
+('orders:create', 'Check out and view shipping/payment options'),
+('orders:history', 'View own order history'),
+('orders:read', 'View all orders'),
+('orders:update', 'Update order status'),
+('orders:delete', 'Delete orders'),
+('products:read', 'View products in the back office'),
+('products:create', 'Create products'),
+('products:update', 'Update products and images'),
+('products:delete', 'Delete products and images'),
+('categories:read', 'View categories in the back office'),
+('categories:create', 'Create categories'),
+('categories:update', 'Update categories'),
+('categories:delete', 'Delete categories'),
+('users:read', 'View users'),
+('users:create', 'Create users'),
+('users:update', 'Update users and revoke their tokens'),
+('users:delete', 'Delete users'),
+('users:invite', 'Invite staff accounts'),
+('auth:lockouts', 'View and clear login lockouts');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p
+WHERE r.name = 'admin';
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name IN (
+    'profile:read', 'profile:update', 'cart:manage', 'orders:create', 'orders:history',
+    'orders:read', 'orders:update', 'orders:delete',
+    'products:read', 'products:create', 'products:update', 'products:delete',
+    'categories:read', 'categories:create', 'categories:update', 'categories:delete',
+    'users:read'
+)
+WHERE r.name = 'manager';
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name IN (
+    'profile:read', 'profile:update', 'cart:manage', 'orders:create', 'orders:history',
+    'orders:read', 'orders:update',
+    'products:read', 'categories:read'
+)
+WHERE r.name = 'barista';
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name IN (
+    'profile:read', 'profile:update', 'cart:manage', 'orders:create', 'orders:history'
+)
+WHERE r.name = 'customer';
+
+-- Map the legacy role strings onto the seeded roles.
+UPDATE users SET role = 'customer' WHERE role IS NULL OR role = 'user';
+UPDATE users SET role = 'barista' WHERE role = 'staff';
+UPDATE users SET role = 'customer' WHERE role NOT IN (SELECT name FROM roles);
+
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'customer';
+ALTER TABLE users ALTER COLUMN role SET NOT NULL;
+ALTER TABLE users
+    ADD CONSTRAINT users_role_fkey FOREIGN KEY (role) REFERENCES roles(name) ON UPDATE CASCADE;
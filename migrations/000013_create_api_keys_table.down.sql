@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE name = 'api-keys:manage';
+
+DROP TABLE IF EXISTS api_keys;
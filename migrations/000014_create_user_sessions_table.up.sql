@@ -0,0 +1,20 @@
+-- A session is one login; its id is the refresh token family id.
+CREATE TABLE user_sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_agent TEXT,
+    ip VARCHAR(64),
+    mfa BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP DEFAULT now(),
+    last_seen_at TIMESTAMP DEFAULT now(),
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX idx_user_sessions_user ON user_sessions(user_id);
+
+INSERT INTO user_sessions (id, user_id, mfa, created_at, last_seen_at, expires_at)
+SELECT family_id, user_id, bool_or(mfa), MIN(created_at), MAX(created_at), MAX(expires_at)
+FROM refresh_tokens
+GROUP BY family_id, user_id
+HAVING bool_or(revoked_at IS NULL);
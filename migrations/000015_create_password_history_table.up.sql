@@ -0,0 +1,13 @@
+CREATE TABLE password_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX idx_password_history_user ON password_history(user_id, created_at DESC);
+
+-- Current passwords count as the most recent history entry.
+INSERT INTO password_history (user_id, password_hash, created_at)
+SELECT id, password, COALESCE(updated_at, created_at, now())
+FROM users;
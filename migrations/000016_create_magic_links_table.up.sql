@@ -0,0 +1,12 @@
+CREATE TABLE magic_links (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    fingerprint VARCHAR(64) NOT NULL,
+    ip VARCHAR(64),
+    expires_at TIMESTAMP NOT NULL,
+    consumed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX idx_magic_links_user ON magic_links(user_id);
@@ -0,0 +1,12 @@
+-- user_id stays nullable: orders of removed users are kept rather than deleted.
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_user_id_fkey;
+ALTER TABLE transactions
+    ADD CONSTRAINT transactions_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+DROP INDEX IF EXISTS idx_users_deletion_scheduled;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS deletion_requested_at,
+    DROP COLUMN IF EXISTS deletion_scheduled_at,
+    DROP COLUMN IF EXISTS anonymized_at;
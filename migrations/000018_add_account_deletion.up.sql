@@ -0,0 +1,14 @@
+ALTER TABLE users
+    ADD COLUMN deletion_requested_at TIMESTAMP,
+    ADD COLUMN deletion_scheduled_at TIMESTAMP,
+    ADD COLUMN anonymized_at TIMESTAMP;
+
+CREATE INDEX idx_users_deletion_scheduled ON users(deletion_scheduled_at)
+    WHERE deletion_scheduled_at IS NOT NULL AND anonymized_at IS NULL;
+
+-- Orders are financial records: removing a user must not remove them.
+ALTER TABLE transactions ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_user_id_fkey;
+ALTER TABLE transactions
+    ADD CONSTRAINT transactions_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
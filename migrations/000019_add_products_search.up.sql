@@ -0,0 +1,37 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- 'simple' keeps product names and Indonesian words unstemmed; title ranks
+-- above category name, which ranks above description.
+ALTER TABLE products ADD COLUMN search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION products_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('simple', COALESCE(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('simple', COALESCE((SELECT name FROM categories WHERE id = NEW.category_id), '')), 'B') ||
+        setweight(to_tsvector('simple', COALESCE(NEW.description, '')), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER products_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF title, description, category_id ON products
+    FOR EACH ROW EXECUTE FUNCTION products_search_vector_update();
+
+-- Renaming a category re-indexes its products.
+CREATE OR REPLACE FUNCTION categories_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    UPDATE products SET title = title WHERE category_id = NEW.id;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER categories_search_vector_trigger
+    AFTER UPDATE OF name ON categories
+    FOR EACH ROW WHEN (OLD.name IS DISTINCT FROM NEW.name)
+    EXECUTE FUNCTION categories_search_vector_update();
+
+UPDATE products SET title = title;
+
+CREATE INDEX idx_products_search_vector ON products USING GIN (search_vector);
+CREATE INDEX idx_products_title_trgm ON products USING GIN (title gin_trgm_ops);
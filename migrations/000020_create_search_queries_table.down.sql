@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_transaction_items_product;
+DROP TABLE IF EXISTS search_queries;
@@ -0,0 +1,9 @@
+-- Normalised search box queries that returned results, for suggestions.
+CREATE TABLE search_queries (
+    query VARCHAR(100) PRIMARY KEY,
+    hits INT NOT NULL DEFAULT 1,
+    last_searched_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_search_queries_prefix ON search_queries(query text_pattern_ops);
+CREATE INDEX idx_transaction_items_product ON transaction_items(product_id);
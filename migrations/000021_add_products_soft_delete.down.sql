@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE name = 'products:trash';
+
+DROP INDEX IF EXISTS idx_products_deleted_at;
@@ -0,0 +1,10 @@
+-- Deleted products are kept (deleted_at set) so past orders still reference
+-- them; this index serves the admin trash listing.
+CREATE INDEX idx_products_deleted_at ON products(deleted_at) WHERE deleted_at IS NOT NULL;
+
+INSERT INTO permissions (name, description) VALUES
+('products:trash', 'View the product trash, restore and permanently delete products');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name = 'products:trash'
+WHERE r.name = 'admin';
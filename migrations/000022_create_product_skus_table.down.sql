@@ -0,0 +1,9 @@
+ALTER TABLE transaction_items DROP COLUMN IF EXISTS sku_id;
+
+DROP INDEX IF EXISTS idx_carts_sku;
+ALTER TABLE carts DROP COLUMN IF EXISTS sku_id;
+
+DROP TRIGGER IF EXISTS product_skus_sync_stock ON product_skus;
+DROP FUNCTION IF EXISTS product_skus_sync_stock();
+
+DROP TABLE IF EXISTS product_skus;
@@ -0,0 +1,83 @@
+-- One row per size/variant combination a product is sold in. size_id or
+-- variant_id is NULL when the product has no sizes or no variants. price
+-- overrides base_price + size and variant surcharges when set.
+CREATE TABLE product_skus (
+    id SERIAL PRIMARY KEY,
+    product_id BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    size_id INT REFERENCES sizes(id),
+    variant_id INT REFERENCES variants(id),
+    stock INT NOT NULL DEFAULT 0 CHECK (stock >= 0),
+    price NUMERIC CHECK (price > 0),
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT now(),
+    updated_at TIMESTAMP DEFAULT now()
+);
+
+CREATE UNIQUE INDEX idx_product_skus_option
+    ON product_skus(product_id, COALESCE(size_id, 0), COALESCE(variant_id, 0));
+
+-- products.stock becomes the total of the product's active SKUs, so listings,
+-- filters and facets keep working off a single column.
+CREATE FUNCTION product_skus_sync_stock() RETURNS trigger AS $$
+DECLARE
+    pid BIGINT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        pid := OLD.product_id;
+    ELSE
+        pid := NEW.product_id;
+    END IF;
+
+    UPDATE products SET stock = (
+        SELECT COALESCE(SUM(stock), 0) FROM product_skus
+        WHERE product_id = pid AND is_active
+    ) WHERE id = pid;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER product_skus_sync_stock
+    AFTER INSERT OR DELETE OR UPDATE OF stock, is_active ON product_skus
+    FOR EACH ROW EXECUTE FUNCTION product_skus_sync_stock();
+
+-- Backfill one SKU per size x variant each product offers and spread its
+-- current stock over them, so the product total stays the same.
+WITH options AS (
+    SELECT p.id AS product_id, s.size_id, v.variant_id, GREATEST(COALESCE(p.stock, 0), 0) AS stock
+    FROM products p
+    LEFT JOIN LATERAL (SELECT DISTINCT size_id FROM product_sizes WHERE product_id = p.id) s ON true
+    LEFT JOIN LATERAL (SELECT DISTINCT variant_id FROM product_variants WHERE product_id = p.id) v ON true
+), numbered AS (
+    SELECT options.*,
+        ROW_NUMBER() OVER (PARTITION BY product_id ORDER BY size_id NULLS FIRST, variant_id NULLS FIRST) AS n,
+        COUNT(*) OVER (PARTITION BY product_id) AS option_count
+    FROM options
+)
+INSERT INTO product_skus (product_id, size_id, variant_id, stock)
+SELECT product_id, size_id, variant_id,
+    stock / option_count + CASE WHEN n <= stock % option_count THEN 1 ELSE 0 END
+FROM numbered;
+
+ALTER TABLE carts ADD COLUMN sku_id INT REFERENCES product_skus(id) ON DELETE CASCADE;
+
+UPDATE carts c SET sku_id = k.id
+FROM product_skus k
+WHERE k.product_id = c.product_id
+    AND COALESCE(k.size_id, 0) = COALESCE(c.size_id, 0)
+    AND COALESCE(k.variant_id, 0) = COALESCE(c.variant_id, 0);
+
+-- Cart rows for a size/variant the product doesn't offer could never be
+-- checked out.
+DELETE FROM carts WHERE sku_id IS NULL;
+
+ALTER TABLE carts ALTER COLUMN sku_id SET NOT NULL;
+CREATE INDEX idx_carts_sku ON carts(sku_id);
+
+-- Orders remember the SKU they sold; old orders are matched where possible.
+ALTER TABLE transaction_items ADD COLUMN sku_id INT REFERENCES product_skus(id) ON DELETE SET NULL;
+
+UPDATE transaction_items ti SET sku_id = k.id
+FROM product_skus k
+WHERE k.product_id = ti.product_id
+    AND COALESCE(k.size_id, 0) = COALESCE(ti.size_id, 0)
+    AND COALESCE(k.variant_id, 0) = COALESCE(ti.variant_id, 0);
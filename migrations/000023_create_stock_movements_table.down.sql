@@ -0,0 +1,7 @@
+DELETE FROM permissions WHERE name IN ('inventory:read', 'inventory:adjust');
+
+ALTER TABLE product_skus DROP COLUMN IF EXISTS low_stock_alerted_at;
+
+DROP TRIGGER IF EXISTS stock_movements_append_only ON stock_movements;
+DROP FUNCTION IF EXISTS stock_movements_append_only();
+DROP TABLE IF EXISTS stock_movements;
@@ -0,0 +1,58 @@
+-- Append-only ledger of every SKU stock change. quantity is signed (negative
+-- for sales and waste) and balance is the SKU stock after the change.
+CREATE TABLE stock_movements (
+    id BIGSERIAL PRIMARY KEY,
+    product_id BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    sku_id INT NOT NULL REFERENCES product_skus(id) ON DELETE CASCADE,
+    quantity INT NOT NULL CHECK (quantity <> 0),
+    balance INT NOT NULL CHECK (balance >= 0),
+    reason VARCHAR(20) NOT NULL CHECK (reason IN ('sale', 'restock', 'adjustment', 'refund', 'waste')),
+    user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    transaction_id INT REFERENCES transactions(id) ON DELETE SET NULL,
+    note VARCHAR(255),
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX idx_stock_movements_product ON stock_movements(product_id, created_at DESC);
+CREATE INDEX idx_stock_movements_transaction ON stock_movements(transaction_id) WHERE transaction_id IS NOT NULL;
+
+-- Movements can't be edited or removed directly. Foreign key actions (purging
+-- a product, deleting a user or an order) run one trigger level deeper and
+-- are let through.
+CREATE FUNCTION stock_movements_append_only() RETURNS trigger AS $$
+BEGIN
+    IF pg_trigger_depth() <= 1 THEN
+        RAISE EXCEPTION 'stock_movements is append-only';
+    END IF;
+    IF TG_OP = 'DELETE' THEN
+        RETURN OLD;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER stock_movements_append_only
+    BEFORE UPDATE OR DELETE ON stock_movements
+    FOR EACH ROW EXECUTE FUNCTION stock_movements_append_only();
+
+-- Opening balance for the stock SKUs already hold.
+INSERT INTO stock_movements (product_id, sku_id, quantity, balance, reason, note)
+SELECT product_id, id, stock, stock, 'adjustment', 'Opening balance'
+FROM product_skus
+WHERE stock > 0;
+
+-- Set when a low-stock email went out for the SKU, cleared once it is
+-- restocked above the threshold, so each drop is reported once.
+ALTER TABLE product_skus ADD COLUMN low_stock_alerted_at TIMESTAMP;
+
+INSERT INTO permissions (name, description) VALUES
+('inventory:read', 'View stock movements and low-stock SKUs'),
+('inventory:adjust', 'Record stock adjustments, restocks, refunds and waste');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name IN ('inventory:read', 'inventory:adjust')
+WHERE r.name IN ('admin', 'manager');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name = 'inventory:read'
+WHERE r.name = 'barista';
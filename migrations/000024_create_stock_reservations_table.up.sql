@@ -0,0 +1,14 @@
+-- Units held for a cart row until expires_at. Available stock of a SKU is its
+-- stock minus unexpired reservations; deleting the cart row (checkout,
+-- removing the item, trashing the product) releases the reservation.
+CREATE TABLE stock_reservations (
+    id BIGSERIAL PRIMARY KEY,
+    cart_id INT NOT NULL UNIQUE REFERENCES carts(id) ON DELETE CASCADE,
+    sku_id INT NOT NULL REFERENCES product_skus(id) ON DELETE CASCADE,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX idx_stock_reservations_sku ON stock_reservations(sku_id, expires_at);
+CREATE INDEX idx_stock_reservations_expires ON stock_reservations(expires_at);
@@ -0,0 +1,8 @@
+DELETE FROM permissions WHERE name IN ('promos:read', 'promos:create', 'promos:update', 'promos:delete');
+
+DROP INDEX IF EXISTS idx_product_promos_product;
+DROP INDEX IF EXISTS idx_product_promos_promo_product;
+
+ALTER TABLE promos
+    DROP CONSTRAINT IF EXISTS promos_discount_check,
+    DROP CONSTRAINT IF EXISTS promos_period_check;
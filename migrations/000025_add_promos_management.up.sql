@@ -0,0 +1,24 @@
+-- Enforced for promos created or edited from now on; rows entered by hand
+-- before are not re-checked.
+ALTER TABLE promos
+    ADD CONSTRAINT promos_period_check CHECK (start < "end") NOT VALID,
+    ADD CONSTRAINT promos_discount_check CHECK (discount > 0) NOT VALID;
+
+DELETE FROM product_promos a
+USING product_promos b
+WHERE a.promo_id = b.promo_id AND a.product_id = b.product_id AND a.id > b.id;
+
+CREATE UNIQUE INDEX idx_product_promos_promo_product ON product_promos(promo_id, product_id);
+CREATE INDEX idx_product_promos_product ON product_promos(product_id);
+
+INSERT INTO permissions (name, description) VALUES
+('promos:read', 'View promos in the back office'),
+('promos:create', 'Create promos'),
+('promos:update', 'Update promos and assign products to them'),
+('promos:delete', 'Delete promos');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name IN (
+    'promos:read', 'promos:create', 'promos:update', 'promos:delete'
+)
+WHERE r.name IN ('admin', 'manager');
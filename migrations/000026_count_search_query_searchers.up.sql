@@ -0,0 +1,10 @@
+-- Suggestions count distinct searchers instead of raw searches, so repeating a
+-- query from one client cannot make it popular. Existing counts cannot be
+-- attributed to searchers and are dropped.
+DELETE FROM search_queries;
+
+CREATE TABLE search_query_searchers (
+    query VARCHAR(100) NOT NULL,
+    searcher VARCHAR(64) NOT NULL,
+    PRIMARY KEY (query, searcher)
+);
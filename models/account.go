@@ -0,0 +1,116 @@
+package models
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrEmailTaken   = errors.New("email already registered")
+	ErrEmailChanged = errors.New("email has changed since the request")
+)
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required"`
+}
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"newEmail" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// GetUserCredentials returns the user's current email and password hash.
+func GetUserCredentials(db *pgxpool.Pool, userID int64) (string, string, error) {
+	var email, hashed string
+	err := db.QueryRow(context.Background(),
+		`SELECT email, password FROM users WHERE id=$1`, userID,
+	).Scan(&email, &hashed)
+	return email, hashed, err
+}
+
+func UpdatePassword(db *pgxpool.Pool, userID int64, hashedPassword string) error {
+	ctx := context.Background()
+	_, err := db.Exec(ctx, `
+		UPDATE users SET password=$1, updated_at=NOW()
+		WHERE id=$2
+	`, hashedPassword, userID)
+	if err != nil {
+		return err
+	}
+	return recordPasswordHistory(ctx, db, userID, hashedPassword)
+}
+
+// ChangeEmail moves the user from oldEmail to newEmail. The new address was
+// confirmed through a link, so it is marked verified.
+func ChangeEmail(db *pgxpool.Pool, userID int64, oldEmail, newEmail string) error {
+	res, err := db.Exec(context.Background(), `
+		UPDATE users
+		SET email=$3, email_verified_at=NOW(), updated_at=NOW()
+		WHERE id=$1 AND LOWER(email)=LOWER($2)
+	`, userID, oldEmail, newEmail)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrEmailTaken
+		}
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return ErrEmailChanged
+	}
+	return nil
+}
+
+// RevokeOtherSessions ends every active session of the user except keepID and
+// returns the IDs it ended.
+func RevokeOtherSessions(db *pgxpool.Pool, userID int64, keepID string) ([]string, error) {
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		UPDATE user_sessions
+		SET revoked_at=NOW()
+		WHERE user_id=$1 AND id<>$2 AND revoked_at IS NULL
+		RETURNING id
+	`, userID, keepID)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at=NOW()
+		WHERE user_id=$1 AND family_id<>$2 AND revoked_at IS NULL
+	`, userID, keepID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, tx.Commit(ctx)
+}
@@ -0,0 +1,205 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrNoDeletionScheduled = errors.New("no account deletion is scheduled")
+
+// DeleteAccountRequest confirms the deletion with the current password.
+// Without one (e.g. accounts created through social login, which have no
+// usable password) a confirmation link is emailed instead.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+type ConfirmAccountDeletionRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type AccountDeletionResponse struct {
+	RequestedAt time.Time `json:"requestedAt"`
+	ScheduledAt time.Time `json:"scheduledAt"`
+}
+
+type AccountExport struct {
+	ExportedAt time.Time       `json:"exportedAt"`
+	Profile    ProfileResponse `json:"profile"`
+	Cart       CartResponse    `json:"cart"`
+	Orders     []HistoryDetail `json:"orders"`
+}
+
+// ScheduleAccountDeletion marks the account for anonymisation at scheduledAt.
+// Asking again keeps the original schedule.
+func ScheduleAccountDeletion(db *pgxpool.Pool, userID int64, scheduledAt time.Time) (AccountDeletionResponse, error) {
+	var resp AccountDeletionResponse
+	err := db.QueryRow(context.Background(), `
+		UPDATE users
+		SET deletion_requested_at=COALESCE(deletion_requested_at, NOW()),
+			deletion_scheduled_at=COALESCE(deletion_scheduled_at, $2),
+			updated_at=NOW()
+		WHERE id=$1 AND anonymized_at IS NULL
+		RETURNING deletion_requested_at, deletion_scheduled_at
+	`, userID, scheduledAt).Scan(&resp.RequestedAt, &resp.ScheduledAt)
+	return resp, err
+}
+
+func CancelAccountDeletion(db *pgxpool.Pool, userID int64) error {
+	res, err := db.Exec(context.Background(), `
+		UPDATE users
+		SET deletion_requested_at=NULL, deletion_scheduled_at=NULL, updated_at=NOW()
+		WHERE id=$1 AND deletion_scheduled_at IS NOT NULL AND anonymized_at IS NULL
+	`, userID)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return ErrNoDeletionScheduled
+	}
+	return nil
+}
+
+// AnonymizeDueAccounts anonymises every account whose grace period is over
+// and returns their IDs. The users row and orders are kept for accounting;
+// personal data in users, profile and transactions is overwritten and
+// everything else tied to the login is removed.
+func AnonymizeDueAccounts(db *pgxpool.Pool) ([]int64, error) {
+	ctx := context.Background()
+
+	rows, err := db.Query(ctx, `
+		SELECT id FROM users
+		WHERE deletion_scheduled_at <= NOW() AND anonymized_at IS NULL
+		ORDER BY deletion_scheduled_at
+		LIMIT 100
+	`)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := scanIDs(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []int64{}
+	for _, id := range ids {
+		ok, err := anonymizeAccount(ctx, db, id)
+		if err != nil {
+			return done, err
+		}
+		if ok {
+			done = append(done, id)
+		}
+	}
+	return done, nil
+}
+
+func anonymizeAccount(ctx context.Context, db *pgxpool.Pool, userID int64) (bool, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Re-check under the row lock: the user may have cancelled meanwhile, or
+	// another instance got here first.
+	res, err := tx.Exec(ctx, `
+		UPDATE users
+		SET fullname='Deleted user',
+			email='deleted-' || id || '@deleted.invalid',
+			password='!',
+			reset_token=NULL, reset_expires=NULL, reset_otp=NULL,
+			email_verified_at=NULL,
+			anonymized_at=NOW(),
+			updated_at=NOW()
+		WHERE id=$1 AND deletion_scheduled_at <= NOW() AND anonymized_at IS NULL
+	`, userID)
+	if err != nil {
+		return false, err
+	}
+	if res.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	statements := []string{
+		`UPDATE profile SET image=NULL, phone=NULL, address=NULL, updated_at=NOW() WHERE user_id=$1`,
+		`UPDATE transactions SET fullname='Deleted user', email='', phone='', address='', updated_at=NOW() WHERE user_id=$1`,
+		`DELETE FROM carts WHERE user_id=$1`,
+		`DELETE FROM forgot_password WHERE user_id=$1`,
+		`DELETE FROM refresh_tokens WHERE user_id=$1`,
+		`DELETE FROM user_sessions WHERE user_id=$1`,
+		`DELETE FROM user_totp WHERE user_id=$1`,
+		`DELETE FROM totp_recovery_codes WHERE user_id=$1`,
+		`DELETE FROM api_keys WHERE user_id=$1`,
+		`DELETE FROM password_history WHERE user_id=$1`,
+		`DELETE FROM magic_links WHERE user_id=$1`,
+		`DELETE FROM user_identities WHERE user_id=$1`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(ctx, stmt, userID); err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// GetAccountExport collects the user's profile, cart and full order history.
+func GetAccountExport(db *pgxpool.Pool, userID int64) (*AccountExport, error) {
+	ctx := context.Background()
+	export := &AccountExport{ExportedAt: time.Now(), Orders: []HistoryDetail{}}
+
+	p := &export.Profile
+	err := db.QueryRow(ctx, `
+		SELECT u.id, u.fullname, u.email, pr.image, pr.phone, pr.address, u.id, u.created_at, u.updated_at
+		FROM users u
+		LEFT JOIN profile pr ON pr.user_id = u.id
+		WHERE u.id=$1
+	`, userID).Scan(&p.ID, &p.Fullname, &p.Email, &p.Image, &p.Phone, &p.Address, &p.UserID, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	export.Cart, err = GetCartByUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if export.Cart.Items == nil {
+		export.Cart.Items = []CartItemResponse{}
+	}
+
+	rows, err := db.Query(ctx, `SELECT id FROM transactions WHERE user_id=$1 ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	orderIDs, err := scanIDs(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range orderIDs {
+		order, err := GetHistoryDetail(db, id, userID)
+		if err != nil {
+			return nil, err
+		}
+		export.Orders = append(export.Orders, *order)
+	}
+
+	return export, nil
+}
+
+func scanIDs(rows pgx.Rows) ([]int64, error) {
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
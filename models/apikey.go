@@ -0,0 +1,184 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrAPIKeyNotFound = errors.New("api key not found or already revoked")
+
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	UserID     *int64     `json:"userId,omitempty"`
+	UserEmail  *string    `json:"userEmail,omitempty"`
+	CreatedBy  *int64     `json:"createdBy,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	LastUsedIP *string    `json:"lastUsedIp,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	Status     string     `json:"status"`
+}
+
+type APIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,required"`
+	UserID    *int64     `json:"userId"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type APIKeyCreated struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+func (k *APIKey) setStatus() {
+	switch {
+	case k.RevokedAt != nil:
+		k.Status = "revoked"
+	case k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt):
+		k.Status = "expired"
+	default:
+		k.Status = "active"
+	}
+}
+
+const apiKeyColumns = `
+	k.id, k.name, k.prefix, k.scopes, k.user_id, u.email, k.created_by,
+	k.expires_at, k.last_used_at, k.last_used_ip, k.revoked_at, k.created_at
+`
+
+func scanAPIKey(row interface{ Scan(...any) error }) (APIKey, error) {
+	var k APIKey
+	err := row.Scan(
+		&k.ID, &k.Name, &k.Prefix, &k.Scopes, &k.UserID, &k.UserEmail, &k.CreatedBy,
+		&k.ExpiresAt, &k.LastUsedAt, &k.LastUsedIP, &k.RevokedAt, &k.CreatedAt,
+	)
+	if err != nil {
+		return APIKey{}, err
+	}
+	k.setStatus()
+	return k, nil
+}
+
+func CreateAPIKey(db *pgxpool.Pool, req APIKeyRequest, prefix, keyHash string, createdBy int64) (APIKey, error) {
+	ctx := context.Background()
+
+	var id int64
+	err := db.QueryRow(ctx, `
+		INSERT INTO api_keys (name, prefix, key_hash, scopes, user_id, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, req.Name, prefix, keyHash, req.Scopes, req.UserID, createdBy, req.ExpiresAt).Scan(&id)
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	return scanAPIKey(db.QueryRow(ctx, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys k
+		LEFT JOIN users u ON u.id = k.user_id
+		WHERE k.id=$1
+	`, id))
+}
+
+func GetAPIKeys(db *pgxpool.Pool) ([]APIKey, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys k
+		LEFT JOIN users u ON u.id = k.user_id
+		ORDER BY k.created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// GetAPIKeyByHash returns the key and the role of the user it acts as ("" for
+// keys without a user).
+func GetAPIKeyByHash(db *pgxpool.Pool, keyHash string) (*APIKey, string, error) {
+	var role *string
+	var k APIKey
+	err := db.QueryRow(context.Background(), `
+		SELECT `+apiKeyColumns+`, u.role
+		FROM api_keys k
+		LEFT JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash=$1
+	`, keyHash).Scan(
+		&k.ID, &k.Name, &k.Prefix, &k.Scopes, &k.UserID, &k.UserEmail, &k.CreatedBy,
+		&k.ExpiresAt, &k.LastUsedAt, &k.LastUsedIP, &k.RevokedAt, &k.CreatedAt, &role,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	k.setStatus()
+	if role == nil {
+		return &k, "", nil
+	}
+	return &k, *role, nil
+}
+
+// TouchAPIKey records usage, writing at most once a minute per key.
+func TouchAPIKey(db *pgxpool.Pool, id int64, ip string) error {
+	_, err := db.Exec(context.Background(), `
+		UPDATE api_keys
+		SET last_used_at=NOW(), last_used_ip=$2
+		WHERE id=$1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`, id, ip)
+	return err
+}
+
+func RevokeAPIKey(db *pgxpool.Pool, id int64) error {
+	res, err := db.Exec(context.Background(), `
+		UPDATE api_keys SET revoked_at=NOW()
+		WHERE id=$1 AND revoked_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// UnknownPermissions returns the names in permissions that do not exist.
+func UnknownPermissions(db *pgxpool.Pool, permissions []string) ([]string, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT s.name
+		FROM unnest($1::text[]) AS s(name)
+		LEFT JOIN permissions p ON p.name = s.name
+		WHERE p.id IS NULL
+	`, permissions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	unknown := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		unknown = append(unknown, name)
+	}
+	return unknown, rows.Err()
+}
@@ -1,9 +1,12 @@
 package models
 
 import (
+	"coffeeder-backend/libs"
 	"context"
+	"errors"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -11,19 +14,20 @@ import (
 type UserRegister struct {
     Fullname string `json:"fullname" validate:"required"`
     Email    string `json:"email" validate:"required,email"`
-    Password string `json:"password" validate:"required,min=6"`
-    Role     string `json:"role"`
+    Password string `json:"password" validate:"required"`
 }
 
 
 type UserResponse struct {
-    ID        int64     `json:"id"`
-    Fullname  string    `json:"fullname"`
-    Email     string    `json:"email"`
-    Role      string    `json:"role"`
-    Token     string    `json:"token,omitempty"`
-    CreatedAt time.Time `json:"createdAt"`
-    UpdatedAt time.Time `json:"updatedAt"`
+    ID              int64      `json:"id"`
+    Fullname        string     `json:"fullname"`
+    Email           string     `json:"email"`
+    Role            string     `json:"role"`
+    EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+    Token           string     `json:"token,omitempty"`
+    RefreshToken    string     `json:"refreshToken,omitempty"`
+    CreatedAt       time.Time  `json:"createdAt"`
+    UpdatedAt       time.Time  `json:"updatedAt"`
 }
 
 type UserLogin struct {
@@ -37,35 +41,45 @@ type ForgotPasswordRequest struct {
 
 type VerifyOTPRequest struct {
     Email string `json:"email" binding:"required,email"`
-    OTP   string `json:"otp" binding:"required,len=6"`
+    OTP   string `json:"otp" binding:"required"`
 }
 
 type ResetPasswordRequest struct {
     Token    string `json:"token" binding:"required"`
-    Password string `json:"password" binding:"required,min=6"`
+    Password string `json:"password" binding:"required"`
+}
+
+type VerifyEmailRequest struct {
+    Token string `json:"token" binding:"required"`
+}
+
+type ResendVerificationRequest struct {
+    Email string `json:"email" binding:"required,email"`
 }
 
 type ForgotPassword struct {
-	ID        int       `json:"id"`
-	UserID    int64     `json:"userId"`
-	Token     string    `json:"token"`
-	ExpiresAt time.Time `json:"expiresAt"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID          int        `json:"id"`
+	UserID      int64      `json:"userId"`
+	CodeHash    string     `json:"-"`
+	Attempts    int        `json:"attempts"`
+	LockedUntil *time.Time `json:"lockedUntil,omitempty"`
+	LastSentAt  *time.Time `json:"lastSentAt,omitempty"`
+	VerifiedAt  *time.Time `json:"verifiedAt,omitempty"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
 }
 
 
 func RegisterUser(db *pgxpool.Pool, user UserRegister, hashedPassword string) (UserResponse, error) {
     var resp UserResponse
 
-    role := user.Role
-    if role == "" {
-        role = "user"
-    }
+    // Public registration always creates customers; staff are invited.
+    role := "customer"
 
     query := `
         INSERT INTO users (fullname, email, password, role, created_at, updated_at)
         VALUES ($1, $2, $3, $4, NOW(), NOW())
-        RETURNING id, fullname, email, role, created_at, updated_at
+        RETURNING id, fullname, email, role, email_verified_at, created_at, updated_at
     `
 
     err := db.QueryRow(
@@ -80,6 +94,7 @@ func RegisterUser(db *pgxpool.Pool, user UserRegister, hashedPassword string) (U
         &resp.Fullname,
         &resp.Email,
         &resp.Role,
+        &resp.EmailVerifiedAt,
         &resp.CreatedAt,
         &resp.UpdatedAt,
     )
@@ -88,6 +103,10 @@ func RegisterUser(db *pgxpool.Pool, user UserRegister, hashedPassword string) (U
         return UserResponse{}, err
     }
 
+    if err := recordPasswordHistory(context.Background(), db, resp.ID, hashedPassword); err != nil {
+        return UserResponse{}, err
+    }
+
     return resp, nil
 }
 
@@ -97,7 +116,7 @@ func LoginUser(db *pgxpool.Pool, email string) (*UserResponse, string, string, e
 	var hashedPassword string
 
 	query := `
-		SELECT id, fullname, email, password, role, created_at, updated_at
+		SELECT id, fullname, email, password, role, email_verified_at, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`
@@ -108,6 +127,7 @@ func LoginUser(db *pgxpool.Pool, email string) (*UserResponse, string, string, e
 		&user.Email,
 		&hashedPassword,
 		&user.Role,
+		&user.EmailVerifiedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -118,31 +138,224 @@ func LoginUser(db *pgxpool.Pool, email string) (*UserResponse, string, string, e
 	return &user, hashedPassword, user.Role, nil
 }
 
-func CreateForgotPassword(db *pgxpool.Pool, userID int64, token string, duration time.Duration) error {
-	expires := time.Now().Add(duration)
-	_, err := db.Exec(context.Background(),
-		`INSERT INTO forgot_password (user_id, token, expires_at)
-		 VALUES ($1, $2, $3)
-		 ON CONFLICT (user_id)
-		 DO UPDATE SET token = EXCLUDED.token, expires_at = EXCLUDED.expires_at`,
-		userID, token, expires,
+func IsEmailRegistered(db *pgxpool.Pool, email string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(context.Background(),
+		`SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(email)=LOWER($1))`, email,
+	).Scan(&exists)
+	return exists, err
+}
+
+func GetUserByID(db *pgxpool.Pool, id int64) (*UserResponse, error) {
+	var user UserResponse
+	err := db.QueryRow(context.Background(), `
+		SELECT id, fullname, email, role, email_verified_at, created_at, updated_at
+		FROM users
+		WHERE id = $1
+	`, id).Scan(
+		&user.ID,
+		&user.Fullname,
+		&user.Email,
+		&user.Role,
+		&user.EmailVerifiedAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
 	)
-	return err
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
+// MarkEmailVerified verifies the user's email only if it still matches the
+// address the link was sent to. It reports false when nothing was updated
+// (already verified or the email has changed since).
+func MarkEmailVerified(db *pgxpool.Pool, userID int64, email string) (bool, error) {
+	res, err := db.Exec(context.Background(), `
+		UPDATE users
+		SET email_verified_at=NOW(), updated_at=NOW()
+		WHERE id=$1 AND LOWER(email)=LOWER($2) AND email_verified_at IS NULL
+	`, userID, email)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
 
-func GetForgotPasswordByToken(db *pgxpool.Pool, token string) (*ForgotPassword, error) {
-	var fp ForgotPassword
+func IsEmailVerified(db *pgxpool.Pool, userID int64) (bool, error) {
+	var verified bool
 	err := db.QueryRow(context.Background(),
-		`SELECT id, user_id, token, expires_at, created_at FROM forgot_password WHERE token=$1`,
-		token,
-	).Scan(&fp.ID, &fp.UserID, &fp.Token, &fp.ExpiresAt, &fp.CreatedAt)
+		`SELECT email_verified_at IS NOT NULL FROM users WHERE id=$1`, userID,
+	).Scan(&verified)
+	return verified, err
+}
+
+var (
+	ErrOTPInvalid  = errors.New("invalid otp")
+	ErrOTPExpired  = errors.New("otp expired")
+	ErrOTPLocked   = errors.New("too many invalid attempts")
+	ErrOTPCooldown = errors.New("otp was sent recently")
+)
+
+func GetForgotPasswordByUser(db *pgxpool.Pool, userID int64) (*ForgotPassword, error) {
+	var fp ForgotPassword
+	err := db.QueryRow(context.Background(), `
+		SELECT id, user_id, code_hash, attempts, locked_until, last_sent_at, verified_at, expires_at, created_at
+		FROM forgot_password
+		WHERE user_id=$1
+	`, userID).Scan(
+		&fp.ID, &fp.UserID, &fp.CodeHash, &fp.Attempts, &fp.LockedUntil,
+		&fp.LastSentAt, &fp.VerifiedAt, &fp.ExpiresAt, &fp.CreatedAt,
+	)
 	if err != nil {
 		return nil, err
 	}
 	return &fp, nil
 }
 
+// IssuePasswordResetOTP generates a new code for the user and stores its hash.
+// Every code gets a fresh row id, which reset tokens are bound to, so a token
+// from an earlier code can't be used once a new one is requested. It refuses
+// while the user is locked out or still inside the resend cooldown; the
+// returned record tells the caller how long to wait.
+func IssuePasswordResetOTP(db *pgxpool.Pool, otp *libs.OTPService, userID int64) (string, *ForgotPassword, error) {
+	existing, err := GetForgotPasswordByUser(db, userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return "", nil, err
+	}
+	if existing != nil {
+		if existing.LockedUntil != nil && time.Now().Before(*existing.LockedUntil) {
+			return "", existing, ErrOTPLocked
+		}
+		if existing.LastSentAt != nil && time.Since(*existing.LastSentAt) < otp.ResendCooldown {
+			return "", existing, ErrOTPCooldown
+		}
+	}
+
+	code, err := otp.Generate()
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, err = db.Exec(context.Background(), `
+		INSERT INTO forgot_password (user_id, code_hash, expires_at, attempts, last_sent_at, verified_at, locked_until)
+		VALUES ($1, $2, $3, 0, NOW(), NULL, NULL)
+		ON CONFLICT (user_id)
+		DO UPDATE SET id = DEFAULT,
+		              code_hash = EXCLUDED.code_hash,
+		              expires_at = EXCLUDED.expires_at,
+		              attempts = 0,
+		              last_sent_at = NOW(),
+		              verified_at = NULL,
+		              locked_until = NULL
+	`, userID, otp.Hash(userID, code), time.Now().Add(otp.TTL))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return code, nil, nil
+}
+
+// VerifyPasswordResetOTP checks code against the user's pending request. Every
+// try is counted before the code is compared, in one statement, so concurrent
+// guesses can't get past MaxAttempts; reaching it locks the request for
+// LockoutDuration.
+func VerifyPasswordResetOTP(db *pgxpool.Pool, otp *libs.OTPService, userID int64, code string) (*ForgotPassword, error) {
+	ctx := context.Background()
+
+	fp, err := GetForgotPasswordByUser(db, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrOTPInvalid
+		}
+		return nil, err
+	}
+
+	err = db.QueryRow(ctx, `
+		UPDATE forgot_password
+		SET attempts = attempts + 1,
+		    locked_until = CASE WHEN attempts + 1 >= $2 THEN $3 ELSE locked_until END
+		WHERE id=$1 AND attempts < $2 AND verified_at IS NULL
+		  AND (locked_until IS NULL OR locked_until <= NOW())
+		RETURNING code_hash, attempts, locked_until, expires_at
+	`, fp.ID, otp.MaxAttempts, time.Now().Add(otp.LockoutDuration)).Scan(&fp.CodeHash, &fp.Attempts, &fp.LockedUntil, &fp.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Locked, or out of attempts / already used. Once the lockout has
+		// passed the old code stays burned; a new one must be requested.
+		if fp, err = GetForgotPasswordByUser(db, userID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, ErrOTPInvalid
+			}
+			return nil, err
+		}
+		if fp.LockedUntil != nil && time.Now().Before(*fp.LockedUntil) {
+			return fp, ErrOTPLocked
+		}
+		return fp, ErrOTPExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !otp.Matches(userID, code, fp.CodeHash) {
+		if fp.Attempts >= otp.MaxAttempts {
+			return fp, ErrOTPLocked
+		}
+		return fp, ErrOTPInvalid
+	}
+
+	if time.Now().After(fp.ExpiresAt) {
+		return fp, ErrOTPExpired
+	}
+
+	// A correct code on the last try must not leave the request locked.
+	err = db.QueryRow(ctx, `
+		UPDATE forgot_password SET verified_at=NOW(), locked_until=NULL WHERE id=$1
+		RETURNING verified_at, locked_until
+	`, fp.ID).Scan(&fp.VerifiedAt, &fp.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	return fp, nil
+}
+
+// ResetPasswordWithOTP sets the password of the user behind the verified reset
+// request fpID and deletes the request in the same transaction, so each
+// request resets the password once. Returns ErrOTPInvalid when the request is
+// gone, not verified or belongs to someone else.
+func ResetPasswordWithOTP(db *pgxpool.Pool, fpID int, userID int64, hashedPassword string) error {
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	err = tx.QueryRow(ctx, `
+		DELETE FROM forgot_password
+		WHERE id=$1 AND user_id=$2 AND verified_at IS NOT NULL
+		RETURNING id
+	`, fpID, userID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrOTPInvalid
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET password=$1, updated_at=NOW() WHERE id=$2`, hashedPassword, userID)
+	if err != nil {
+		return err
+	}
+	if err := recordPasswordHistory(ctx, tx, userID, hashedPassword); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
 func DeleteForgotPassword(db *pgxpool.Pool, id int) error {
 	_, err := db.Exec(context.Background(), `DELETE FROM forgot_password WHERE id=$1`, id)
 	return err
@@ -0,0 +1,350 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrInsufficientStock  = errors.New("stock would drop below zero")
+	ErrStockReasonSign    = errors.New("restock and refund must add stock, waste must remove it")
+	ErrStockOrderNotFound = errors.New("order not found")
+	ErrStockSKUNotInOrder = errors.New("sku is not part of this order")
+)
+
+const (
+	StockReasonSale       = "sale"
+	StockReasonRestock    = "restock"
+	StockReasonAdjustment = "adjustment"
+	StockReasonRefund     = "refund"
+	StockReasonWaste      = "waste"
+)
+
+// StockMovement is one entry of the stock ledger. Quantity is signed and
+// Balance is the SKU stock right after the movement.
+type StockMovement struct {
+	ID            int64     `json:"id"`
+	ProductID     int64     `json:"productId"`
+	SkuID         int64     `json:"skuId"`
+	SizeName      *string   `json:"sizeName"`
+	VariantName   *string   `json:"variantName"`
+	Quantity      int       `json:"quantity"`
+	Balance       int       `json:"balance"`
+	Reason        string    `json:"reason"`
+	UserID        *int64    `json:"userId"`
+	UserFullname  *string   `json:"userFullname"`
+	TransactionID *int64    `json:"transactionId"`
+	InvoiceNumber *string   `json:"invoiceNumber"`
+	Note          *string   `json:"note"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// StockAdjustmentRequest changes the stock of one SKU by Quantity (negative
+// to remove stock). Sales are recorded by checkout only.
+type StockAdjustmentRequest struct {
+	SkuID         int64  `json:"skuId" validate:"required,gt=0"`
+	Quantity      int    `json:"quantity" validate:"required,ne=0"`
+	Reason        string `json:"reason" validate:"required,oneof=restock adjustment refund waste"`
+	TransactionID *int64 `json:"transactionId" validate:"omitempty,gt=0"`
+	Note          string `json:"note" validate:"max=255"`
+}
+
+type LowStockSKU struct {
+	SkuID       int64   `json:"skuId"`
+	ProductID   int64   `json:"productId"`
+	Title       string  `json:"title"`
+	SizeName    *string `json:"sizeName"`
+	VariantName *string `json:"variantName"`
+	Stock       int     `json:"stock"`
+}
+
+// stockChange says why a stock change happens and who or which order caused it.
+type stockChange struct {
+	reason        string
+	userID        *int64
+	transactionID *int64
+	note          string
+}
+
+// stockActor is the user recorded on a movement; requests without one (API
+// keys) record none.
+func stockActor(userID int64) *int64 {
+	if userID == 0 {
+		return nil
+	}
+	return &userID
+}
+
+// stockDB is satisfied by both *pgxpool.Pool and pgx.Tx.
+type stockDB interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// moveSKUStock adds quantity (negative to remove) to a SKU and records the
+// movement in the same statement. Returns ErrInsufficientStock when the stock
+// would go negative and pgx.ErrNoRows when the SKU doesn't exist.
+func moveSKUStock(ctx context.Context, q stockDB, skuID int64, quantity int, c stockChange) (int64, error) {
+	var movementID int64
+	err := q.QueryRow(ctx, `
+		WITH moved AS (
+			UPDATE product_skus SET stock = stock + $2::int, updated_at = NOW()
+			WHERE id = $1 AND stock + $2::int >= 0
+			RETURNING id, product_id, stock
+		)
+		INSERT INTO stock_movements (product_id, sku_id, quantity, balance, reason, user_id, transaction_id, note)
+		SELECT product_id, id, $2::int, stock, $3, $4, $5, NULLIF($6::text, '')
+		FROM moved
+		RETURNING id
+	`, skuID, quantity, c.reason, c.userID, c.transactionID, c.note).Scan(&movementID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var exists bool
+		if err := q.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM product_skus WHERE id=$1)`, skuID).Scan(&exists); err != nil {
+			return 0, err
+		}
+		if exists {
+			return 0, ErrInsufficientStock
+		}
+		return 0, pgx.ErrNoRows
+	}
+	return movementID, err
+}
+
+// setSKUStock sets a SKU to an absolute stock and records the difference as
+// a movement. Nothing is recorded when the stock doesn't change.
+func setSKUStock(ctx context.Context, q stockDB, skuID int64, stock int, c stockChange) error {
+	_, err := q.Exec(ctx, `
+		WITH cur AS (
+			SELECT id, stock FROM product_skus WHERE id = $1 FOR UPDATE
+		), moved AS (
+			UPDATE product_skus k SET stock = $2::int, updated_at = NOW()
+			FROM cur
+			WHERE k.id = cur.id AND cur.stock <> $2::int
+			RETURNING k.id, k.product_id, k.stock, k.stock - cur.stock AS quantity
+		)
+		INSERT INTO stock_movements (product_id, sku_id, quantity, balance, reason, user_id, transaction_id, note)
+		SELECT product_id, id, quantity, stock, $3, $4, $5, NULLIF($6::text, '')
+		FROM moved
+	`, skuID, stock, c.reason, c.userID, c.transactionID, c.note)
+	return err
+}
+
+// AdjustStock records a manual stock movement for a SKU. Returns pgx.ErrNoRows
+// when the SKU doesn't exist. A movement tied to an order must be for a SKU
+// that order sold.
+func AdjustStock(db *pgxpool.Pool, req StockAdjustmentRequest, userID int64) (StockMovement, error) {
+	ctx := context.Background()
+	var movement StockMovement
+
+	switch req.Reason {
+	case StockReasonRestock, StockReasonRefund:
+		if req.Quantity < 0 {
+			return movement, ErrStockReasonSign
+		}
+	case StockReasonWaste:
+		if req.Quantity > 0 {
+			return movement, ErrStockReasonSign
+		}
+	}
+
+	if req.TransactionID != nil {
+		var exists, sold bool
+		err := db.QueryRow(ctx, `
+			SELECT
+				EXISTS(SELECT 1 FROM transactions WHERE id=$1),
+				EXISTS(SELECT 1 FROM transaction_items WHERE transaction_id=$1 AND sku_id=$2)
+		`, *req.TransactionID, req.SkuID).Scan(&exists, &sold)
+		if err != nil {
+			return movement, err
+		}
+		if !exists {
+			return movement, ErrStockOrderNotFound
+		}
+		if !sold {
+			return movement, ErrStockSKUNotInOrder
+		}
+	}
+
+	id, err := moveSKUStock(ctx, db, req.SkuID, req.Quantity, stockChange{
+		reason:        req.Reason,
+		userID:        stockActor(userID),
+		transactionID: req.TransactionID,
+		note:          req.Note,
+	})
+	if err != nil {
+		return movement, err
+	}
+
+	movements, err := queryStockMovements(ctx, db, ` WHERE m.id = $1`, []any{id}, 1, 0)
+	if err != nil {
+		return movement, err
+	}
+	if len(movements) == 0 {
+		return movement, pgx.ErrNoRows
+	}
+	return movements[0], nil
+}
+
+// GetStockMovements lists the ledger of a product, newest first, optionally
+// narrowed to one SKU and/or reason.
+func GetStockMovements(db *pgxpool.Pool, productID int64, skuID int64, reason string, page, limit int) ([]StockMovement, int, error) {
+	ctx := context.Background()
+
+	where := ` WHERE m.product_id = $1`
+	params := []any{productID}
+	if skuID > 0 {
+		params = append(params, skuID)
+		where += ` AND m.sku_id = $` + strconv.Itoa(len(params))
+	}
+	if reason != "" {
+		params = append(params, reason)
+		where += ` AND m.reason = $` + strconv.Itoa(len(params))
+	}
+
+	var total int
+	if err := db.QueryRow(ctx, `SELECT COUNT(*) FROM stock_movements m`+where, params...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	movements, err := queryStockMovements(ctx, db, where, params, limit, (page-1)*limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	return movements, total, nil
+}
+
+func queryStockMovements(ctx context.Context, db *pgxpool.Pool, where string, params []any, limit, offset int) ([]StockMovement, error) {
+	query := `
+		SELECT m.id, m.product_id, m.sku_id, s.name, v.name, m.quantity, m.balance, m.reason,
+			m.user_id, u.fullname, m.transaction_id, t.invoice_number, m.note, m.created_at
+		FROM stock_movements m
+		JOIN product_skus k ON k.id = m.sku_id
+		LEFT JOIN sizes s ON s.id = k.size_id
+		LEFT JOIN variants v ON v.id = k.variant_id
+		LEFT JOIN users u ON u.id = m.user_id
+		LEFT JOIN transactions t ON t.id = m.transaction_id` + where + `
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT $` + strconv.Itoa(len(params)+1) + ` OFFSET $` + strconv.Itoa(len(params)+2)
+
+	rows, err := db.Query(ctx, query, append(params, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movements := []StockMovement{}
+	for rows.Next() {
+		var m StockMovement
+		if err := rows.Scan(
+			&m.ID, &m.ProductID, &m.SkuID, &m.SizeName, &m.VariantName, &m.Quantity, &m.Balance, &m.Reason,
+			&m.UserID, &m.UserFullname, &m.TransactionID, &m.InvoiceNumber, &m.Note, &m.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		movements = append(movements, m)
+	}
+	return movements, rows.Err()
+}
+
+const lowStockColumns = `k.id, k.product_id, COALESCE(p.title, ''),
+	(SELECT name FROM sizes WHERE id = k.size_id),
+	(SELECT name FROM variants WHERE id = k.variant_id),
+	k.stock`
+
+func scanLowStockSKUs(rows pgx.Rows) ([]LowStockSKU, error) {
+	defer rows.Close()
+
+	skus := []LowStockSKU{}
+	for rows.Next() {
+		var k LowStockSKU
+		if err := rows.Scan(&k.SkuID, &k.ProductID, &k.Title, &k.SizeName, &k.VariantName, &k.Stock); err != nil {
+			return nil, err
+		}
+		skus = append(skus, k)
+	}
+	return skus, rows.Err()
+}
+
+// GetLowStockSKUs lists the active SKUs of live products at or below threshold,
+// emptiest first.
+func GetLowStockSKUs(db *pgxpool.Pool, threshold int) ([]LowStockSKU, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT `+lowStockColumns+`
+		FROM product_skus k
+		JOIN products p ON p.id = k.product_id
+		WHERE k.is_active AND p.deleted_at IS NULL AND k.stock <= $1
+		ORDER BY k.stock, p.title, k.id
+	`, threshold)
+	if err != nil {
+		return nil, err
+	}
+	return scanLowStockSKUs(rows)
+}
+
+// GetUnalertedLowStockSKUs returns the low-stock SKUs that weren't reported
+// yet. SKUs restocked above threshold are unmarked first so their next drop
+// is reported again.
+func GetUnalertedLowStockSKUs(db *pgxpool.Pool, threshold int) ([]LowStockSKU, error) {
+	ctx := context.Background()
+
+	_, err := db.Exec(ctx, `
+		UPDATE product_skus SET low_stock_alerted_at = NULL
+		WHERE low_stock_alerted_at IS NOT NULL AND stock > $1
+	`, threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT `+lowStockColumns+`
+		FROM product_skus k
+		JOIN products p ON p.id = k.product_id
+		WHERE k.is_active AND p.deleted_at IS NULL
+			AND k.stock <= $1 AND k.low_stock_alerted_at IS NULL
+		ORDER BY k.stock, p.title, k.id
+	`, threshold)
+	if err != nil {
+		return nil, err
+	}
+	return scanLowStockSKUs(rows)
+}
+
+// MarkLowStockAlerted records that the low-stock alert for these SKUs was sent.
+func MarkLowStockAlerted(db *pgxpool.Pool, skuIDs []int64) error {
+	_, err := db.Exec(context.Background(), `UPDATE product_skus SET low_stock_alerted_at = NOW() WHERE id = ANY($1)`, skuIDs)
+	return err
+}
+
+// GetInventoryManagerEmails returns the emails of users allowed to adjust
+// stock, the default recipients of low-stock alerts.
+func GetInventoryManagerEmails(db *pgxpool.Pool) ([]string, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT DISTINCT u.email
+		FROM users u
+		JOIN roles r ON r.name = u.role
+		JOIN role_permissions rp ON rp.role_id = r.id
+		JOIN permissions perm ON perm.id = rp.permission_id
+		WHERE perm.name = 'inventory:adjust' AND u.anonymized_at IS NULL
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := []string{}
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	return emails, rows.Err()
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrInvitationNotPending = errors.New("invitation is no longer valid")
+
+type Invitation struct {
+	ID             int64      `json:"id"`
+	Email          string     `json:"email"`
+	Role           string     `json:"role"`
+	InvitedBy      *int64     `json:"invitedBy,omitempty"`
+	InvitedByName  *string    `json:"invitedByName,omitempty"`
+	AcceptedUserID *int64     `json:"acceptedUserId,omitempty"`
+	ExpiresAt      time.Time  `json:"expiresAt"`
+	AcceptedAt     *time.Time `json:"acceptedAt,omitempty"`
+	RevokedAt      *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	Status         string     `json:"status"`
+}
+
+type InvitationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"omitempty,oneof=admin manager barista"`
+}
+
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Fullname string `json:"fullname" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+func (inv *Invitation) setStatus() {
+	switch {
+	case inv.AcceptedAt != nil:
+		inv.Status = "accepted"
+	case inv.RevokedAt != nil:
+		inv.Status = "revoked"
+	case time.Now().After(inv.ExpiresAt):
+		inv.Status = "expired"
+	default:
+		inv.Status = "pending"
+	}
+}
+
+const invitationColumns = `
+	i.id, i.email, i.role, i.invited_by, u.fullname, i.accepted_user_id,
+	i.expires_at, i.accepted_at, i.revoked_at, i.created_at
+`
+
+func scanInvitation(row interface{ Scan(...any) error }) (Invitation, error) {
+	var inv Invitation
+	err := row.Scan(
+		&inv.ID, &inv.Email, &inv.Role, &inv.InvitedBy, &inv.InvitedByName, &inv.AcceptedUserID,
+		&inv.ExpiresAt, &inv.AcceptedAt, &inv.RevokedAt, &inv.CreatedAt,
+	)
+	if err != nil {
+		return Invitation{}, err
+	}
+	inv.setStatus()
+	return inv, nil
+}
+
+// CreateInvitation stores a new invitation and revokes any invitation still
+// pending for the same email, so only the latest link works.
+func CreateInvitation(db *pgxpool.Pool, email, role string, invitedBy int64, tokenHash string, expiresAt time.Time) (Invitation, error) {
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return Invitation{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE admin_invitations
+		SET revoked_at=NOW()
+		WHERE LOWER(email)=LOWER($1) AND accepted_at IS NULL AND revoked_at IS NULL
+	`, email)
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	var id int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO admin_invitations (email, role, token_hash, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, email, role, tokenHash, invitedBy, expiresAt).Scan(&id)
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	inv, err := scanInvitation(tx.QueryRow(ctx, `
+		SELECT `+invitationColumns+`
+		FROM admin_invitations i
+		LEFT JOIN users u ON u.id = i.invited_by
+		WHERE i.id=$1
+	`, id))
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	return inv, tx.Commit(ctx)
+}
+
+func GetInvitations(db *pgxpool.Pool) ([]Invitation, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT `+invitationColumns+`
+		FROM admin_invitations i
+		LEFT JOIN users u ON u.id = i.invited_by
+		ORDER BY i.created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, nil
+}
+
+func GetInvitationByTokenHash(db *pgxpool.Pool, tokenHash string) (Invitation, error) {
+	return scanInvitation(db.QueryRow(context.Background(), `
+		SELECT `+invitationColumns+`
+		FROM admin_invitations i
+		LEFT JOIN users u ON u.id = i.invited_by
+		WHERE i.token_hash=$1
+	`, tokenHash))
+}
+
+func RevokeInvitation(db *pgxpool.Pool, id int64) error {
+	res, err := db.Exec(context.Background(), `
+		UPDATE admin_invitations
+		SET revoked_at=NOW()
+		WHERE id=$1 AND accepted_at IS NULL AND revoked_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return ErrInvitationNotPending
+	}
+	return nil
+}
+
+// AcceptInvitation creates the invited account and consumes the invitation in
+// one transaction, so a link can never create two accounts. The invite link
+// already proved the mailbox, so the email starts out verified.
+func AcceptInvitation(db *pgxpool.Pool, inv Invitation, fullname, hashedPassword string) (UserResponse, error) {
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return UserResponse{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var user UserResponse
+	err = tx.QueryRow(ctx, `
+		INSERT INTO users (fullname, email, password, role, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW(), NOW())
+		RETURNING id, fullname, email, role, email_verified_at, created_at, updated_at
+	`, fullname, inv.Email, hashedPassword, inv.Role).Scan(
+		&user.ID, &user.Fullname, &user.Email, &user.Role, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return UserResponse{}, errors.New("email already registered")
+		}
+		return UserResponse{}, err
+	}
+
+	if err := recordPasswordHistory(ctx, tx, user.ID, hashedPassword); err != nil {
+		return UserResponse{}, err
+	}
+
+	res, err := tx.Exec(ctx, `
+		UPDATE admin_invitations
+		SET accepted_at=NOW(), accepted_user_id=$1
+		WHERE id=$2 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+	`, user.ID, inv.ID)
+	if err != nil {
+		return UserResponse{}, err
+	}
+	if res.RowsAffected() == 0 {
+		return UserResponse{}, ErrInvitationNotPending
+	}
+
+	return user, tx.Commit(ctx)
+}
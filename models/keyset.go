@@ -0,0 +1,121 @@
+package models
+
+import (
+	"coffeeder-backend/libs"
+	"fmt"
+)
+
+// Keyset pages a listing by (sort key, id) instead of OFFSET, so rows added or
+// removed meanwhile don't shift pages. Listings call SetSortKey with the SQL
+// for the requested sort, add Where and OrderBy to their query, fetch Limit+1
+// rows selecting KeyColumn and the id, and pass them through KeysetPage.
+type Keyset struct {
+	Sort   string
+	Desc   bool
+	Limit  int
+	Cursor *libs.Cursor
+
+	// Filled in by KeysetPage.
+	Next *libs.Cursor
+	Prev *libs.Cursor
+
+	expr    string
+	sqlType string
+	idCol   string
+}
+
+type KeysetKey struct {
+	Key string
+	ID  int64
+}
+
+// NewKeyset starts cursor mode. An empty token is the first page; otherwise
+// the token must have been issued for the same sort and direction. It fails
+// with libs.ErrMissingCursorSecret when cursors cannot be signed.
+func NewKeyset(token, sort string, desc bool, limit int) (*Keyset, error) {
+	if err := libs.CheckCursorSecret(); err != nil {
+		return nil, err
+	}
+	k := &Keyset{Sort: sort, Desc: desc, Limit: limit}
+	if token != "" {
+		c, err := libs.DecodeCursor(token, sort, desc)
+		if err != nil {
+			return nil, err
+		}
+		k.Cursor = c
+	}
+	return k, nil
+}
+
+// SetSortKey sets the SQL sort key. expr must never be NULL (wrap nullable
+// columns in COALESCE) and compare correctly as sqlType; idCol breaks ties.
+func (k *Keyset) SetSortKey(expr, sqlType, idCol string) {
+	k.expr, k.sqlType, k.idCol = expr, sqlType, idCol
+}
+
+func (k *Keyset) backward() bool {
+	return k.Cursor != nil && k.Cursor.Prev
+}
+
+// Where returns the " AND ..." condition that starts after the cursor, using
+// placeholders $idx and $idx+1.
+func (k *Keyset) Where(idx int) (string, []interface{}) {
+	if k.Cursor == nil {
+		return "", nil
+	}
+	op := ">"
+	if k.Desc != k.backward() {
+		op = "<"
+	}
+	return fmt.Sprintf(" AND (%s, %s) %s ($%d::%s, $%d)", k.expr, k.idCol, op, idx, k.sqlType, idx+1),
+		[]interface{}{k.Cursor.Key, k.Cursor.ID}
+}
+
+// OrderBy walks towards the cursor's side; backward pages are read in reverse
+// and flipped back by KeysetPage.
+func (k *Keyset) OrderBy() string {
+	dir := "ASC"
+	if k.Desc != k.backward() {
+		dir = "DESC"
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, %s %s", k.expr, dir, k.idCol, dir)
+}
+
+// KeyColumn is the sort key as text, to be selected and stored in cursors.
+func (k *Keyset) KeyColumn() string {
+	return "(" + k.expr + ")::text"
+}
+
+// KeysetPage drops the extra row fetched to detect another page, restores
+// display order and sets k.Next and k.Prev.
+func KeysetPage[T any](k *Keyset, items []T, keys []KeysetKey) []T {
+	more := len(items) > k.Limit
+	if more {
+		items, keys = items[:k.Limit], keys[:k.Limit]
+	}
+	if k.backward() {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+	}
+
+	k.Next, k.Prev = nil, nil
+	if len(items) == 0 {
+		return items
+	}
+
+	hasNext, hasPrev := more, k.Cursor != nil
+	if k.backward() {
+		hasNext, hasPrev = true, more
+	}
+	if hasNext {
+		last := keys[len(keys)-1]
+		k.Next = &libs.Cursor{Sort: k.Sort, Desc: k.Desc, Key: last.Key, ID: last.ID}
+	}
+	if hasPrev {
+		first := keys[0]
+		k.Prev = &libs.Cursor{Sort: k.Sort, Desc: k.Desc, Key: first.Key, ID: first.ID, Prev: true}
+	}
+	return items
+}
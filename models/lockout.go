@@ -0,0 +1,138 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type LoginLockout struct {
+	Email        string     `json:"email"`
+	FailedCount  int        `json:"failedCount"`
+	LastFailedIP *string    `json:"lastFailedIp,omitempty"`
+	LastFailedAt *time.Time `json:"lastFailedAt,omitempty"`
+	LockedUntil  *time.Time `json:"lockedUntil,omitempty"`
+	Locked       bool       `json:"locked"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+func (l *LoginLockout) IsLocked() bool {
+	return l.LockedUntil != nil && time.Now().Before(*l.LockedUntil)
+}
+
+func scanLoginLockout(row interface{ Scan(...any) error }) (LoginLockout, error) {
+	var l LoginLockout
+	err := row.Scan(&l.Email, &l.FailedCount, &l.LastFailedIP, &l.LastFailedAt, &l.LockedUntil, &l.UpdatedAt)
+	if err != nil {
+		return LoginLockout{}, err
+	}
+	l.Locked = l.IsLocked()
+	return l, nil
+}
+
+// GetLoginLockout returns nil when the email has no failed attempts recorded.
+func GetLoginLockout(db *pgxpool.Pool, email string) (*LoginLockout, error) {
+	l, err := scanLoginLockout(db.QueryRow(context.Background(), `
+		SELECT email, failed_count, last_failed_ip, last_failed_at, locked_until, updated_at
+		FROM login_lockouts
+		WHERE email=$1
+	`, strings.ToLower(email)))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &l, nil
+}
+
+// RecordFailedLogin counts a failed attempt. Failures older than window, or
+// from before an expired lock, start a fresh count. Once the count reaches
+// maxFailed the account is locked for lockout; newlyLocked is only true for
+// the attempt that triggered the lock.
+func RecordFailedLogin(db *pgxpool.Pool, email, ip string, maxFailed int, window, lockout time.Duration) (l LoginLockout, newlyLocked bool, err error) {
+	ctx := context.Background()
+	email = strings.ToLower(email)
+	now := time.Now()
+
+	l, err = scanLoginLockout(db.QueryRow(ctx, `
+		INSERT INTO login_lockouts (email, failed_count, last_failed_ip, last_failed_at, updated_at)
+		VALUES ($1, 1, $2, $3, $3)
+		ON CONFLICT (email) DO UPDATE SET
+			failed_count = CASE
+				WHEN login_lockouts.locked_until IS NOT NULL AND login_lockouts.locked_until <= $3 THEN 1
+				WHEN login_lockouts.locked_until IS NULL AND login_lockouts.last_failed_at < $4 THEN 1
+				ELSE login_lockouts.failed_count + 1
+			END,
+			locked_until = CASE
+				WHEN login_lockouts.locked_until IS NOT NULL AND login_lockouts.locked_until <= $3 THEN NULL
+				ELSE login_lockouts.locked_until
+			END,
+			last_failed_ip = EXCLUDED.last_failed_ip,
+			last_failed_at = EXCLUDED.last_failed_at,
+			updated_at = EXCLUDED.updated_at
+		RETURNING email, failed_count, last_failed_ip, last_failed_at, locked_until, updated_at
+	`, email, ip, now, now.Add(-window)))
+	if err != nil {
+		return LoginLockout{}, false, err
+	}
+
+	if l.FailedCount < maxFailed || l.LockedUntil != nil {
+		return l, false, nil
+	}
+
+	res, err := db.Exec(ctx, `
+		UPDATE login_lockouts
+		SET locked_until=$2, updated_at=NOW()
+		WHERE email=$1 AND locked_until IS NULL
+	`, email, now.Add(lockout))
+	if err != nil {
+		return l, false, err
+	}
+	if res.RowsAffected() == 0 {
+		return l, false, nil
+	}
+
+	lockedUntil := now.Add(lockout)
+	l.LockedUntil = &lockedUntil
+	l.Locked = true
+	return l, true, nil
+}
+
+func ClearLoginLockout(db *pgxpool.Pool, email string) (bool, error) {
+	res, err := db.Exec(context.Background(), `
+		DELETE FROM login_lockouts WHERE email=$1
+	`, strings.ToLower(email))
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+// GetLoginLockouts lists accounts with recorded failures, locked ones first.
+func GetLoginLockouts(db *pgxpool.Pool, lockedOnly bool) ([]LoginLockout, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT email, failed_count, last_failed_ip, last_failed_at, locked_until, updated_at
+		FROM login_lockouts
+		WHERE NOT $1 OR locked_until > NOW()
+		ORDER BY (locked_until > NOW()) DESC NULLS LAST, updated_at DESC
+	`, lockedOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lockouts := []LoginLockout{}
+	for rows.Next() {
+		l, err := scanLoginLockout(rows)
+		if err != nil {
+			return nil, err
+		}
+		lockouts = append(lockouts, l)
+	}
+	return lockouts, nil
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrMagicLinkInvalid  = errors.New("magic link is invalid, expired or already used")
+	ErrMagicLinkMismatch = errors.New("magic link was requested from another device")
+)
+
+type MagicLinkRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	DeviceID string `json:"deviceId" validate:"omitempty,max=128"`
+}
+
+type MagicLinkConsumeRequest struct {
+	Token    string `json:"token" validate:"required"`
+	DeviceID string `json:"deviceId" validate:"omitempty,max=128"`
+}
+
+func CreateMagicLink(db *pgxpool.Pool, userID int64, tokenHash, fingerprint, ip string, expiresAt time.Time) error {
+	_, err := db.Exec(context.Background(), `
+		INSERT INTO magic_links (user_id, token_hash, fingerprint, ip, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, userID, tokenHash, fingerprint, ip, expiresAt)
+	return err
+}
+
+// ConsumeMagicLink marks the link used and returns its user. A link opened on
+// a different device is rejected but left unused, so the right device can
+// still open it.
+func ConsumeMagicLink(db *pgxpool.Pool, tokenHash, fingerprint string) (int64, error) {
+	ctx := context.Background()
+
+	var stored string
+	err := db.QueryRow(ctx, `
+		SELECT fingerprint FROM magic_links
+		WHERE token_hash=$1 AND consumed_at IS NULL AND expires_at > NOW()
+	`, tokenHash).Scan(&stored)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrMagicLinkInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(fingerprint)) != 1 {
+		return 0, ErrMagicLinkMismatch
+	}
+
+	var userID int64
+	err = db.QueryRow(ctx, `
+		UPDATE magic_links SET consumed_at=NOW()
+		WHERE token_hash=$1 AND consumed_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`, tokenHash).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrMagicLinkInvalid
+	}
+	return userID, err
+}
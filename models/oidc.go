@@ -0,0 +1,105 @@
+package models
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrOIDCStateInvalid = errors.New("oidc state is invalid, expired or already used")
+
+type OIDCStartResponse struct {
+	AuthorizationURL string `json:"authorizationUrl"`
+	State            string `json:"state"`
+}
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+type OIDCLoginState struct {
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+}
+
+// CreateOIDCLoginState stores a pending authorization request. nonce and
+// codeVerifier must already be encrypted.
+func CreateOIDCLoginState(db *pgxpool.Pool, provider, stateHash, nonce, codeVerifier, fingerprint string, expiresAt time.Time) error {
+	_, err := db.Exec(context.Background(), `
+		INSERT INTO oidc_login_states (provider, state_hash, nonce, code_verifier, fingerprint, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, provider, stateHash, nonce, codeVerifier, fingerprint, expiresAt)
+	return err
+}
+
+// ConsumeOIDCLoginState marks the state used and returns it. The state must
+// belong to provider and to the browser that started the login.
+func ConsumeOIDCLoginState(db *pgxpool.Pool, provider, stateHash, fingerprint string) (*OIDCLoginState, error) {
+	var st OIDCLoginState
+	var storedFingerprint string
+	err := db.QueryRow(context.Background(), `
+		UPDATE oidc_login_states SET consumed_at=NOW()
+		WHERE state_hash=$1 AND provider=$2 AND consumed_at IS NULL AND expires_at > NOW()
+		RETURNING provider, nonce, code_verifier, fingerprint
+	`, stateHash, provider).Scan(&st.Provider, &st.Nonce, &st.CodeVerifier, &storedFingerprint)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrOIDCStateInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(storedFingerprint), []byte(fingerprint)) != 1 {
+		return nil, ErrOIDCStateInvalid
+	}
+	return &st, nil
+}
+
+// FindUserByEmail looks the email up case-insensitively and returns nil when
+// no user has it.
+func FindUserByEmail(db *pgxpool.Pool, email string) (*UserResponse, error) {
+	var userID int64
+	err := db.QueryRow(context.Background(), `
+		SELECT id FROM users WHERE LOWER(email)=LOWER($1)
+	`, email).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return GetUserByID(db, userID)
+}
+
+// GetUserByIdentity returns the user linked to the provider account, or nil
+// when there is none.
+func GetUserByIdentity(db *pgxpool.Pool, provider, subject string) (*UserResponse, error) {
+	var userID int64
+	err := db.QueryRow(context.Background(), `
+		SELECT user_id FROM user_identities WHERE provider=$1 AND subject=$2
+	`, provider, subject).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return GetUserByID(db, userID)
+}
+
+// LinkIdentity links the provider account to the user, or records the login
+// when it is already linked.
+func LinkIdentity(db *pgxpool.Pool, userID int64, provider, subject, email string) error {
+	_, err := db.Exec(context.Background(), `
+		INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NOW())
+		ON CONFLICT (provider, subject)
+		DO UPDATE SET email=EXCLUDED.email, last_login_at=NOW()
+	`, userID, provider, subject, email)
+	return err
+}
@@ -34,7 +34,8 @@ type Transaction struct {
 	OrderItems    []TransactionItem `json:"orderItems"`
 }
 
-func GetAllTransactions(db *pgxpool.Pool, search, sort, order string, limit, offset int) ([]Transaction, error) {
+// GetAllTransactions pages with limit/offset, or by keyset when ks is set.
+func GetAllTransactions(db *pgxpool.Pool, search, sort, order string, limit, offset int, ks *Keyset) ([]Transaction, error) {
 	queriParams := make([]interface{}, 0)
 	argIdx := 1
 
@@ -46,18 +47,32 @@ func GetAllTransactions(db *pgxpool.Pool, search, sort, order string, limit, off
 		order = "desc"
 	}
 
+	keyColumn := "''"
+	if ks != nil {
+		switch sort {
+		case "total":
+			ks.SetSortKey("t.total", "numeric", "t.id")
+		case "invoice_number":
+			ks.SetSortKey("t.invoice_number", "text", "t.id")
+		default:
+			ks.SetSortKey("COALESCE(t.created_at, 'epoch'::timestamp)", "timestamp", "t.id")
+		}
+		keyColumn = ks.KeyColumn()
+	}
+
 	query := `
         SELECT 
     t.id,
     t.invoice_number AS no_orders,
     t.created_at,
     t.status AS status_name,
-    u.fullname AS user_fullname,
+    COALESCE(u.fullname, '') AS user_fullname,
     t.address AS user_address,
     t.phone AS user_phone,
     pm.name AS payment_method,
     sh.name AS shipping_name,
-    t.total
+    t.total,
+    ` + keyColumn + `
 FROM transactions t
 LEFT JOIN users u ON u.id = t.user_id
 LEFT JOIN payment_methods pm ON pm.id = t.payment_method_id
@@ -72,10 +87,23 @@ WHERE 1=1
 		argIdx++
 	}
 
+	if ks != nil {
+		keyWhere, keyArgs := ks.Where(argIdx)
+		query += keyWhere
+		queriParams = append(queriParams, keyArgs...)
+		argIdx += len(keyArgs)
+	}
+
 	query += " GROUP BY t.id, u.fullname, t.address, t.phone, pm.name, sh.name"
-	query += " ORDER BY " + sort + " " + order
-	query += " LIMIT $" + strconv.Itoa(argIdx) + " OFFSET $" + strconv.Itoa(argIdx+1)
-	queriParams = append(queriParams, limit, offset)
+	if ks != nil {
+		query += ks.OrderBy()
+		query += " LIMIT $" + strconv.Itoa(argIdx)
+		queriParams = append(queriParams, ks.Limit+1)
+	} else {
+		query += " ORDER BY " + sort + " " + order
+		query += " LIMIT $" + strconv.Itoa(argIdx) + " OFFSET $" + strconv.Itoa(argIdx+1)
+		queriParams = append(queriParams, limit, offset)
+	}
 
 	rows, err := db.Query(context.Background(), query, queriParams...)
 	if err != nil {
@@ -84,15 +112,18 @@ WHERE 1=1
 	defer rows.Close()
 
 	var transactions []Transaction
+	var keys []KeysetKey
 
 	for rows.Next() {
 		var t Transaction
+		var cursorKey string
 		t.OrderItems = make([]TransactionItem, 0)
 
 		if err := rows.Scan(
 			&t.ID, &t.NoOrders, &t.CreatedAt, &t.StatusName,
 			&t.UserFullname, &t.UserAddress, &t.UserPhone,
 			&t.PaymentMethod, &t.ShippingName, &t.Total,
+			&cursorKey,
 		); err != nil {
 			fmt.Println("Scan transaction error:", err)
 			continue
@@ -147,6 +178,11 @@ WHERE 1=1
 		itemRows.Close()
 
 		transactions = append(transactions, t)
+		keys = append(keys, KeysetKey{Key: cursorKey, ID: t.ID})
+	}
+
+	if ks != nil {
+		transactions = KeysetPage(ks, transactions, keys)
 	}
 
 	return transactions, nil
@@ -162,7 +198,7 @@ func GetTransactionByID(db *pgxpool.Pool, id string) (Transaction, error) {
     t.invoice_number AS no_orders,
     t.created_at,
     t.status AS status_name,
-    u.fullname AS user_fullname,
+    COALESCE(u.fullname, '') AS user_fullname,
     t.address AS user_address,
     t.phone AS user_phone,
     pm.name AS payment_method,
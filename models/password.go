@@ -0,0 +1,80 @@
+package models
+
+import (
+	"coffeeder-backend/libs"
+	"context"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// execer is satisfied by both *pgxpool.Pool and pgx.Tx.
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// recordPasswordHistory stores hashedPassword as the user's latest password
+// and drops entries older than the PASSWORD_HISTORY most recent ones.
+func recordPasswordHistory(ctx context.Context, db execer, userID int64, hashedPassword string) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO password_history (user_id, password_hash)
+		VALUES ($1, $2)
+	`, userID, hashedPassword)
+	if err != nil {
+		return err
+	}
+
+	keep := libs.LoadPasswordPolicy().HistorySize
+	if keep < 1 {
+		keep = 1
+	}
+	_, err = db.Exec(ctx, `
+		DELETE FROM password_history
+		WHERE user_id=$1 AND id NOT IN (
+			SELECT id FROM password_history
+			WHERE user_id=$1
+			ORDER BY created_at DESC, id DESC
+			LIMIT $2
+		)
+	`, userID, keep)
+	return err
+}
+
+// IsPasswordReused reports whether password matches one of the user's last
+// PASSWORD_HISTORY passwords, including the current one.
+func IsPasswordReused(db *pgxpool.Pool, userID int64, password string) (bool, error) {
+	limit := libs.LoadPasswordPolicy().HistorySize
+	if limit < 1 {
+		return false, nil
+	}
+
+	rows, err := db.Query(context.Background(), `
+		SELECT password_hash FROM password_history
+		WHERE user_id=$1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	hashes := []string{}
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return false, err
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	for _, hash := range hashes {
+		if ok, _ := libs.VerifyPassword(password, hash); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
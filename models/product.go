@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"log"
 	"mime/multipart"
+	"sort"
 	"strconv"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -32,19 +34,23 @@ type SizeObj struct {
 	Name string `json:"name"`
 }
 
+
 type ProductResponse struct {
-	ID          int64           `json:"id"`
-	Title       string          `json:"title"`
-	Description string          `json:"description"`
-	BasePrice   float64         `json:"basePrice"`
-	Stock       int             `json:"stock"`
-	Category    CategoryProduct `json:"category"`
-	Variants    []Variant       `json:"variants"`
-	CreatedAt   time.Time       `json:"createdAt"`
-	UpdatedAt   time.Time       `json:"updatedAt"`
-	Images      []ProductImage  `json:"images,omitempty"`
-	Sizes       []Size          `json:"sizes,omitempty"`
-	IsFlashSale bool            `json:"isFlashSale"`
+	ID          int64             `json:"id"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	BasePrice   float64           `json:"basePrice"`
+	Stock       int               `json:"stock"`
+	Category    CategoryProduct   `json:"category"`
+	Variants    []Variant         `json:"variants"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+	Images      []ProductImage    `json:"images,omitempty"`
+	Sizes       []Size            `json:"sizes,omitempty"`
+	IsFlashSale bool              `json:"isFlashSale"`
+	SKUs        []ProductSKU      `json:"skus,omitempty"`
+	Rank        float64           `json:"rank,omitempty"`
+	Highlight   *ProductHighlight `json:"highlight,omitempty"`
 }
 
 type ProductResponseFilter struct {
@@ -59,6 +65,8 @@ type ProductResponseFilter struct {
 	Variants    []map[string]interface{} `json:"variants"`
 	CreatedAt   time.Time                `json:"createdAt"`
 	UpdatedAt   time.Time                `json:"updatedAt"`
+	Rank        float64                  `json:"rank,omitempty"`
+	Highlight   *ProductHighlight        `json:"highlight,omitempty"`
 }
 
 type CategoryProduct struct {
@@ -94,14 +102,22 @@ type ProductRequest struct {
 	VariantID   []int64                 `form:"variantId"`
 	Sizes       []int64                 `form:"sizes"`
 	Images      []*multipart.FileHeader `form:"images" validate:"required,min=1"`
+	SKUs        []SKURequest            `form:"-" validate:"dive"`
 }
 
+
 type ProductFilter struct {
-	Categories []int64  `json:"categories" form:"categories"`
-	IsFavorite *bool    `json:"isFavorite" form:"isFavorite"`
-	SortBy     string   `json:"sortby" form:"sortby"`
-	PriceMin   *float64 `json:"priceMin" form:"priceMin"`
-	PriceMax   *float64 `json:"priceMax" form:"priceMax"`
+	Categories []int64        `json:"categories" form:"categories"`
+	IsFavorite *bool          `json:"isFavorite" form:"isFavorite"`
+	SortBy     string         `json:"sortby" form:"sortby"`
+	PriceMin   *float64       `json:"priceMin" form:"priceMin"`
+	PriceMax   *float64       `json:"priceMax" form:"priceMax"`
+	Sizes      []int64        `json:"sizes" form:"sizes"`
+	Variants   []int64        `json:"variants" form:"variants"`
+	InStock    *bool          `json:"inStock" form:"inStock"`
+	OnPromo    *bool          `json:"onPromo" form:"onPromo"`
+	MinRating  *float64       `json:"minRating" form:"minRating"`
+	Search     *ProductSearch `json:"-" form:"-"`
 }
 
 type ProductListResponse struct {
@@ -110,9 +126,10 @@ type ProductListResponse struct {
 	Pagination interface{} `json:"pagination"`
 	Links      interface{} `json:"links"`
 	Data       interface{} `json:"data"`
+	Facets     interface{} `json:"facets,omitempty"`
 }
 
-func CreateProduct(db *pgxpool.Pool, req ProductRequest, imageFiles []string) (ProductResponse, error) {
+func CreateProduct(db *pgxpool.Pool, req ProductRequest, imageFiles []string, userID int64) (ProductResponse, error) {
 	ctx := context.Background()
 	var product ProductResponse
 
@@ -124,13 +141,24 @@ func CreateProduct(db *pgxpool.Pool, req ProductRequest, imageFiles []string) (P
 	if exists {
 		return product, fmt.Errorf("product with title '%s' already exists", req.Title)
 	}
+	if err := ValidateSKURequests(req.Sizes, req.VariantID, req.SKUs); err != nil {
+		return product, err
+	}
+
+	// The product, its options, SKUs and their opening stock movements are
+	// created together or not at all.
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return product, err
+	}
+	defer tx.Rollback(ctx)
 
 	insertQuery := `
         INSERT INTO products (title, description, base_price, stock, category_id)
         VALUES ($1, $2, $3, $4, $5)
         RETURNING id, created_at, updated_at
     `
-	err = db.QueryRow(ctx, insertQuery,
+	err = tx.QueryRow(ctx, insertQuery,
 		req.Title,
 		req.Description,
 		req.BasePrice,
@@ -146,7 +174,7 @@ func CreateProduct(db *pgxpool.Pool, req ProductRequest, imageFiles []string) (P
 	product.BasePrice = req.BasePrice
 	product.Stock = req.Stock
 
-	err = db.QueryRow(ctx, `SELECT id, name FROM categories WHERE id=$1`, req.CategoryID).
+	err = tx.QueryRow(ctx, `SELECT id, name FROM categories WHERE id=$1`, req.CategoryID).
 		Scan(&product.Category.ID, &product.Category.Name)
 	if err != nil {
 		return product, err
@@ -155,7 +183,7 @@ func CreateProduct(db *pgxpool.Pool, req ProductRequest, imageFiles []string) (P
 	if len(req.VariantID) > 0 {
 
 		for _, vID := range req.VariantID {
-			_, err := db.Exec(ctx,
+			_, err := tx.Exec(ctx,
 				`INSERT INTO product_variants (product_id, variant_id) VALUES ($1, $2)`,
 				product.ID, vID,
 			)
@@ -164,7 +192,7 @@ func CreateProduct(db *pgxpool.Pool, req ProductRequest, imageFiles []string) (P
 			}
 		}
 
-		rows, err := db.Query(ctx,
+		rows, err := tx.Query(ctx,
 			`SELECT id, name, additional_price FROM variants WHERE id = ANY($1)`, req.VariantID)
 		if err != nil {
 			return product, err
@@ -181,7 +209,7 @@ func CreateProduct(db *pgxpool.Pool, req ProductRequest, imageFiles []string) (P
 
 	if len(req.Sizes) > 0 {
 		for _, sizeID := range req.Sizes {
-			_, err := db.Exec(ctx,
+			_, err := tx.Exec(ctx,
 				`INSERT INTO product_sizes (product_id, size_id) VALUES ($1, $2)`,
 				product.ID, sizeID,
 			)
@@ -190,7 +218,7 @@ func CreateProduct(db *pgxpool.Pool, req ProductRequest, imageFiles []string) (P
 			}
 
 			var s Size
-			err = db.QueryRow(ctx,
+			err = tx.QueryRow(ctx,
 				`SELECT id, name, additional_price FROM sizes WHERE id=$1`,
 				sizeID,
 			).Scan(&s.ID, &s.Name, &s.AdditionalPrice)
@@ -201,7 +229,7 @@ func CreateProduct(db *pgxpool.Pool, req ProductRequest, imageFiles []string) (P
 	}
 
 	for _, filename := range imageFiles {
-		_, err := db.Exec(ctx,
+		_, err := tx.Exec(ctx,
 			`INSERT INTO product_images (product_id, image, updated_at) VALUES ($1, $2, NOW())`,
 			product.ID, filename,
 		)
@@ -216,15 +244,53 @@ func CreateProduct(db *pgxpool.Pool, req ProductRequest, imageFiles []string) (P
 		})
 	}
 
+	if err := syncProductSKUs(ctx, tx, product.ID); err != nil {
+		return product, err
+	}
+	initial := stockChange{reason: StockReasonRestock, userID: stockActor(userID), note: "Initial stock"}
+	if len(req.SKUs) > 0 {
+		err = applySKURequests(ctx, tx, product.ID, req.SKUs, initial)
+	} else {
+		err = spreadProductStock(ctx, tx, product.ID, req.Stock, initial)
+	}
+	if err != nil {
+		return product, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return product, err
+	}
+	if err := loadProductSKUs(db, &product); err != nil {
+		return product, err
+	}
+
 	return product, nil
 }
 
-func GetProducts(db *pgxpool.Pool, page, limit int, search, sortBy, order string) ([]ProductResponse, int, error) {
+// loadProductSKUs fills in all SKUs of the product and the stock total the
+// SKU trigger keeps on products.
+func loadProductSKUs(db *pgxpool.Pool, p *ProductResponse) error {
+	skus, err := GetProductSKUs(db, p.ID, false)
+	if err != nil {
+		return err
+	}
+	p.SKUs = skus
+	p.Stock = 0
+	for _, k := range skus {
+		if k.IsActive {
+			p.Stock += k.Stock
+		}
+	}
+	return nil
+}
+
+// GetProducts pages with OFFSET, or by keyset when ks is set (then the
+// returned total is 0 and ks.Next/ks.Prev hold the neighbouring pages).
+func GetProducts(db *pgxpool.Pool, page, limit int, search, sortBy, order string, ks *Keyset) ([]ProductResponse, int, error) {
 	ctx := context.Background()
 	offset := (page - 1) * limit
 
 	allowedSortFields := map[string]bool{
-		"id": true, "title": true, "base_price": true, "created_at": true,
+		"id": true, "title": true, "base_price": true, "created_at": true, "relevance": true,
 	}
 	if !allowedSortFields[sortBy] {
 		sortBy = "created_at"
@@ -234,19 +300,48 @@ func GetProducts(db *pgxpool.Pool, page, limit int, search, sortBy, order string
 		order = "ASC"
 	}
 
-	totalQuery := "SELECT COUNT(*) FROM products p"
+	ps := NewProductSearch(search)
+	if ps == nil && sortBy == "relevance" {
+		sortBy = "created_at"
+	}
+
+	where := " WHERE p.deleted_at IS NULL"
+	rankExpr := "0::float8"
 	args := []interface{}{}
 	argIndex := 1
 
-	if search != "" {
-		totalQuery += fmt.Sprintf(" WHERE LOWER(p.title) LIKE LOWER($%d) OR LOWER(p.description) LIKE LOWER($%d)", argIndex, argIndex+1)
-		args = append(args, "%"+search+"%", "%"+search+"%")
-		argIndex += 2
+	if ps != nil {
+		cond, rank, searchArgs := ps.Condition(argIndex)
+		where += " AND " + cond
+		rankExpr = rank
+		args = append(args, searchArgs...)
+		argIndex += len(searchArgs)
 	}
 
 	var total int
-	if err := db.QueryRow(ctx, totalQuery, args...).Scan(&total); err != nil {
-		return nil, 0, err
+	keyColumn := "''"
+	if ks == nil {
+		if err := db.QueryRow(ctx, "SELECT COUNT(*) FROM products p"+where, args...).Scan(&total); err != nil {
+			return nil, 0, err
+		}
+	} else {
+		switch sortBy {
+		case "id":
+			ks.SetSortKey("p.id", "bigint", "p.id")
+		case "title":
+			ks.SetSortKey("COALESCE(p.title, '')", "text", "p.id")
+		case "base_price":
+			ks.SetSortKey("COALESCE(p.base_price, 0)", "numeric", "p.id")
+		case "relevance":
+			ks.SetSortKey(rankExpr, "float8", "p.id")
+		default:
+			ks.SetSortKey("COALESCE(p.created_at, 'epoch'::timestamp)", "timestamp", "p.id")
+		}
+		keyWhere, keyArgs := ks.Where(argIndex)
+		where += keyWhere
+		args = append(args, keyArgs...)
+		argIndex += len(keyArgs)
+		keyColumn = ks.KeyColumn()
 	}
 
 	query := `
@@ -260,21 +355,30 @@ func GetProducts(db *pgxpool.Pool, page, limit int, search, sortBy, order string
 		c.name AS category_name,
 		CASE WHEN pr.id IS NOT NULL THEN true ELSE false END AS is_flashsale,
 		p.created_at, 
-		p.updated_at
+		p.updated_at,
+		` + rankExpr + ` AS rank,
+		` + keyColumn + ` AS cursor_key
 	FROM products p
 	LEFT JOIN categories c ON c.id = p.category_id
-	LEFT JOIN product_promos pp ON pp.product_id = p.id
-	LEFT JOIN promos pr ON pr.id = pp.promo_id 
-		AND pr.start <= NOW() AND pr."end" >= NOW()
+	` + activePromoJoin + `
 `
 
-	if search != "" {
-		query += " WHERE LOWER(p.title) LIKE LOWER($1) OR LOWER(p.description) LIKE LOWER($2)"
+	query += where
+
+	switch {
+	case ks != nil:
+		query += ks.OrderBy()
+		query += fmt.Sprintf(" LIMIT $%d", argIndex)
+		args = append(args, ks.Limit+1)
+	case sortBy == "relevance":
+		query += " ORDER BY rank DESC, p.id ASC"
+	default:
+		query += fmt.Sprintf(" ORDER BY %s %s", sortBy, order)
+	}
+	if ks == nil {
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+		args = append(args, limit, offset)
 	}
-
-	query += fmt.Sprintf(" ORDER BY %s %s LIMIT $%d OFFSET $%d", sortBy, order, argIndex, argIndex+1)
-
-	args = append(args, limit, offset)
 
 	rows, err := db.Query(ctx, query, args...)
 	if err != nil {
@@ -283,11 +387,13 @@ func GetProducts(db *pgxpool.Pool, page, limit int, search, sortBy, order string
 	defer rows.Close()
 
 	var products []ProductResponse
+	var keys []KeysetKey
 
 	for rows.Next() {
 		var p ProductResponse
 		var categoryName string
 		var isFlashSale bool
+		var cursorKey string
 
 		err := rows.Scan(
 			&p.ID,
@@ -300,6 +406,8 @@ func GetProducts(db *pgxpool.Pool, page, limit int, search, sortBy, order string
 			&isFlashSale,
 			&p.CreatedAt,
 			&p.UpdatedAt,
+			&p.Rank,
+			&cursorKey,
 		)
 
 		if err != nil {
@@ -309,6 +417,9 @@ func GetProducts(db *pgxpool.Pool, page, limit int, search, sortBy, order string
 
 		p.Category.Name = categoryName
 		p.IsFlashSale = isFlashSale
+		if ps != nil {
+			p.Highlight = ps.Highlight(p.Title, p.Description)
+		}
 
 		variantRows, _ := db.Query(ctx,
 			`SELECT v.id, v.name, v.additional_price 
@@ -347,6 +458,11 @@ func GetProducts(db *pgxpool.Pool, page, limit int, search, sortBy, order string
 		imageRows.Close()
 
 		products = append(products, p)
+		keys = append(keys, KeysetKey{Key: cursorKey, ID: p.ID})
+	}
+
+	if ks != nil {
+		products = KeysetPage(ks, products, keys)
 	}
 
 	return products, total, nil
@@ -361,7 +477,7 @@ func GetProductByID(db *pgxpool.Pool, productID int64) (ProductResponse, error)
 		`SELECT p.id, p.title, p.description, p.base_price, p.stock, p.category_id, c.name, p.created_at, p.updated_at
 		 FROM products p
 		 LEFT JOIN categories c ON c.id = p.category_id
-		 WHERE p.id=$1`,
+		 WHERE p.id=$1 AND p.deleted_at IS NULL`,
 		productID,
 	).Scan(
 		&p.ID, &p.Title, &p.Description, &p.BasePrice, &p.Stock,
@@ -423,10 +539,14 @@ func GetProductByID(db *pgxpool.Pool, productID int64) (ProductResponse, error)
 		}
 	}
 
+	if err := loadProductSKUs(db, &p); err != nil {
+		return p, err
+	}
+
 	return p, nil
 }
 
-func UpdateProduct(db *pgxpool.Pool, productID int64, req ProductRequest, imageFiles []string, old ProductResponse) (ProductResponse, error) {
+func UpdateProduct(db *pgxpool.Pool, productID int64, req ProductRequest, imageFiles []string, old ProductResponse, userID int64) (ProductResponse, error) {
 	ctx := context.Background()
 	product := old
 
@@ -439,22 +559,50 @@ func UpdateProduct(db *pgxpool.Pool, productID int64, req ProductRequest, imageF
 	if req.BasePrice != 0 {
 		product.BasePrice = req.BasePrice
 	}
-	if req.Stock != 0 {
-		product.Stock = req.Stock
-	}
 	if req.CategoryID != 0 {
 		product.Category.ID = req.CategoryID
 	}
 
+	// Stock lives on the SKUs. A new stock is spread over the SKUs when the
+	// sizes/variants change too, else it only applies to single-SKU products.
+	optionsChanged := len(req.VariantID) > 0 || len(req.Sizes) > 0
+	sizes, variants := req.Sizes, req.VariantID
+	if len(sizes) == 0 {
+		for _, s := range old.Sizes {
+			sizes = append(sizes, s.ID)
+		}
+	}
+	if len(variants) == 0 {
+		for _, v := range old.Variants {
+			variants = append(variants, v.ID)
+		}
+	}
+	if err := ValidateSKURequests(sizes, variants, req.SKUs); err != nil {
+		return product, err
+	}
+	// Stock changes and their ledger entries must not outlive a failed update.
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return product, err
+	}
+	defer tx.Rollback(ctx)
+
+	adjustment := stockChange{reason: StockReasonAdjustment, userID: stockActor(userID)}
+	if req.Stock != 0 && len(req.SKUs) == 0 && !optionsChanged {
+		if err := setSingleSKUStock(ctx, tx, productID, req.Stock, adjustment); err != nil {
+			return product, err
+		}
+	}
+
 	updateQuery := `
 		UPDATE products
-		SET title=$1, description=$2, base_price=$3, stock=$4,
-		    category_id=$5, updated_at=NOW()
-		WHERE id=$6
+		SET title=$1, description=$2, base_price=$3,
+		    category_id=$4, updated_at=NOW()
+		WHERE id=$5
 		RETURNING id, title, description, base_price, stock, category_id, created_at, updated_at
 	`
-	err := db.QueryRow(ctx, updateQuery,
-		product.Title, product.Description, product.BasePrice, product.Stock,
+	err = tx.QueryRow(ctx, updateQuery,
+		product.Title, product.Description, product.BasePrice,
 		product.Category.ID, productID,
 	).Scan(
 		&product.ID, &product.Title, &product.Description,
@@ -465,25 +613,31 @@ func UpdateProduct(db *pgxpool.Pool, productID int64, req ProductRequest, imageF
 		return product, err
 	}
 
-	err = db.QueryRow(ctx, `SELECT name FROM categories WHERE id=$1`, product.Category.ID).Scan(&product.Category.Name)
+	err = tx.QueryRow(ctx, `SELECT name FROM categories WHERE id=$1`, product.Category.ID).Scan(&product.Category.Name)
 	if err != nil {
 		product.Category.Name = old.Category.Name
 	}
 
 	if len(req.VariantID) > 0 {
-		_, _ = db.Exec(ctx, `DELETE FROM product_variants WHERE product_id=$1`, product.ID)
+		// A failed statement aborts the transaction, so errors can't be skipped.
+		if _, err := tx.Exec(ctx, `DELETE FROM product_variants WHERE product_id=$1`, product.ID); err != nil {
+			return product, err
+		}
 		product.Variants = []Variant{}
 		for _, vID := range req.VariantID {
-			_, _ = db.Exec(ctx, `INSERT INTO product_variants (product_id, variant_id) VALUES ($1, $2)`, product.ID, vID)
-		}
-		rows, err := db.Query(ctx, `SELECT id, name, additional_price FROM variants WHERE id = ANY($1)`, req.VariantID)
-		if err == nil {
-			defer rows.Close()
-			for rows.Next() {
-				var v Variant
-				if err := rows.Scan(&v.ID, &v.Name, &v.AdditionalPrice); err == nil {
-					product.Variants = append(product.Variants, v)
-				}
+			if _, err := tx.Exec(ctx, `INSERT INTO product_variants (product_id, variant_id) VALUES ($1, $2)`, product.ID, vID); err != nil {
+				return product, err
+			}
+		}
+		rows, err := tx.Query(ctx, `SELECT id, name, additional_price FROM variants WHERE id = ANY($1)`, req.VariantID)
+		if err != nil {
+			return product, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var v Variant
+			if err := rows.Scan(&v.ID, &v.Name, &v.AdditionalPrice); err == nil {
+				product.Variants = append(product.Variants, v)
 			}
 		}
 	} else {
@@ -491,12 +645,16 @@ func UpdateProduct(db *pgxpool.Pool, productID int64, req ProductRequest, imageF
 	}
 
 	if len(req.Sizes) > 0 {
-		_, _ = db.Exec(ctx, `DELETE FROM product_sizes WHERE product_id=$1`, product.ID)
+		if _, err := tx.Exec(ctx, `DELETE FROM product_sizes WHERE product_id=$1`, product.ID); err != nil {
+			return product, err
+		}
 		product.Sizes = []Size{}
 		for _, sizeID := range req.Sizes {
-			_, _ = db.Exec(ctx, `INSERT INTO product_sizes (product_id, size_id) VALUES ($1, $2)`, product.ID, sizeID)
+			if _, err := tx.Exec(ctx, `INSERT INTO product_sizes (product_id, size_id) VALUES ($1, $2)`, product.ID, sizeID); err != nil {
+				return product, err
+			}
 			var s Size
-			err := db.QueryRow(ctx, `SELECT id, name, additional_price FROM sizes WHERE id=$1`, sizeID).
+			err := tx.QueryRow(ctx, `SELECT id, name, additional_price FROM sizes WHERE id=$1`, sizeID).
 				Scan(&s.ID, &s.Name, &s.AdditionalPrice)
 			if err == nil {
 				product.Sizes = append(product.Sizes, s)
@@ -507,10 +665,14 @@ func UpdateProduct(db *pgxpool.Pool, productID int64, req ProductRequest, imageF
 	}
 
 	if len(imageFiles) > 0 {
-		_, _ = db.Exec(ctx, `DELETE FROM product_images WHERE product_id=$1`, product.ID)
+		if _, err := tx.Exec(ctx, `DELETE FROM product_images WHERE product_id=$1`, product.ID); err != nil {
+			return product, err
+		}
 		product.Images = []ProductImage{}
 		for _, filename := range imageFiles {
-			_, _ = db.Exec(ctx, `INSERT INTO product_images (product_id, image, updated_at) VALUES ($1, $2, NOW())`, product.ID, filename)
+			if _, err := tx.Exec(ctx, `INSERT INTO product_images (product_id, image, updated_at) VALUES ($1, $2, NOW())`, product.ID, filename); err != nil {
+				return product, err
+			}
 			product.Images = append(product.Images, ProductImage{
 				ProductID: product.ID,
 				Image:     filename,
@@ -521,6 +683,28 @@ func UpdateProduct(db *pgxpool.Pool, productID int64, req ProductRequest, imageF
 		product.Images = old.Images
 	}
 
+	if optionsChanged {
+		if err := syncProductSKUs(ctx, tx, product.ID); err != nil {
+			return product, err
+		}
+		if req.Stock != 0 && len(req.SKUs) == 0 {
+			if err := spreadProductStock(ctx, tx, product.ID, req.Stock, adjustment); err != nil {
+				return product, err
+			}
+		}
+	}
+	if len(req.SKUs) > 0 {
+		if err := applySKURequests(ctx, tx, product.ID, req.SKUs, adjustment); err != nil {
+			return product, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return product, err
+	}
+	if err := loadProductSKUs(db, &product); err != nil {
+		return product, err
+	}
+
 	return product, nil
 }
 
@@ -534,6 +718,7 @@ type ProductDetail struct {
 	Variant     *Variant                 `json:"variant,omitempty"`
 	Sizes       []Size                   `json:"sizes"`
 	Images      []ProductImage           `json:"images"`
+	SKUs        []ProductSKU             `json:"skus"`
 	Recommended []RecommendedProductInfo `json:"recommended"`
 	CreatedAt   time.Time                `json:"createdAt"`
 	UpdatedAt   time.Time                `json:"updatedAt"`
@@ -562,6 +747,7 @@ type Cart struct {
 	ID        int64     `json:"id"`
 	UserID    int64     `json:"userId"`
 	ProductID int64     `json:"productId"`
+	SkuID     *int64    `json:"skuId,omitempty"`
 	SizeID    *int64    `json:"size_id,omitempty"`
 	VariantID *int64    `json:"variantId,omitempty"`
 	Quantity  int       `json:"quantity"`
@@ -572,13 +758,17 @@ type Cart struct {
 type CartItemResponse struct {
 	ID        int64   `json:"id"`
 	ProductID int64   `json:"productId"`
+	SkuID     int64   `json:"skuId"`
 	Title     string  `json:"title"`
 	BasePrice float64 `json:"basePrice"`
+	Price     float64 `json:"price"`
 	Image     string  `json:"image"`
 	Size      string  `json:"size,omitempty"`
 	Variant   string  `json:"variant,omitempty"`
 	Quantity  int     `json:"quantity"`
 	Subtotal  float64 `json:"subtotal"`
+	// ReservedUntil is when the cart's hold on the units ends; nil once expired.
+	ReservedUntil *time.Time `json:"reservedUntil"`
 }
 
 type CartResponse struct {
@@ -586,88 +776,123 @@ type CartResponse struct {
 	Total float64            `json:"total"`
 }
 
-func AddOrUpdateCart(db *pgxpool.Pool, userID, productID int64, sizeID, variantID *int64, quantity int) (CartItemResponse, error) {
+// AddOrUpdateCart adds quantity of a product to the cart and reserves the
+// cart's units for ttl. The SKU is given directly or picked by size and
+// variant; it must be active and have enough stock, after other carts'
+// reservations, for what is already in the cart plus quantity. A user holds
+// at most maxQuantity units of one SKU.
+func AddOrUpdateCart(db *pgxpool.Pool, userID, productID int64, skuID, sizeID, variantID *int64, quantity, maxQuantity int, ttl time.Duration) (CartItemResponse, error) {
 	ctx := context.Background()
 	var cartID int64
 
-	var sizeValue, variantValue interface{}
-	if sizeID != nil {
-		sizeValue = *sizeID
-	} else {
-		sizeValue = nil
-	}
-	if variantID != nil {
-		variantValue = *variantID
-	} else {
-		variantValue = nil
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return CartItemResponse{}, err
 	}
+	defer tx.Rollback(ctx)
 
-	var stock int
-	err := db.QueryRow(ctx, `SELECT stock FROM products WHERE id=$1`, productID).Scan(&stock)
+	// Locking the SKU serialises reservations for it, so two carts can't both
+	// take the last unit.
+	var available int
+	var resolvedSKU int64
+	var skuSize, skuVariant *int64
+	err = tx.QueryRow(ctx, `
+		SELECT k.id, k.stock - `+reservedByOthersExpr("$5")+`, k.size_id, k.variant_id
+		FROM product_skus k
+		JOIN products p ON p.id = k.product_id
+		WHERE k.product_id=$1 AND k.is_active AND p.deleted_at IS NULL
+			AND CASE WHEN $2::bigint IS NOT NULL THEN k.id = $2::bigint
+				ELSE COALESCE(k.size_id, 0) = COALESCE($3::bigint, 0)
+					AND COALESCE(k.variant_id, 0) = COALESCE($4::bigint, 0)
+			END
+		FOR UPDATE OF k
+	`, productID, skuID, sizeID, variantID, userID).Scan(&resolvedSKU, &available, &skuSize, &skuVariant)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return CartItemResponse{}, ErrSKUUnavailable
+	}
 	if err != nil {
 		return CartItemResponse{}, err
 	}
-	if quantity > stock {
-		return CartItemResponse{}, errors.New("quantity exceeds available stock")
-	}
 
 	var existingQty int
-	err = db.QueryRow(ctx, `
+	err = tx.QueryRow(ctx, `
 		SELECT id, quantity FROM carts
-		WHERE user_id=$1 AND product_id=$2 
-		AND COALESCE(size_id,0)=COALESCE($3,0)
-		AND COALESCE(variant_id,0)=COALESCE($4,0)
+		WHERE user_id=$1 AND sku_id=$2
 		LIMIT 1
-	`, userID, productID, sizeValue, variantValue).Scan(&cartID, &existingQty)
+	`, userID, resolvedSKU).Scan(&cartID, &existingQty)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return CartItemResponse{}, err
+	}
 
-	if err == nil {
-		newQty := existingQty + quantity
-		if newQty > stock {
-			return CartItemResponse{}, errors.New("quantity exceeds available stock")
-		}
-		_, err := db.Exec(ctx, `UPDATE carts SET quantity=$1, updated_at=NOW() WHERE id=$2`, newQty, cartID)
+	newQty := existingQty + quantity
+	if newQty > maxQuantity {
+		return CartItemResponse{}, fmt.Errorf("%w of %d", ErrCartItemLimit, maxQuantity)
+	}
+	if newQty > available {
+		return CartItemResponse{}, errors.New("quantity exceeds available stock")
+	}
+
+	if cartID != 0 {
+		_, err := tx.Exec(ctx, `UPDATE carts SET quantity=$1, updated_at=NOW() WHERE id=$2`, newQty, cartID)
 		if err != nil {
 			return CartItemResponse{}, err
 		}
 	} else {
-		err := db.QueryRow(ctx, `
-			INSERT INTO carts (user_id, product_id, size_id, variant_id, quantity, created_at, updated_at)
-			VALUES ($1,$2,$3,$4,$5,NOW(),NOW()) RETURNING id
-		`, userID, productID, sizeID, variantID, quantity).Scan(&cartID)
+		err := tx.QueryRow(ctx, `
+			INSERT INTO carts (user_id, product_id, sku_id, size_id, variant_id, quantity, created_at, updated_at)
+			VALUES ($1,$2,$3,$4,$5,$6,NOW(),NOW()) RETURNING id
+		`, userID, productID, resolvedSKU, skuSize, skuVariant, quantity).Scan(&cartID)
 
 		if err != nil {
 			return CartItemResponse{}, err
 		}
 	}
 
+	if err := reserveCartItem(ctx, tx, cartID, resolvedSKU, newQty, ttl); err != nil {
+		return CartItemResponse{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return CartItemResponse{}, err
+	}
+
 	var item CartItemResponse
 	err = db.QueryRow(ctx, `
 		SELECT 
 			c.id,
 			c.product_id,
+			c.sku_id,
 			p.title,
 			p.base_price,
+			`+skuPriceExpr+` AS price,
 			COALESCE(pi.image,'') AS image,
 			COALESCE(s.name,'') AS size,
 			COALESCE(v.name,'') AS variant,
 			c.quantity,
-			(p.base_price + COALESCE(s.additional_price,0) + COALESCE(v.additional_price,0)) * c.quantity AS subtotal
+			`+skuPriceExpr+` * c.quantity AS subtotal,
+			r.expires_at
 		FROM carts c
+		JOIN product_skus k ON k.id=c.sku_id
 		JOIN products p ON p.id=c.product_id
-		LEFT JOIN product_images pi ON pi.product_id=p.id
-		LEFT JOIN sizes s ON s.id=c.size_id
-		LEFT JOIN variants v ON v.id=c.variant_id
+		LEFT JOIN stock_reservations r ON r.cart_id = c.id AND r.expires_at > NOW()
+		LEFT JOIN LATERAL (
+			SELECT image FROM product_images WHERE product_id = p.id ORDER BY id ASC LIMIT 1
+		) pi ON true
+		LEFT JOIN sizes s ON s.id=k.size_id
+		LEFT JOIN variants v ON v.id=k.variant_id
 		WHERE c.id=$1
 	`, cartID).Scan(
 		&item.ID,
 		&item.ProductID,
+		&item.SkuID,
 		&item.Title,
 		&item.BasePrice,
+		&item.Price,
 		&item.Image,
 		&item.Size,
 		&item.Variant,
 		&item.Quantity,
 		&item.Subtotal,
+		&item.ReservedUntil,
 	)
 	if err != nil {
 		return CartItemResponse{}, err
@@ -701,15 +926,20 @@ func GetCartByUser(db *pgxpool.Pool, userID int64) (CartResponse, error) {
 		SELECT 
 			c.id AS cart_id,         
 			c.product_id,
+			c.sku_id,
 			p.title,
 			p.base_price,
+			` + skuPriceExpr + ` AS price,
 			COALESCE(pi.image,'') AS image,
 			COALESCE(s.name,'') AS size,
 			COALESCE(v.name,'') AS variant,
-			SUM(c.quantity) AS quantity,
-			SUM((p.base_price + COALESCE(s.additional_price,0) + COALESCE(v.additional_price,0)) * c.quantity) AS subtotal
+			c.quantity,
+			` + skuPriceExpr + ` * c.quantity AS subtotal,
+			r.expires_at
 		FROM carts c
+		JOIN product_skus k ON k.id = c.sku_id
 		JOIN products p ON p.id = c.product_id
+		LEFT JOIN stock_reservations r ON r.cart_id = c.id AND r.expires_at > NOW()
 		LEFT JOIN LATERAL (
 			SELECT image 
 			FROM product_images 
@@ -717,10 +947,9 @@ func GetCartByUser(db *pgxpool.Pool, userID int64) (CartResponse, error) {
 			ORDER BY id ASC 
 			LIMIT 1
 		) pi ON true
-		LEFT JOIN sizes s ON s.id = c.size_id
-		LEFT JOIN variants v ON v.id = c.variant_id
+		LEFT JOIN sizes s ON s.id = k.size_id
+		LEFT JOIN variants v ON v.id = k.variant_id
 		WHERE c.user_id = $1
-		GROUP BY c.id, c.product_id, p.title, p.base_price, pi.image, s.name, v.name
 		ORDER BY c.id ASC
 	`
 
@@ -738,13 +967,16 @@ func GetCartByUser(db *pgxpool.Pool, userID int64) (CartResponse, error) {
 		if err := rows.Scan(
 			&item.ID,
 			&item.ProductID,
+			&item.SkuID,
 			&item.Title,
 			&item.BasePrice,
+			&item.Price,
 			&item.Image,
 			&item.Size,
 			&item.Variant,
 			&item.Quantity,
 			&item.Subtotal,
+			&item.ReservedUntil,
 		); err != nil {
 			return CartResponse{}, err
 		}
@@ -772,6 +1004,7 @@ type OrderTransactionItem struct {
 	ID          int64   `json:"id"`
 	ProductID   int64   `json:"productId"`
 	ProductName string  `json:"productName"`
+	SkuID       int64   `json:"skuId"`
 	Quantity    int     `json:"quantity"`
 	SizeID      *int64  `json:"sizeId,omitempty"`
 	SizeName    *string `json:"sizeName,omitempty"`
@@ -804,28 +1037,21 @@ func CreateOrderTransaction(db *pgxpool.Pool, req OrderTransactionRequest) (*Ord
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		if p := recover(); p != nil {
-			tx.Rollback(ctx)
-			panic(p)
-		} else if err != nil {
-			tx.Rollback(ctx)
-		}
-	}()
+	defer tx.Rollback(ctx)
 
 	queryCart := `
 		SELECT 
-			c.id, c.product_id, c.quantity,
-			p.title, p.base_price,
-			c.size_id, s.name AS size_name, COALESCE(s.additional_price,0) AS size_price,
-			c.variant_id, v.name AS variant_name, COALESCE(v.additional_price,0) AS variant_price,
+			c.id, c.product_id, c.sku_id, c.quantity,
+			p.title, ` + skuPriceExpr + ` AS unit_price,
+			k.size_id, s.name AS size_name,
+			k.variant_id, v.name AS variant_name,
 			COALESCE(pr.discount,0) AS promo_discount
 		FROM carts c
+		JOIN product_skus k ON k.id = c.sku_id
 		JOIN products p ON p.id = c.product_id
-		LEFT JOIN sizes s ON s.id = c.size_id
-		LEFT JOIN variants v ON v.id = c.variant_id
-		LEFT JOIN product_promos pp ON pp.product_id = p.id
-		LEFT JOIN promos pr ON pr.id = pp.promo_id AND pr.start <= NOW() AND pr."end" >= NOW()
+		LEFT JOIN sizes s ON s.id = k.size_id
+		LEFT JOIN variants v ON v.id = k.variant_id
+		` + activePromoJoin + `
 		WHERE c.user_id=$1
 	`
 	rows, err := tx.Query(ctx, queryCart, req.UserID)
@@ -840,14 +1066,14 @@ func CreateOrderTransaction(db *pgxpool.Pool, req OrderTransactionRequest) (*Ord
 	for rows.Next() {
 		var item OrderTransactionItem
 		var sizeName, variantName *string
-		var sizePrice, variantPrice, basePrice, promoDiscount float64
+		var unitPrice, promoDiscount float64
 		var quantity, cartID int
 		var sizeID, variantID *int64
 
 		if err := rows.Scan(
-			&cartID, &item.ProductID, &quantity, &item.ProductName, &basePrice,
-			&sizeID, &sizeName, &sizePrice,
-			&variantID, &variantName, &variantPrice,
+			&cartID, &item.ProductID, &item.SkuID, &quantity, &item.ProductName, &unitPrice,
+			&sizeID, &sizeName,
+			&variantID, &variantName,
 			&promoDiscount,
 		); err != nil {
 			return nil, err
@@ -859,7 +1085,7 @@ func CreateOrderTransaction(db *pgxpool.Pool, req OrderTransactionRequest) (*Ord
 		item.SizeName = sizeName
 		item.VariantID = variantID
 		item.VariantName = variantName
-		item.Subtotal = (basePrice + sizePrice + variantPrice - promoDiscount) * float64(quantity)
+		item.Subtotal = (unitPrice - promoDiscount) * float64(quantity)
 		if item.Subtotal < 0 {
 			item.Subtotal = 0
 		}
@@ -875,18 +1101,40 @@ func CreateOrderTransaction(db *pgxpool.Pool, req OrderTransactionRequest) (*Ord
 	tax := total * 0.10
 	total = total + tax
 
+	// Lock all SKUs in id order before changing any stock (which also locks
+	// the product row through the SKU trigger), so concurrent checkouts can't
+	// deadlock. The quantity of each SKU is summed across cart rows and must
+	// fit in the stock not reserved by other carts. Deleting the cart rows
+	// below releases this user's reservations in the same transaction, so
+	// they turn into the sale atomically.
+	wanted := map[int64]int{}
+	names := map[int64]string{}
+	var skuIDs []int64
 	for _, item := range items {
-		var currentStock int
-		err := tx.QueryRow(ctx, `SELECT stock FROM products WHERE id=$1 FOR UPDATE`, item.ProductID).Scan(&currentStock)
-		if err != nil {
-			return nil, errors.New("failed to fetch stock for product " + item.ProductName)
+		if _, ok := wanted[item.SkuID]; !ok {
+			skuIDs = append(skuIDs, item.SkuID)
 		}
-		if item.Quantity > currentStock {
-			return nil, errors.New("product " + item.ProductName + " stock insufficient")
+		wanted[item.SkuID] += item.Quantity
+		names[item.SkuID] = item.ProductName
+	}
+	sort.Slice(skuIDs, func(i, j int) bool { return skuIDs[i] < skuIDs[j] })
+
+	for _, skuID := range skuIDs {
+		var available int
+		err := tx.QueryRow(ctx, `
+			SELECT k.stock - `+reservedByOthersExpr("$2")+` FROM product_skus k
+			JOIN products p ON p.id = k.product_id
+			WHERE k.id=$1 AND k.is_active AND p.deleted_at IS NULL
+			FOR UPDATE OF k
+		`, skuID, req.UserID).Scan(&available)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("product " + names[skuID] + " is no longer available")
 		}
-		_, err = tx.Exec(ctx, `UPDATE products SET stock = stock - $1 WHERE id=$2`, item.Quantity, item.ProductID)
 		if err != nil {
-			return nil, errors.New("failed to update stock for product " + item.ProductName)
+			return nil, errors.New("failed to fetch stock for product " + names[skuID])
+		}
+		if wanted[skuID] > available {
+			return nil, errors.New("product " + names[skuID] + " stock insufficient")
 		}
 	}
 
@@ -930,14 +1178,25 @@ func CreateOrderTransaction(db *pgxpool.Pool, req OrderTransactionRequest) (*Ord
 		item := &items[i]
 		_, err := tx.Exec(ctx, `
 			INSERT INTO transaction_items
-			(transaction_id, product_id, variant_id, size_id, quantity, subtotal)
-			VALUES ($1,$2,$3,$4,$5,$6)
-		`, orderID, item.ProductID, item.VariantID, item.SizeID, item.Quantity, item.Subtotal)
+			(transaction_id, product_id, sku_id, variant_id, size_id, quantity, subtotal)
+			VALUES ($1,$2,$3,$4,$5,$6,$7)
+		`, orderID, item.ProductID, item.SkuID, item.VariantID, item.SizeID, item.Quantity, item.Subtotal)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	for _, skuID := range skuIDs {
+		_, err := moveSKUStock(ctx, tx, skuID, -wanted[skuID], stockChange{
+			reason:        StockReasonSale,
+			userID:        &req.UserID,
+			transactionID: &orderID,
+		})
+		if err != nil {
+			return nil, errors.New("failed to update stock for product " + names[skuID])
+		}
+	}
+
 	_, err = tx.Exec(ctx, `DELETE FROM carts WHERE user_id=$1`, req.UserID)
 	if err != nil {
 		return nil, errors.New("failed to clear cart")
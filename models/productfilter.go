@@ -0,0 +1,268 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Facet names, used to leave a filter out when counting its own facet.
+const (
+	facetCategory = "category"
+	facetPrice    = "price"
+	facetSize     = "size"
+	facetVariant  = "variant"
+	facetStock    = "stock"
+)
+
+// PriceBuckets are the upper bounds (exclusive) of the price facet; the last
+// bucket is open-ended.
+var PriceBuckets = []float64{15000, 25000, 40000}
+
+type FacetCount struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type PriceBucketCount struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max"`
+	Count int      `json:"count"`
+}
+
+type StockFacet struct {
+	InStock    int `json:"inStock"`
+	OutOfStock int `json:"outOfStock"`
+}
+
+type ProductFacets struct {
+	Categories []FacetCount       `json:"categories"`
+	Prices     []PriceBucketCount `json:"prices"`
+	Sizes      []FacetCount       `json:"sizes"`
+	Variants   []FacetCount       `json:"variants"`
+	Stock      StockFacet         `json:"stock"`
+}
+
+// Where returns the filter as " AND ..." conditions on products aliased p,
+// numbering placeholders from idx. Products in the trash are always excluded.
+// The search, when set, always comes first so Rank(idx) refers to the same
+// placeholders.
+func (f *ProductFilter) Where(idx int) (string, []interface{}) {
+	return f.where(idx, "")
+}
+
+// Rank is the relevance expression matching Where(idx).
+func (f *ProductFilter) Rank(idx int) string {
+	if f.Search == nil {
+		return "0::float8"
+	}
+	_, rank, _ := f.Search.Condition(idx)
+	return rank
+}
+
+// availableSKU matches the active, in-stock SKUs of the product aliased p.
+const availableSKU = "k.product_id = p.id AND k.is_active AND k.stock > 0"
+
+// skuMatch returns an EXISTS condition for a SKU of p that satisfies the
+// size, variant, price and in-stock filters together, or "" when none of them
+// applies. Sizes, variants and in_stock=true ask for availability, so they
+// only match SKUs with stock; price alone matches any active SKU, using its
+// override when it has one.
+func (f *ProductFilter) skuMatch(arg func(interface{}) string, skip string) string {
+	var conds []string
+	available := f.InStock != nil && *f.InStock && skip != facetStock
+	if len(f.Sizes) > 0 && skip != facetSize {
+		conds = append(conds, "k.size_id = ANY("+arg(f.Sizes)+")")
+		available = true
+	}
+	if len(f.Variants) > 0 && skip != facetVariant {
+		conds = append(conds, "k.variant_id = ANY("+arg(f.Variants)+")")
+		available = true
+	}
+	if f.PriceMin != nil && skip != facetPrice {
+		conds = append(conds, skuPriceExpr+" >= "+arg(*f.PriceMin))
+	}
+	if f.PriceMax != nil && skip != facetPrice {
+		conds = append(conds, skuPriceExpr+" <= "+arg(*f.PriceMax))
+	}
+	if len(conds) == 0 && !available {
+		return ""
+	}
+
+	base := "k.product_id = p.id AND k.is_active"
+	if available {
+		base = availableSKU
+	}
+	return `EXISTS (
+			SELECT 1 FROM product_skus k
+			LEFT JOIN sizes s ON s.id = k.size_id
+			LEFT JOIN variants v ON v.id = k.variant_id
+			WHERE ` + strings.Join(append([]string{base}, conds...), " AND ") + ")"
+}
+
+func (f *ProductFilter) where(idx int, skip string) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", idx+len(args)-1)
+	}
+
+	if f.Search != nil {
+		cond, _, searchArgs := f.Search.Condition(idx)
+		conds = append(conds, cond)
+		args = append(args, searchArgs...)
+	}
+	conds = append(conds, "p.deleted_at IS NULL")
+	if len(f.Categories) > 0 && skip != facetCategory {
+		conds = append(conds, "p.category_id = ANY("+arg(f.Categories)+")")
+	}
+	if f.IsFavorite != nil {
+		conds = append(conds, "p.is_favorite = "+arg(*f.IsFavorite))
+	}
+	if cond := f.skuMatch(arg, skip); cond != "" {
+		conds = append(conds, cond)
+	}
+	if f.InStock != nil && !*f.InStock && skip != facetStock {
+		conds = append(conds, "NOT EXISTS (SELECT 1 FROM product_skus k WHERE "+availableSKU+")")
+	}
+	if f.OnPromo != nil {
+		promo := `EXISTS (
+			SELECT 1 FROM product_promos fpp
+			JOIN promos fpr ON fpr.id = fpp.promo_id
+			WHERE fpp.product_id = p.id AND fpr.deleted_at IS NULL
+				AND fpr.start <= NOW() AND fpr."end" >= NOW())`
+		if !*f.OnPromo {
+			promo = "NOT " + promo
+		}
+		conds = append(conds, promo)
+	}
+	if f.MinRating != nil {
+		conds = append(conds, "p.rating >= "+arg(*f.MinRating))
+	}
+
+	return " AND " + strings.Join(conds, " AND "), args
+}
+
+// GetProductFacets counts, for every facet, how many products each value would
+// return. Each facet respects all active filters except its own, so picking a
+// second category or size still shows how many products it adds. Sizes,
+// variants and stock count products with an active SKU in stock; prices count
+// a product in every bucket one of its active SKUs falls in.
+func GetProductFacets(db *pgxpool.Pool, f *ProductFilter) (*ProductFacets, error) {
+	facets := &ProductFacets{}
+	var err error
+
+	where, args := f.where(1, facetCategory)
+	facets.Categories, err = facetCounts(db, `
+		SELECT c.id, c.name, COUNT(p.id)
+		FROM categories c
+		LEFT JOIN products p ON p.category_id = c.id`+where+`
+		GROUP BY c.id, c.name
+		ORDER BY c.name
+	`, args)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args = f.where(1, facetSize)
+	facets.Sizes, err = facetCounts(db, `
+		SELECT s.id, s.name, COUNT(DISTINCT p.id)
+		FROM sizes s
+		LEFT JOIN product_skus ps ON ps.size_id = s.id AND ps.is_active AND ps.stock > 0
+		LEFT JOIN products p ON p.id = ps.product_id`+where+`
+		GROUP BY s.id, s.name
+		ORDER BY s.id
+	`, args)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args = f.where(1, facetVariant)
+	facets.Variants, err = facetCounts(db, `
+		SELECT v.id, v.name, COUNT(DISTINCT p.id)
+		FROM variants v
+		LEFT JOIN product_skus pv ON pv.variant_id = v.id AND pv.is_active AND pv.stock > 0
+		LEFT JOIN products p ON p.id = pv.product_id`+where+`
+		GROUP BY v.id, v.name
+		ORDER BY v.id
+	`, args)
+	if err != nil {
+		return nil, err
+	}
+
+	facets.Prices, err = priceFacet(db, f)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args = f.where(1, facetStock)
+	err = db.QueryRow(context.Background(), `
+		SELECT
+			COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM product_skus k WHERE `+availableSKU+`)),
+			COUNT(*) FILTER (WHERE NOT EXISTS (SELECT 1 FROM product_skus k WHERE `+availableSKU+`))
+		FROM products p
+		WHERE 1=1`+where, args...).Scan(&facets.Stock.InStock, &facets.Stock.OutOfStock)
+	if err != nil {
+		return nil, err
+	}
+
+	return facets, nil
+}
+
+// facetCounts runs a facet query. The filter conditions are part of the join
+// to products, so values without matching products are still listed with 0.
+func facetCounts(db *pgxpool.Pool, query string, args []interface{}) ([]FacetCount, error) {
+	rows, err := db.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []FacetCount{}
+	for rows.Next() {
+		var c FacetCount
+		if err := rows.Scan(&c.ID, &c.Name, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+func priceFacet(db *pgxpool.Pool, f *ProductFilter) ([]PriceBucketCount, error) {
+	where, args := f.where(1, facetPrice)
+
+	buckets := make([]PriceBucketCount, len(PriceBuckets)+1)
+	selects := make([]string, len(buckets))
+	dest := make([]interface{}, len(buckets))
+	lower := 0.0
+	for i := range buckets {
+		buckets[i].Min = lower
+		if i < len(PriceBuckets) {
+			upper := PriceBuckets[i]
+			buckets[i].Max = &upper
+			selects[i] = fmt.Sprintf("COUNT(DISTINCT p.id) FILTER (WHERE %s >= %g AND %s < %g)", skuPriceExpr, lower, skuPriceExpr, upper)
+			lower = upper
+		} else {
+			selects[i] = fmt.Sprintf("COUNT(DISTINCT p.id) FILTER (WHERE %s >= %g)", skuPriceExpr, lower)
+		}
+		dest[i] = &buckets[i].Count
+	}
+
+	err := db.QueryRow(context.Background(),
+		"SELECT "+strings.Join(selects, ", ")+`
+		FROM products p
+		JOIN product_skus k ON k.product_id = p.id AND k.is_active
+		LEFT JOIN sizes s ON s.id = k.size_id
+		LEFT JOIN variants v ON v.id = k.variant_id
+		WHERE 1=1`+where, args...,
+	).Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
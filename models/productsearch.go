@@ -0,0 +1,63 @@
+package models
+
+import (
+	"coffeeder-backend/libs"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var searchTermPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+type ProductHighlight struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// ProductSearch is a parsed search box query. Terms only hold letters and
+// digits, so the tsquery built from them is always valid.
+type ProductSearch struct {
+	Query string
+	Terms []string
+}
+
+// NewProductSearch returns nil when q has nothing to search for.
+func NewProductSearch(q string) *ProductSearch {
+	terms := searchTermPattern.FindAllString(strings.ToLower(q), 10)
+	if len(terms) == 0 {
+		return nil
+	}
+	return &ProductSearch{Query: strings.Join(terms, " "), Terms: terms}
+}
+
+// TSQuery matches every term as a prefix, so "capp ice" finds "Iced Cappuccino".
+func (s *ProductSearch) TSQuery() string {
+	parts := make([]string, len(s.Terms))
+	for i, t := range s.Terms {
+		parts[i] = t + ":*"
+	}
+	return strings.Join(parts, " & ")
+}
+
+// Condition returns the WHERE condition and rank expression for products
+// aliased p, using placeholders $idx and $idx+1. Full-text matches over title,
+// category and description rank above 1; products only found by trigram
+// similarity to the title (typos like "capucino") rank between 0 and 1.
+func (s *ProductSearch) Condition(idx int) (string, string, []interface{}) {
+	tsq := fmt.Sprintf("to_tsquery('simple', $%d)", idx)
+	q := fmt.Sprintf("$%d::text", idx+1)
+
+	cond := fmt.Sprintf("(p.search_vector @@ %s OR %s <%% p.title)", tsq, q)
+	rank := fmt.Sprintf(
+		"(CASE WHEN p.search_vector @@ %s THEN 1 + ts_rank_cd(p.search_vector, %s) ELSE word_similarity(%s, p.title) END)::float8",
+		tsq, tsq, q)
+	return cond, rank, []interface{}{s.TSQuery(), s.Query}
+}
+
+// Highlight marks the matched terms in a product's title and description.
+func (s *ProductSearch) Highlight(title, description string) *ProductHighlight {
+	return &ProductHighlight{
+		Title:       libs.HighlightTerms(title, s.Terms),
+		Description: libs.HighlightTerms(description, s.Terms),
+	}
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrProductNotInTrash = errors.New("product is not in trash")
+	ErrProductHasOrders  = errors.New("product is referenced by orders")
+)
+
+type TrashedProduct struct {
+	ID         int64     `json:"id"`
+	Title      string    `json:"title"`
+	BasePrice  float64   `json:"basePrice"`
+	Stock      int       `json:"stock"`
+	Category   Category  `json:"category"`
+	DeletedAt  time.Time `json:"deletedAt"`
+	OrderCount int       `json:"orderCount"`
+}
+
+// SoftDeleteProduct moves a product to the trash. Its images, sizes, variants
+// and order items are kept so it can be restored and old orders still show it;
+// only cart rows are dropped so it can no longer be checked out. Returns false
+// when the product doesn't exist or is already in the trash.
+func SoftDeleteProduct(db *pgxpool.Pool, productID int64) (bool, error) {
+	ctx := context.Background()
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `
+		UPDATE products SET deleted_at=NOW(), updated_at=NOW()
+		WHERE id=$1 AND deleted_at IS NULL
+	`, productID)
+	if err != nil {
+		return false, err
+	}
+	if result.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM carts WHERE product_id=$1`, productID); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// RestoreProduct takes a product out of the trash. Returns false when it isn't
+// in the trash.
+func RestoreProduct(db *pgxpool.Pool, productID int64) (bool, error) {
+	result, err := db.Exec(context.Background(), `
+		UPDATE products SET deleted_at=NULL, updated_at=NOW()
+		WHERE id=$1 AND deleted_at IS NOT NULL
+	`, productID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// GetTrashedProducts lists the trash, most recently deleted first.
+func GetTrashedProducts(db *pgxpool.Pool, page, limit int) ([]TrashedProduct, int, error) {
+	ctx := context.Background()
+
+	var total int
+	if err := db.QueryRow(ctx, `SELECT COUNT(*) FROM products WHERE deleted_at IS NOT NULL`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT p.id, COALESCE(p.title, ''), COALESCE(p.base_price, 0), COALESCE(p.stock, 0),
+			COALESCE(p.category_id, 0), COALESCE(c.name, ''), p.deleted_at,
+			(SELECT COUNT(DISTINCT ti.transaction_id) FROM transaction_items ti WHERE ti.product_id = p.id)
+		FROM products p
+		LEFT JOIN categories c ON c.id = p.category_id
+		WHERE p.deleted_at IS NOT NULL
+		ORDER BY p.deleted_at DESC, p.id DESC
+		LIMIT $1 OFFSET $2
+	`, limit, (page-1)*limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	products := []TrashedProduct{}
+	for rows.Next() {
+		var p TrashedProduct
+		if err := rows.Scan(
+			&p.ID, &p.Title, &p.BasePrice, &p.Stock,
+			&p.Category.ID, &p.Category.Name, &p.DeletedAt, &p.OrderCount,
+		); err != nil {
+			return nil, 0, err
+		}
+		products = append(products, p)
+	}
+	return products, total, rows.Err()
+}
+
+// PurgeProduct permanently deletes a product from the trash together with its
+// images, sizes, variants, promos and recommendations. It refuses products that
+// are not in the trash (ErrProductNotInTrash) and products that appear in any
+// order (ErrProductHasOrders), since deleting those would rewrite order
+// history. Returns pgx.ErrNoRows when the product doesn't exist.
+func PurgeProduct(db *pgxpool.Pool, productID int64) error {
+	ctx := context.Background()
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var deletedAt *time.Time
+	err = tx.QueryRow(ctx, `SELECT deleted_at FROM products WHERE id=$1 FOR UPDATE`, productID).Scan(&deletedAt)
+	if err != nil {
+		return err
+	}
+	if deletedAt == nil {
+		return ErrProductNotInTrash
+	}
+
+	var ordered bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM transaction_items WHERE product_id=$1)`, productID).Scan(&ordered)
+	if err != nil {
+		return err
+	}
+	if ordered {
+		return ErrProductHasOrders
+	}
+
+	for _, query := range []string{
+		`DELETE FROM product_images WHERE product_id=$1`,
+		`DELETE FROM product_variants WHERE product_id=$1`,
+		`DELETE FROM product_sizes WHERE product_id=$1`,
+		`DELETE FROM products_categories WHERE product_id=$1`,
+		`DELETE FROM product_promos WHERE product_id=$1`,
+		`DELETE FROM carts WHERE product_id=$1`,
+		`DELETE FROM recommended_products WHERE product_id=$1 OR recommended_id=$1`,
+		`DELETE FROM products WHERE id=$1`,
+	} {
+		if _, err := tx.Exec(ctx, query, productID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,458 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrPromoPeriod          = errors.New("promo start must be before its end")
+	ErrPromoProductNotFound = errors.New("one or more products do not exist")
+)
+
+// PromoOverlapError lists the products that are already in another promo
+// running at the same time. A product may only be in one promo at a time,
+// since listings and checkout pick up a single promo per product.
+type PromoOverlapError struct {
+	Conflicts []PromoConflict
+}
+
+func (e *PromoOverlapError) Error() string {
+	return fmt.Sprintf("%d product(s) already have a promo in this period", len(e.Conflicts))
+}
+
+type PromoConflict struct {
+	ProductID    int64     `json:"productId"`
+	ProductTitle string    `json:"productTitle"`
+	PromoID      int64     `json:"promoId"`
+	PromoTitle   string    `json:"promoTitle"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+}
+
+type PromoProduct struct {
+	ID        int64   `json:"id"`
+	Title     string  `json:"title"`
+	BasePrice float64 `json:"basePrice"`
+}
+
+type Promo struct {
+	ID          int64          `json:"id"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Discount    float64        `json:"discount"`
+	Start       time.Time      `json:"start"`
+	End         time.Time      `json:"end"`
+	IsActive    bool           `json:"isActive"`
+	Products    []PromoProduct `json:"products"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+}
+
+// PromoRequest creates a promo. Discount is the amount taken off the unit
+// price of every assigned product.
+type PromoRequest struct {
+	Title       string    `json:"title" validate:"required,max=100"`
+	Description string    `json:"description" validate:"required,max=100"`
+	Discount    float64   `json:"discount" validate:"required,gt=0"`
+	Start       time.Time `json:"start" validate:"required"`
+	End         time.Time `json:"end" validate:"required"`
+	ProductIDs  []int64   `json:"productIds" validate:"dive,gt=0"`
+}
+
+type UpdatePromoRequest struct {
+	Title       *string    `json:"title" validate:"omitempty,min=1,max=100"`
+	Description *string    `json:"description" validate:"omitempty,min=1,max=100"`
+	Discount    *float64   `json:"discount" validate:"omitempty,gt=0"`
+	Start       *time.Time `json:"start"`
+	End         *time.Time `json:"end"`
+}
+
+type PromoProductsRequest struct {
+	ProductIDs []int64 `json:"productIds" validate:"required,min=1,dive,gt=0"`
+}
+
+// activePromoJoin joins pr (id, discount), the promo running now for product
+// p. It yields at most one row, so products that were in several promos over
+// time aren't listed or charged twice.
+const activePromoJoin = `LEFT JOIN LATERAL (
+		SELECT apr.id, apr.discount
+		FROM product_promos app
+		JOIN promos apr ON apr.id = app.promo_id
+		WHERE app.product_id = p.id AND apr.deleted_at IS NULL
+			AND apr.start <= NOW() AND apr."end" >= NOW()
+		ORDER BY apr.start DESC, apr.id DESC
+		LIMIT 1
+	) pr ON true`
+
+// promoColumns selects promo pr. Times from requests are sent as timestamptz
+// so they end up in the database's time zone, the one NOW() uses.
+const promoColumns = `pr.id, pr.title, pr.description, pr.discount, pr.start, pr."end",
+	(pr.start <= NOW() AND pr."end" >= NOW()), pr.created_at, pr.updated_at`
+
+func scanPromo(row pgx.Row, p *Promo) error {
+	return row.Scan(&p.ID, &p.Title, &p.Description, &p.Discount, &p.Start, &p.End,
+		&p.IsActive, &p.CreatedAt, &p.UpdatedAt)
+}
+
+// lockPromoProducts serialises changes to promo assignments so two admins
+// can't create overlapping promos for the same product at once. Readers
+// (listings, checkout) are not blocked.
+func lockPromoProducts(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `LOCK TABLE product_promos IN SHARE ROW EXCLUSIVE MODE`)
+	return err
+}
+
+// promoOverlaps returns the products that are also in another live promo
+// whose period touches the stored period of promoID. Both ends are
+// inclusive, like the promo joins in the product queries. A nil productIDs
+// checks the promo's own products.
+func promoOverlaps(ctx context.Context, tx pgx.Tx, promoID int64, productIDs []int64) ([]PromoConflict, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT p.id, p.title, o.id, o.title, o.start, o."end"
+		FROM promos me
+		JOIN product_promos pp ON pp.promo_id <> me.id
+		JOIN promos o ON o.id = pp.promo_id
+		JOIN products p ON p.id = pp.product_id
+		WHERE me.id = $1 AND o.deleted_at IS NULL
+			AND pp.product_id = ANY(COALESCE($2::bigint[], ARRAY(SELECT product_id FROM product_promos WHERE promo_id = $1)))
+			AND o.start <= me."end" AND o."end" >= me.start
+		ORDER BY p.id, o.start
+	`, promoID, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conflicts := []PromoConflict{}
+	for rows.Next() {
+		var c PromoConflict
+		if err := rows.Scan(&c.ProductID, &c.ProductTitle, &c.PromoID, &c.PromoTitle, &c.Start, &c.End); err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, c)
+	}
+	return conflicts, rows.Err()
+}
+
+// assignPromoProducts adds products to a promo after checking they exist and
+// aren't in an overlapping promo. Products already in the promo are skipped.
+func assignPromoProducts(ctx context.Context, tx pgx.Tx, promoID int64, productIDs []int64) error {
+	productIDs = dedupeIDs(productIDs)
+	if len(productIDs) == 0 {
+		return nil
+	}
+
+	var found int
+	err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM products WHERE id = ANY($1) AND deleted_at IS NULL
+	`, productIDs).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found != len(productIDs) {
+		return ErrPromoProductNotFound
+	}
+
+	conflicts, err := promoOverlaps(ctx, tx, promoID, productIDs)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return &PromoOverlapError{Conflicts: conflicts}
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO product_promos (promo_id, product_id)
+		SELECT $1, unnest($2::bigint[])
+		ON CONFLICT (promo_id, product_id) DO NOTHING
+	`, promoID, productIDs)
+	return err
+}
+
+func dedupeIDs(ids []int64) []int64 {
+	seen := map[int64]bool{}
+	out := []int64{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func CreatePromo(db *pgxpool.Pool, req PromoRequest) (Promo, error) {
+	ctx := context.Background()
+	var promo Promo
+
+	if !req.Start.Before(req.End) {
+		return promo, ErrPromoPeriod
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return promo, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockPromoProducts(ctx, tx); err != nil {
+		return promo, err
+	}
+
+	var id int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO promos (title, description, discount, start, "end", created_at, updated_at)
+		VALUES ($1, $2, $3, $4::timestamptz, $5::timestamptz, NOW(), NOW())
+		RETURNING id
+	`, req.Title, req.Description, req.Discount, req.Start, req.End).Scan(&id)
+	if err != nil {
+		return promo, err
+	}
+
+	if err := assignPromoProducts(ctx, tx, id, req.ProductIDs); err != nil {
+		return promo, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return promo, err
+	}
+
+	return GetPromoByID(db, id)
+}
+
+// GetPromos lists live promos, newest start first. status narrows the list to
+// "active", "upcoming" or "expired" promos.
+func GetPromos(db *pgxpool.Pool, status string, page, limit int) ([]Promo, int, error) {
+	ctx := context.Background()
+
+	where := ` WHERE pr.deleted_at IS NULL`
+	switch status {
+	case "active":
+		where += ` AND pr.start <= NOW() AND pr."end" >= NOW()`
+	case "upcoming":
+		where += ` AND pr.start > NOW()`
+	case "expired":
+		where += ` AND pr."end" < NOW()`
+	}
+
+	var total int
+	if err := db.QueryRow(ctx, `SELECT COUNT(*) FROM promos pr`+where).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	promos, err := queryPromos(ctx, db, `
+		SELECT `+promoColumns+`
+		FROM promos pr`+where+`
+		ORDER BY pr.start DESC, pr.id DESC
+		LIMIT $1 OFFSET $2
+	`, limit, (page-1)*limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	return promos, total, nil
+}
+
+// GetActivePromos lists the promos running now with their products, ending
+// soonest first.
+func GetActivePromos(db *pgxpool.Pool) ([]Promo, error) {
+	return queryPromos(context.Background(), db, `
+		SELECT `+promoColumns+`
+		FROM promos pr
+		WHERE pr.deleted_at IS NULL AND pr.start <= NOW() AND pr."end" >= NOW()
+		ORDER BY pr."end" ASC, pr.id ASC
+	`)
+}
+
+func queryPromos(ctx context.Context, db *pgxpool.Pool, query string, args ...any) ([]Promo, error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	promos := []Promo{}
+	ids := []int64{}
+	for rows.Next() {
+		var p Promo
+		if err := scanPromo(rows, &p); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		p.Products = []PromoProduct{}
+		promos = append(promos, p)
+		ids = append(ids, p.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return promos, nil
+	}
+
+	products, err := promoProducts(ctx, db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range promos {
+		if list, ok := products[promos[i].ID]; ok {
+			promos[i].Products = list
+		}
+	}
+	return promos, nil
+}
+
+// promoProducts returns the live products of each promo.
+func promoProducts(ctx context.Context, db *pgxpool.Pool, promoIDs []int64) (map[int64][]PromoProduct, error) {
+	rows, err := db.Query(ctx, `
+		SELECT pp.promo_id, p.id, COALESCE(p.title, ''), COALESCE(p.base_price, 0)
+		FROM product_promos pp
+		JOIN products p ON p.id = pp.product_id
+		WHERE pp.promo_id = ANY($1) AND p.deleted_at IS NULL
+		ORDER BY p.title, p.id
+	`, promoIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := map[int64][]PromoProduct{}
+	for rows.Next() {
+		var promoID int64
+		var p PromoProduct
+		if err := rows.Scan(&promoID, &p.ID, &p.Title, &p.BasePrice); err != nil {
+			return nil, err
+		}
+		products[promoID] = append(products[promoID], p)
+	}
+	return products, rows.Err()
+}
+
+// GetPromoByID returns a live promo with its products, or pgx.ErrNoRows.
+func GetPromoByID(db *pgxpool.Pool, id int64) (Promo, error) {
+	promos, err := queryPromos(context.Background(), db, `
+		SELECT `+promoColumns+`
+		FROM promos pr
+		WHERE pr.id = $1 AND pr.deleted_at IS NULL
+	`, id)
+	if err != nil {
+		return Promo{}, err
+	}
+	if len(promos) == 0 {
+		return Promo{}, pgx.ErrNoRows
+	}
+	return promos[0], nil
+}
+
+// UpdatePromo changes a promo. A new period is checked against the other
+// promos of its products. Returns pgx.ErrNoRows when the promo doesn't exist.
+func UpdatePromo(db *pgxpool.Pool, id int64, req UpdatePromoRequest) (Promo, error) {
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return Promo{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockPromoProducts(ctx, tx); err != nil {
+		return Promo{}, err
+	}
+
+	var validPeriod bool
+	err = tx.QueryRow(ctx, `
+		UPDATE promos
+		SET title = COALESCE($2, title),
+			description = COALESCE($3, description),
+			discount = COALESCE($4, discount),
+			start = COALESCE($5::timestamptz, start),
+			"end" = COALESCE($6::timestamptz, "end"),
+			updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING start < "end"
+	`, id, req.Title, req.Description, req.Discount, req.Start, req.End).Scan(&validPeriod)
+	if err != nil {
+		return Promo{}, err
+	}
+	if !validPeriod {
+		return Promo{}, ErrPromoPeriod
+	}
+
+	if req.Start != nil || req.End != nil {
+		conflicts, err := promoOverlaps(ctx, tx, id, nil)
+		if err != nil {
+			return Promo{}, err
+		}
+		if len(conflicts) > 0 {
+			return Promo{}, &PromoOverlapError{Conflicts: conflicts}
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Promo{}, err
+	}
+
+	return GetPromoByID(db, id)
+}
+
+// DeletePromo soft-deletes a promo; its product assignments are kept for
+// reference but no longer apply. Returns false when the promo doesn't exist.
+func DeletePromo(db *pgxpool.Pool, id int64) (bool, error) {
+	result, err := db.Exec(context.Background(), `
+		UPDATE promos SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// AddPromoProducts assigns products to a promo. Returns pgx.ErrNoRows when the
+// promo doesn't exist.
+func AddPromoProducts(db *pgxpool.Pool, promoID int64, productIDs []int64) (Promo, error) {
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return Promo{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockPromoProducts(ctx, tx); err != nil {
+		return Promo{}, err
+	}
+
+	var exists bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM promos WHERE id = $1 AND deleted_at IS NULL)`, promoID).Scan(&exists)
+	if err != nil {
+		return Promo{}, err
+	}
+	if !exists {
+		return Promo{}, pgx.ErrNoRows
+	}
+
+	if err := assignPromoProducts(ctx, tx, promoID, productIDs); err != nil {
+		return Promo{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Promo{}, err
+	}
+
+	return GetPromoByID(db, promoID)
+}
+
+// RemovePromoProduct unassigns a product from a promo. Returns false when the
+// product wasn't in the promo.
+func RemovePromoProduct(db *pgxpool.Pool, promoID, productID int64) (bool, error) {
+	result, err := db.Exec(context.Background(), `
+		DELETE FROM product_promos WHERE promo_id = $1 AND product_id = $2
+	`, promoID, productID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// GetRolePermissions returns the permission names granted to role.
+func GetRolePermissions(db *pgxpool.Pool, role string) ([]string, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT p.name
+		FROM role_permissions rp
+		JOIN roles r ON r.id = rp.role_id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE r.name = $1
+		ORDER BY p.name
+	`, role)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, name)
+	}
+	return permissions, rows.Err()
+}
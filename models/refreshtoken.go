@@ -0,0 +1,124 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrRefreshTokenReused = errors.New("refresh token already used")
+
+type RefreshToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"userId"`
+	FamilyID   string     `json:"familyId"`
+	TokenHash  string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	ReplacedBy *int64     `json:"replacedBy,omitempty"`
+	MFA        bool       `json:"mfa"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+func CreateRefreshToken(db *pgxpool.Pool, userID int64, familyID, tokenHash string, mfa bool, expiresAt time.Time) error {
+	_, err := db.Exec(context.Background(), `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, mfa, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, userID, familyID, tokenHash, mfa, expiresAt)
+	return err
+}
+
+func GetRefreshTokenByHash(db *pgxpool.Pool, tokenHash string) (*RefreshToken, error) {
+	var rt RefreshToken
+	err := db.QueryRow(context.Background(), `
+		SELECT id, user_id, family_id, token_hash, expires_at, revoked_at, replaced_by, mfa, created_at
+		FROM refresh_tokens
+		WHERE token_hash=$1
+	`, tokenHash).Scan(
+		&rt.ID, &rt.UserID, &rt.FamilyID, &rt.TokenHash,
+		&rt.ExpiresAt, &rt.RevokedAt, &rt.ReplacedBy, &rt.MFA, &rt.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &rt, nil
+}
+
+// RotateRefreshToken revokes old and issues its replacement in the same family.
+// If old was already revoked (e.g. a concurrent or replayed refresh) it returns
+// ErrRefreshTokenReused and nothing is inserted.
+func RotateRefreshToken(db *pgxpool.Pool, old *RefreshToken, newHash string, expiresAt time.Time) error {
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var newID int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, mfa, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, old.UserID, old.FamilyID, newHash, old.MFA, expiresAt).Scan(&newID)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at=NOW(), replaced_by=$1
+		WHERE id=$2 AND revoked_at IS NULL
+	`, newID, old.ID)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return ErrRefreshTokenReused
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RevokeRefreshTokenFamily also ends the session the family belongs to.
+func RevokeRefreshTokenFamily(db *pgxpool.Pool, familyID string) error {
+	_, err := db.Exec(context.Background(), `
+		WITH sessions AS (
+			UPDATE user_sessions SET revoked_at=NOW()
+			WHERE id=$1 AND revoked_at IS NULL
+		)
+		UPDATE refresh_tokens
+		SET revoked_at=NOW()
+		WHERE family_id=$1 AND revoked_at IS NULL
+	`, familyID)
+	return err
+}
+
+func RevokeUserRefreshTokens(db *pgxpool.Pool, userID int64) error {
+	_, err := db.Exec(context.Background(), `
+		WITH sessions AS (
+			UPDATE user_sessions SET revoked_at=NOW()
+			WHERE user_id=$1 AND revoked_at IS NULL
+		)
+		UPDATE refresh_tokens
+		SET revoked_at=NOW()
+		WHERE user_id=$1 AND revoked_at IS NULL
+	`, userID)
+	return err
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrCartItemLimit is returned when a cart row would hold more units than a
+// customer may reserve of one SKU.
+var ErrCartItemLimit = errors.New("quantity exceeds the per-item cart limit")
+
+// reservedStockExpr is the number of units of SKU k held by unexpired cart
+// reservations.
+const reservedStockExpr = `COALESCE((
+	SELECT SUM(r.quantity) FROM stock_reservations r
+	WHERE r.sku_id = k.id AND r.expires_at > NOW()
+), 0)`
+
+// reservedByOthersExpr is like reservedStockExpr but leaves out the carts of
+// the user bound to param, whose own reservations don't limit them.
+func reservedByOthersExpr(param string) string {
+	return `COALESCE((
+		SELECT SUM(r.quantity) FROM stock_reservations r
+		JOIN carts rc ON rc.id = r.cart_id
+		WHERE r.sku_id = k.id AND r.expires_at > NOW() AND rc.user_id <> ` + param + `
+	), 0)`
+}
+
+// reserveCartItem holds quantity units of the cart row's SKU. A new hold, or
+// one replacing an expired hold, lasts ttl; an unexpired hold only changes
+// quantity and keeps its expiry, so re-adding an item can't extend it.
+func reserveCartItem(ctx context.Context, q stockDB, cartID, skuID int64, quantity int, ttl time.Duration) error {
+	_, err := q.Exec(ctx, `
+		INSERT INTO stock_reservations (cart_id, sku_id, quantity, expires_at)
+		VALUES ($1, $2, $3, NOW() + $4::int * INTERVAL '1 second')
+		ON CONFLICT (cart_id) DO UPDATE SET
+			sku_id = EXCLUDED.sku_id,
+			quantity = EXCLUDED.quantity,
+			expires_at = CASE WHEN stock_reservations.expires_at > NOW()
+				THEN stock_reservations.expires_at ELSE EXCLUDED.expires_at END
+	`, cartID, skuID, quantity, int(ttl.Seconds()))
+	return err
+}
+
+// ReleaseExpiredReservations deletes reservations past their expiry. Expired
+// rows are already ignored when computing available stock; this only keeps
+// the table small. The cart rows themselves are left alone.
+func ReleaseExpiredReservations(db *pgxpool.Pool) (int64, error) {
+	result, err := db.Exec(context.Background(), `DELETE FROM stock_reservations WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+type UserSession struct {
+	ID         string     `json:"id"`
+	UserID     int64      `json:"userId"`
+	UserAgent  *string    `json:"userAgent,omitempty"`
+	IP         *string    `json:"ip,omitempty"`
+	MFA        bool       `json:"mfa"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastSeenAt time.Time  `json:"lastSeenAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	Current    bool       `json:"current"`
+}
+
+func CreateSession(db *pgxpool.Pool, id string, userID int64, userAgent, ip string, mfa bool, expiresAt time.Time) error {
+	_, err := db.Exec(context.Background(), `
+		INSERT INTO user_sessions (id, user_id, user_agent, ip, mfa, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, id, userID, userAgent, ip, mfa, expiresAt)
+	return err
+}
+
+// GetActiveSessions lists the user's sessions that can still be refreshed.
+func GetActiveSessions(db *pgxpool.Pool, userID int64) ([]UserSession, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT id, user_id, user_agent, ip, mfa, created_at, last_seen_at, expires_at, revoked_at
+		FROM user_sessions
+		WHERE user_id=$1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_seen_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []UserSession{}
+	for rows.Next() {
+		var s UserSession
+		err := rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.MFA, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.RevokedAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+// TouchSession updates last-seen data. expiresAt is only moved forward when
+// the refresh token is rotated; pass nil otherwise.
+func TouchSession(db *pgxpool.Pool, id, ip string, expiresAt *time.Time) error {
+	_, err := db.Exec(context.Background(), `
+		UPDATE user_sessions
+		SET last_seen_at=NOW(), ip=$2, expires_at=COALESCE($3, expires_at)
+		WHERE id=$1 AND revoked_at IS NULL
+	`, id, ip, expiresAt)
+	return err
+}
+
+// RevokeSession ends one of the user's sessions and its refresh tokens.
+func RevokeSession(db *pgxpool.Pool, userID int64, id string) error {
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	res, err := tx.Exec(ctx, `
+		UPDATE user_sessions
+		SET revoked_at=NOW()
+		WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at=NOW()
+		WHERE family_id=$1 AND revoked_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
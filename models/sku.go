@@ -0,0 +1,264 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrSKUUnavailable = errors.New("this size/variant of the product is not available")
+	ErrSKUNotOffered  = errors.New("the product is not offered in this size/variant")
+	ErrStockPerSKU    = errors.New("product has several sizes/variants, update stock per SKU")
+)
+
+// skuPriceExpr is the unit price of SKU k of product p with size s and
+// variant v joined: the override when set, else base price plus surcharges.
+const skuPriceExpr = "COALESCE(k.price, p.base_price + COALESCE(s.additional_price, 0) + COALESCE(v.additional_price, 0))"
+
+// ProductSKU is one size/variant combination of a product with its own stock.
+// SizeID or VariantID is nil when the product has no sizes or no variants.
+// Available is Stock minus the units held by unexpired cart reservations.
+type ProductSKU struct {
+	ID            int64     `json:"id"`
+	ProductID     int64     `json:"productId"`
+	SizeID        *int64    `json:"sizeId"`
+	SizeName      *string   `json:"sizeName"`
+	VariantID     *int64    `json:"variantId"`
+	VariantName   *string   `json:"variantName"`
+	Price         float64   `json:"price"`
+	PriceOverride *float64  `json:"priceOverride"`
+	Stock         int       `json:"stock"`
+	Available     int       `json:"available"`
+	IsActive      bool      `json:"isActive"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// SKURequest sets the stock, price override or active flag of the SKU for a
+// size/variant combination when creating or updating a product. A price of 0
+// removes the override.
+type SKURequest struct {
+	SizeID    *int64   `json:"sizeId"`
+	VariantID *int64   `json:"variantId"`
+	Stock     *int     `json:"stock" validate:"omitempty,gte=0"`
+	Price     *float64 `json:"price" validate:"omitempty,gte=0"`
+	IsActive  *bool    `json:"isActive"`
+}
+
+type UpdateSKURequest struct {
+	Stock    *int     `json:"stock" validate:"omitempty,gte=0"`
+	Price    *float64 `json:"price" validate:"omitempty,gte=0"`
+	IsActive *bool    `json:"isActive"`
+}
+
+// ValidateSKURequests checks that every SKU request names a size and variant
+// from the given options (none when the product has no sizes or variants).
+func ValidateSKURequests(sizes, variants []int64, skus []SKURequest) error {
+	offered := func(options []int64, id *int64) bool {
+		if id == nil {
+			return len(options) == 0
+		}
+		for _, o := range options {
+			if o == *id {
+				return true
+			}
+		}
+		return false
+	}
+	for _, sku := range skus {
+		if !offered(sizes, sku.SizeID) || !offered(variants, sku.VariantID) {
+			return ErrSKUNotOffered
+		}
+	}
+	return nil
+}
+
+func GetProductSKUs(db *pgxpool.Pool, productID int64, activeOnly bool) ([]ProductSKU, error) {
+	query := `
+		SELECT k.id, k.product_id, k.size_id, s.name, k.variant_id, v.name,
+			` + skuPriceExpr + `, k.price, k.stock, GREATEST(k.stock - ` + reservedStockExpr + `, 0), k.is_active, k.updated_at
+		FROM product_skus k
+		JOIN products p ON p.id = k.product_id
+		LEFT JOIN sizes s ON s.id = k.size_id
+		LEFT JOIN variants v ON v.id = k.variant_id
+		WHERE k.product_id = $1`
+	if activeOnly {
+		query += " AND k.is_active"
+	}
+	query += " ORDER BY k.size_id NULLS FIRST, k.variant_id NULLS FIRST"
+
+	rows, err := db.Query(context.Background(), query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	skus := []ProductSKU{}
+	for rows.Next() {
+		var k ProductSKU
+		if err := rows.Scan(
+			&k.ID, &k.ProductID, &k.SizeID, &k.SizeName, &k.VariantID, &k.VariantName,
+			&k.Price, &k.PriceOverride, &k.Stock, &k.Available, &k.IsActive, &k.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		skus = append(skus, k)
+	}
+	return skus, rows.Err()
+}
+
+// UpdateProductSKU changes one SKU of a product; a stock change is recorded
+// as an adjustment by userID. Returns pgx.ErrNoRows when the SKU doesn't
+// belong to the product.
+func UpdateProductSKU(db *pgxpool.Pool, productID, skuID int64, req UpdateSKURequest, userID int64) (ProductSKU, error) {
+	ctx := context.Background()
+	var sku ProductSKU
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return sku, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int64
+	err = tx.QueryRow(ctx, `
+		UPDATE product_skus
+		SET price=CASE WHEN $3::numeric IS NULL THEN price WHEN $3::numeric = 0 THEN NULL ELSE $3::numeric END,
+			is_active=COALESCE($4, is_active),
+			updated_at=NOW()
+		WHERE id=$1 AND product_id=$2
+		RETURNING id
+	`, skuID, productID, req.Price, req.IsActive).Scan(&id)
+	if err != nil {
+		return sku, err
+	}
+	if req.Stock != nil {
+		err := setSKUStock(ctx, tx, id, *req.Stock, stockChange{reason: StockReasonAdjustment, userID: stockActor(userID)})
+		if err != nil {
+			return sku, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return sku, err
+	}
+
+	skus, err := GetProductSKUs(db, productID, false)
+	if err != nil {
+		return sku, err
+	}
+	for _, k := range skus {
+		if k.ID == id {
+			return k, nil
+		}
+	}
+	return sku, fmt.Errorf("sku %d not found after update", id)
+}
+
+// syncProductSKUs makes the active SKUs match the product's sizes x variants:
+// missing combinations are created with no stock, combinations that are no
+// longer offered are deactivated (kept for past orders) and offered ones are
+// reactivated.
+func syncProductSKUs(ctx context.Context, q stockDB, productID int64) error {
+	_, err := q.Exec(ctx, `UPDATE product_skus SET is_active=false, updated_at=NOW() WHERE product_id=$1 AND is_active`, productID)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec(ctx, `
+		INSERT INTO product_skus (product_id, size_id, variant_id)
+		SELECT $1::bigint, s.size_id, v.variant_id
+		FROM (SELECT 1) one
+		LEFT JOIN LATERAL (SELECT DISTINCT size_id FROM product_sizes WHERE product_id = $1) s ON true
+		LEFT JOIN LATERAL (SELECT DISTINCT variant_id FROM product_variants WHERE product_id = $1) v ON true
+		ON CONFLICT (product_id, (COALESCE(size_id, 0)), (COALESCE(variant_id, 0)))
+		DO UPDATE SET is_active=true, updated_at=NOW()
+	`, productID)
+	return err
+}
+
+func activeSKUIDs(ctx context.Context, q stockDB, productID int64) ([]int64, error) {
+	rows, err := q.Query(ctx, `
+		SELECT id FROM product_skus
+		WHERE product_id = $1 AND is_active
+		ORDER BY size_id NULLS FIRST, variant_id NULLS FIRST
+	`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// spreadProductStock divides stock over the product's active SKUs, the same
+// way the SKU migration backfilled existing products.
+func spreadProductStock(ctx context.Context, q stockDB, productID int64, stock int, c stockChange) error {
+	ids, err := activeSKUIDs(ctx, q, productID)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	for i, id := range ids {
+		share := stock / len(ids)
+		if i < stock%len(ids) {
+			share++
+		}
+		if err := setSKUStock(ctx, q, id, share, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setSingleSKUStock sets the stock of a product sold in one size/variant
+// only; products with several SKUs return ErrStockPerSKU.
+func setSingleSKUStock(ctx context.Context, q stockDB, productID int64, stock int, c stockChange) error {
+	ids, err := activeSKUIDs(ctx, q, productID)
+	if err != nil {
+		return err
+	}
+	if len(ids) != 1 {
+		return ErrStockPerSKU
+	}
+	return setSKUStock(ctx, q, ids[0], stock, c)
+}
+
+func applySKURequests(ctx context.Context, q stockDB, productID int64, skus []SKURequest, c stockChange) error {
+	for _, sku := range skus {
+		var id int64
+		err := q.QueryRow(ctx, `
+			UPDATE product_skus
+			SET price=CASE WHEN $4::numeric IS NULL THEN price WHEN $4::numeric = 0 THEN NULL ELSE $4::numeric END,
+				is_active=COALESCE($5, is_active),
+				updated_at=NOW()
+			WHERE product_id=$1
+				AND COALESCE(size_id, 0) = COALESCE($2::int, 0)
+				AND COALESCE(variant_id, 0) = COALESCE($3::int, 0)
+			RETURNING id
+		`, productID, sku.SizeID, sku.VariantID, sku.Price, sku.IsActive).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrSKUNotOffered
+		}
+		if err != nil {
+			return err
+		}
+		if sku.Stock != nil {
+			if err := setSKUStock(ctx, q, id, *sku.Stock, c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ProductSuggestion struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	Image string `json:"image"`
+}
+
+type CategorySuggestion struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type SearchSuggestions struct {
+	Query      string               `json:"query"`
+	Products   []ProductSuggestion  `json:"products"`
+	Categories []CategorySuggestion `json:"categories"`
+	Queries    []string             `json:"queries"`
+}
+
+// GetSearchSuggestions returns up to limit products, categories and popular
+// past queries for the typed prefix. Names starting with the prefix come
+// before names with a later word starting with it; ties go to what sells
+// most. prefix must be normalised by NewProductSearch, so it holds no LIKE
+// wildcards.
+func GetSearchSuggestions(db *pgxpool.Pool, prefix string, limit, minQueryHits int) (*SearchSuggestions, error) {
+	ctx := context.Background()
+	s := &SearchSuggestions{
+		Query:      prefix,
+		Products:   []ProductSuggestion{},
+		Categories: []CategorySuggestion{},
+		Queries:    []string{},
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT p.id, p.title,
+			COALESCE((SELECT image FROM product_images WHERE product_id = p.id ORDER BY id LIMIT 1), '') AS image
+		FROM products p
+		LEFT JOIN (
+			SELECT product_id, SUM(quantity) AS sold
+			FROM transaction_items
+			GROUP BY product_id
+		) ti ON ti.product_id = p.id
+		WHERE p.deleted_at IS NULL
+			AND (LOWER(p.title) LIKE $1::text || '%' OR LOWER(p.title) LIKE '% ' || $1::text || '%')
+		ORDER BY LOWER(p.title) LIKE $1::text || '%' DESC, COALESCE(ti.sold, 0) DESC, p.title
+		LIMIT $2
+	`, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var p ProductSuggestion
+		if err := rows.Scan(&p.ID, &p.Title, &p.Image); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		s.Products = append(s.Products, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(ctx, `
+		SELECT c.id, c.name
+		FROM categories c
+		LEFT JOIN products p ON p.category_id = c.id AND p.deleted_at IS NULL
+		LEFT JOIN transaction_items ti ON ti.product_id = p.id
+		WHERE LOWER(c.name) LIKE $1::text || '%' OR LOWER(c.name) LIKE '% ' || $1::text || '%'
+		GROUP BY c.id, c.name
+		ORDER BY LOWER(c.name) LIKE $1::text || '%' DESC, COALESCE(SUM(ti.quantity), 0) DESC, c.name
+		LIMIT $2
+	`, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var c CategorySuggestion
+		if err := rows.Scan(&c.ID, &c.Name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		s.Categories = append(s.Categories, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(ctx, `
+		SELECT query FROM search_queries
+		WHERE query LIKE $1::text || '%' AND hits >= $3
+		ORDER BY hits DESC, last_searched_at DESC
+		LIMIT $2
+	`, prefix, limit, minQueryHits)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var q string
+		if err := rows.Scan(&q); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		s.Queries = append(s.Queries, q)
+	}
+	rows.Close()
+	return s, rows.Err()
+}
+
+// RecordSearchQuery counts searcher as having searched for query. hits is the
+// number of distinct searchers, so repeats by the same searcher are ignored.
+func RecordSearchQuery(db *pgxpool.Pool, query, searcher string) error {
+	if r := []rune(query); len(r) > 100 {
+		query = string(r[:100])
+	}
+	_, err := db.Exec(context.Background(), `
+		WITH seen AS (
+			INSERT INTO search_query_searchers (query, searcher) VALUES ($1, $2)
+			ON CONFLICT (query, searcher) DO NOTHING
+			RETURNING query
+		)
+		INSERT INTO search_queries (query) SELECT query FROM seen
+		ON CONFLICT (query)
+		DO UPDATE SET hits = search_queries.hits + 1, last_searched_at = NOW()
+	`, query, searcher)
+	return err
+}
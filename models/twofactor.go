@@ -0,0 +1,187 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrTOTPAlreadyEnabled = errors.New("two-factor authentication already enabled")
+
+type UserTOTP struct {
+	UserID          int64      `json:"userId"`
+	SecretEncrypted string     `json:"-"`
+	EnabledAt       *time.Time `json:"enabledAt,omitempty"`
+	LastUsedStep    int64      `json:"-"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TwoFactorDisableRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+type TwoFactorSetupResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauthUri"`
+	QRCode     string `json:"qrCode"`
+}
+
+type TwoFactorEnableResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+	Token         string   `json:"token"`
+	RefreshToken  string   `json:"refreshToken"`
+}
+
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+}
+
+func GetUserTOTP(db *pgxpool.Pool, userID int64) (*UserTOTP, error) {
+	var t UserTOTP
+	err := db.QueryRow(context.Background(), `
+		SELECT user_id, secret_encrypted, enabled_at, last_used_step, created_at
+		FROM user_totp
+		WHERE user_id=$1
+	`, userID).Scan(&t.UserID, &t.SecretEncrypted, &t.EnabledAt, &t.LastUsedStep, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func IsTOTPEnabled(db *pgxpool.Pool, userID int64) (bool, error) {
+	t, err := GetUserTOTP(db, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return t.EnabledAt != nil, nil
+}
+
+// SavePendingTOTP stores a new secret awaiting confirmation, replacing any
+// earlier unconfirmed one. An enabled secret is never overwritten.
+func SavePendingTOTP(db *pgxpool.Pool, userID int64, secretEncrypted string) error {
+	res, err := db.Exec(context.Background(), `
+		INSERT INTO user_totp (user_id, secret_encrypted)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id)
+		DO UPDATE SET secret_encrypted = EXCLUDED.secret_encrypted,
+		              last_used_step = 0,
+		              created_at = NOW(),
+		              updated_at = NOW()
+		WHERE user_totp.enabled_at IS NULL
+	`, userID, secretEncrypted)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+	return nil
+}
+
+// EnableTOTP confirms the pending secret and replaces the recovery codes.
+func EnableTOTP(db *pgxpool.Pool, userID int64, step int64, recoveryCodeHashes []string) error {
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	res, err := tx.Exec(ctx, `
+		UPDATE user_totp
+		SET enabled_at=NOW(), last_used_step=$2, updated_at=NOW()
+		WHERE user_id=$1 AND enabled_at IS NULL
+	`, userID, step)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM totp_recovery_codes WHERE user_id=$1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO totp_recovery_codes (user_id, code_hash)
+			VALUES ($1, $2)
+		`, userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func DisableTOTP(db *pgxpool.Pool, userID int64) error {
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM totp_recovery_codes WHERE user_id=$1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id=$1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ConsumeTOTPStep records step as used. It reports false when the step (or a
+// later one) was already accepted, which blocks replaying a code.
+func ConsumeTOTPStep(db *pgxpool.Pool, userID int64, step int64) (bool, error) {
+	res, err := db.Exec(context.Background(), `
+		UPDATE user_totp
+		SET last_used_step=$2, updated_at=NOW()
+		WHERE user_id=$1 AND last_used_step < $2
+	`, userID, step)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+// ConsumeRecoveryCode marks an unused recovery code as used.
+func ConsumeRecoveryCode(db *pgxpool.Pool, userID int64, codeHash string) (bool, error) {
+	res, err := db.Exec(context.Background(), `
+		UPDATE totp_recovery_codes
+		SET used_at=NOW()
+		WHERE id = (
+			SELECT id FROM totp_recovery_codes
+			WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL
+			LIMIT 1
+		) AND used_at IS NULL
+	`, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
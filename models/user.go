@@ -50,7 +50,9 @@ type ProfileResponse struct {
 
 
 
-func UpdateProfile(db *pgxpool.Pool, userID int64, phone, address, fullname, email string, fileHeader *multipart.FileHeader) (ProfileResponse, error) {
+// UpdateProfile never changes the email; that goes through the confirmation
+// link flow instead.
+func UpdateProfile(db *pgxpool.Pool, userID int64, phone, address, fullname string, fileHeader *multipart.FileHeader) (ProfileResponse, error) {
 	ctx := context.Background()
 	var imagePath *string
 
@@ -123,14 +125,13 @@ func UpdateProfile(db *pgxpool.Pool, userID int64, phone, address, fullname, ema
 		return ProfileResponse{}, err
 	}
 
-	if fullname != "" || email != "" {
+	if fullname != "" {
 		_, err := db.Exec(ctx, `
 			UPDATE users
-			SET fullname = COALESCE(NULLIF($1, ''), fullname),
-				email = COALESCE(NULLIF($2, ''), email),
+			SET fullname = $1,
 				updated_at = NOW()
-			WHERE id = $3
-		`, fullname, email, userID)
+			WHERE id = $2
+		`, fullname, userID)
 		if err != nil {
 			return ProfileResponse{}, err
 		}
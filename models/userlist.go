@@ -34,10 +34,10 @@ type Profile struct {
 type AdminUserRequest struct {
     Fullname string                `form:"fullname" binding:"required" validate:"required,min=3"`
     Email    string                `form:"email" binding:"required,email" validate:"required,email"`
-    Password string                `form:"password" binding:"required,min=6" validate:"required,min=6"`
+    Password string                `form:"password" binding:"required" validate:"required"`
     Phone    string                `form:"phone" validate:"omitempty,min=10"`
     Address  string                `form:"address" validate:"omitempty"`
-    Role     string                `form:"role" binding:"required" validate:"required,oneof=admin staff user"`
+    Role     string                `form:"role" binding:"required" validate:"required,oneof=admin manager barista customer"`
     Image    *multipart.FileHeader `form:"image" validate:"omitempty"`
 }
 
@@ -70,6 +70,10 @@ func AddUser(db *pgxpool.Pool, fullname, email, password, role string, phone, ad
 
 	u.ID = userID
 
+	if err := recordPasswordHistory(ctx, db, userID, hashed); err != nil {
+		return nil, nil, err
+	}
+
 	var imgPtr *string
 	if imagePath != "" {
 		imgPtr = &imagePath
@@ -153,8 +157,10 @@ func UpdateUser(db *pgxpool.Pool, userID int64, fullname, email, password, phone
 		args = append(args, email)
 		argIdx++
 	}
+	var hashed string
 	if password != "" {
-		hashed, err := libs.HashPassword(password)
+		var err error
+		hashed, err = libs.HashPassword(password)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -171,6 +177,12 @@ func UpdateUser(db *pgxpool.Pool, userID int64, fullname, email, password, phone
 		}
 	}
 
+	if hashed != "" {
+		if err := recordPasswordHistory(ctx, db, userID, hashed); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	profileFields := []string{}
 	profileArgs := []interface{}{}
 	pIdx := 1
@@ -0,0 +1,21 @@
+package routers
+
+import (
+	"coffeeder-backend/controllers"
+	"coffeeder-backend/middlewares"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func APIKeyRoutes(r *gin.Engine, pg *pgxpool.Pool) {
+	kc := controllers.APIKeyController{DB: pg}
+
+	admin := r.Group("/admin")
+	admin.Use(middlewares.AuthMiddleware(""))
+	{
+		admin.GET("/api-keys", middlewares.RequirePermission("api-keys:manage"), kc.GetAPIKeys)
+		admin.POST("/api-keys", middlewares.RequirePermission("api-keys:manage"), kc.CreateAPIKey)
+		admin.DELETE("/api-keys/:id", middlewares.RequirePermission("api-keys:manage"), kc.RevokeAPIKey)
+	}
+}
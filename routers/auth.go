@@ -2,6 +2,8 @@ package routers
 
 import (
 	"coffeeder-backend/controllers"
+	"coffeeder-backend/middlewares"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -10,12 +12,28 @@ import (
 func AuthRoutes(r *gin.Engine, pg *pgxpool.Pool) {
 	authController := controllers.AuthController{DB: pg}
 
+	r.GET("/.well-known/jwks.json", authController.JWKS)
+
 	auth := r.Group("/auth")
 	{
 		auth.POST("/register", authController.Register)
-		auth.POST("/login", authController.Login)
-		auth.POST("/forgot-password", authController.ForgotPassword)
-		auth.POST("/verify-otp", authController.VerifyOTP)
+		auth.POST("/verify-email", authController.VerifyEmail)
+		auth.POST("/resend-verification", middlewares.AuthRateLimit("resend-verification", 10, 3, time.Hour), authController.ResendVerification)
+		auth.POST("/login", middlewares.AuthRateLimit("login", 30, 10, 15*time.Minute), authController.Login)
+		auth.POST("/magic-link", middlewares.AuthRateLimit("magic-link", 10, 3, time.Hour), authController.RequestMagicLink)
+		auth.POST("/magic-link/consume", middlewares.AuthRateLimit("magic-link-consume", 20, 0, 15*time.Minute), authController.ConsumeMagicLink)
+		auth.GET("/oidc/providers", authController.GetOIDCProviders)
+		auth.GET("/oidc/:provider/start", middlewares.AuthRateLimit("oidc-start", 30, 0, 15*time.Minute), authController.StartOIDCLogin)
+		auth.POST("/oidc/:provider/callback", middlewares.AuthRateLimit("oidc-callback", 30, 0, 15*time.Minute), authController.OIDCCallback)
+		auth.POST("/invitations/accept", authController.AcceptInvitation)
+		auth.POST("/refresh", authController.Refresh)
+		auth.POST("/2fa/verify", middlewares.AuthRateLimit("2fa-verify", 20, 0, 15*time.Minute), authController.VerifyTwoFactor)
+		auth.POST("/2fa/setup", middlewares.AuthMiddleware(""), authController.SetupTwoFactor)
+		auth.POST("/2fa/enable", middlewares.AuthMiddleware(""), authController.EnableTwoFactor)
+		auth.POST("/2fa/disable", middlewares.AuthMiddleware(""), authController.DisableTwoFactor)
+		auth.POST("/logout", middlewares.AuthMiddleware(""), authController.Logout)
+		auth.POST("/forgot-password", middlewares.AuthRateLimit("forgot-password", 10, 5, time.Hour), authController.ForgotPassword)
+		auth.POST("/verify-otp", middlewares.AuthRateLimit("verify-otp", 20, 10, 15*time.Minute), authController.VerifyOTP)
 		auth.PATCH("/reset-password", authController.ResetPassword)
 	}
 }
@@ -12,13 +12,13 @@ func CategoryRoutes(r *gin.Engine, pg *pgxpool.Pool) {
 	cc := controllers.CategoryController{DB: pg}
 
 	admin := r.Group("/admin")
-	admin.Use(middlewares.AuthMiddleware("admin"))
+	admin.Use(middlewares.AuthMiddleware(""))
 	{
-		admin.GET("/categories", cc.GetCategories)
-		admin.GET("/categories/:id", cc.GetCategoryByID)
-		admin.POST("/categories", cc.CreateCategory)
-		admin.PATCH("/categories/:id", cc.UpdateCategory)
-		admin.DELETE("/categories/:id", cc.DeleteCategory)
+		admin.GET("/categories", middlewares.RequirePermission("categories:read"), cc.GetCategories)
+		admin.GET("/categories/:id", middlewares.RequirePermission("categories:read"), cc.GetCategoryByID)
+		admin.POST("/categories", middlewares.RequirePermission("categories:create"), cc.CreateCategory)
+		admin.PATCH("/categories/:id", middlewares.RequirePermission("categories:update"), cc.UpdateCategory)
+		admin.DELETE("/categories/:id", middlewares.RequirePermission("categories:delete"), cc.DeleteCategory)
 	}
 	r.GET("/category", cc.GetCategories)
 }
@@ -12,15 +12,15 @@ func TransactionRoutes(r *gin.Engine, pg *pgxpool.Pool) {
 	tc := controllers.TransactionController{DB: pg}
 
 	admin := r.Group("/admin")
-	admin.Use(middlewares.AuthMiddleware("admin"))
+	admin.Use(middlewares.AuthMiddleware(""))
 	{
-		admin.GET("/transactions", tc.GetTransactions)
-		admin.GET("/transactions/:id", tc.GetTransactionByID)
-		admin.PATCH("/transactions/:id/status", tc.UpdateTransactionStatus)
-		admin.DELETE("/transactions/:id", tc.DeleteTransaction)
+		admin.GET("/transactions", middlewares.RequirePermission("orders:read"), tc.GetTransactions)
+		admin.GET("/transactions/:id", middlewares.RequirePermission("orders:read"), tc.GetTransactionByID)
+		admin.PATCH("/transactions/:id/status", middlewares.RequirePermission("orders:update"), tc.UpdateTransactionStatus)
+		admin.DELETE("/transactions/:id", middlewares.RequirePermission("orders:delete"), tc.DeleteTransaction)
 	}
-	r.GET("/history", middlewares.AuthMiddleware(""), tc.GetHistoryTransactions)
-	r.GET("/history/:id", middlewares.AuthMiddleware(""), tc.GetHistoryDetailById)
-	r.GET("/shippings", middlewares.AuthMiddleware(""), tc.GetShippingMethods)
-	r.GET("/payment-methods", middlewares.AuthMiddleware(""), tc.GetPaymentMethods)
+	r.GET("/history", middlewares.AuthMiddleware(""), middlewares.RequirePermission("orders:history"), tc.GetHistoryTransactions)
+	r.GET("/history/:id", middlewares.AuthMiddleware(""), middlewares.RequirePermission("orders:history"), tc.GetHistoryDetailById)
+	r.GET("/shippings", middlewares.AuthMiddleware(""), middlewares.RequirePermission("orders:create"), tc.GetShippingMethods)
+	r.GET("/payment-methods", middlewares.AuthMiddleware(""), middlewares.RequirePermission("orders:create"), tc.GetPaymentMethods)
 }
@@ -12,24 +12,34 @@ func ProductRoutes(r *gin.Engine, pg *pgxpool.Pool) {
 	pc := controllers.ProductController{DB: pg}
 
 	admin := r.Group("/admin")
-	admin.Use(middlewares.AuthMiddleware("admin"))
+	admin.Use(middlewares.AuthMiddleware(""))
 	{
-		admin.POST("/products", pc.CreateProduct)
-		admin.GET("/products", pc.GetProducts)
-		admin.GET("/products/:id", pc.GetProductByID)
-		admin.PATCH("/products/:id", pc.UpdateProduct)
-		admin.DELETE("/products/:id", pc.DeleteProduct)
-		admin.GET("/products/:id/images", pc.GetProductImages)             
-		admin.GET("/products/:id/images/:image_id", pc.GetProductImageByID) 
-		admin.PATCH("/products/:id/images/:image_id", pc.UpdateProductImage) 
-		admin.DELETE("/products/:id/images/:image_id", pc.DeleteProductImage)
-		admin.GET("type-products", pc.GetTypeProduct) 
+		admin.POST("/products", middlewares.RequirePermission("products:create"), pc.CreateProduct)
+		admin.GET("/products", middlewares.RequirePermission("products:read"), pc.GetProducts)
+		admin.GET("/products/trash", middlewares.RequirePermission("products:trash"), pc.GetTrashedProducts)
+		admin.GET("/products/:id", middlewares.RequirePermission("products:read"), pc.GetProductByID)
+		admin.PATCH("/products/:id", middlewares.RequirePermission("products:update"), pc.UpdateProduct)
+		admin.DELETE("/products/:id", middlewares.RequirePermission("products:delete"), pc.DeleteProduct)
+		admin.POST("/products/:id/restore", middlewares.RequirePermission("products:trash"), pc.RestoreProduct)
+		admin.DELETE("/products/:id/purge", middlewares.RequirePermission("products:trash"), pc.PurgeProduct)
+		admin.GET("/products/:id/images", middlewares.RequirePermission("products:read"), pc.GetProductImages)             
+		admin.GET("/products/:id/images/:image_id", middlewares.RequirePermission("products:read"), pc.GetProductImageByID) 
+		admin.PATCH("/products/:id/images/:image_id", middlewares.RequirePermission("products:update"), pc.UpdateProductImage) 
+		admin.DELETE("/products/:id/images/:image_id", middlewares.RequirePermission("products:delete"), pc.DeleteProductImage)
+		admin.GET("/products/:id/skus", middlewares.RequirePermission("products:read"), pc.GetProductSKUs)
+		admin.PATCH("/products/:id/skus/:sku_id", middlewares.RequirePermission("products:update"), pc.UpdateProductSKU)
+		admin.GET("/products/:id/stock-movements", middlewares.RequirePermission("inventory:read"), pc.GetStockMovements)
+		admin.POST("/inventory/adjustments", middlewares.RequirePermission("inventory:adjust"), pc.AdjustStock)
+		admin.GET("/inventory/low-stock", middlewares.RequirePermission("inventory:read"), pc.GetLowStock)
+		admin.POST("/inventory/low-stock/notify", middlewares.RequirePermission("inventory:adjust"), pc.RunLowStockAlerts)
+		admin.GET("type-products", middlewares.RequirePermission("products:read"), pc.GetTypeProduct) 
 	}
 	r.GET("/favorite-products",pc.GetFavoriteProducts)
 	r.GET("/products",pc.FilterProducts)
+	r.GET("/products/suggest",pc.SuggestProducts)
 	r.GET("/products/:id",pc.GetProductDetail)
-	r.POST("/cart",middlewares.AuthMiddleware(""), pc.AddToCart)
-	r.GET("/cart", middlewares.AuthMiddleware(""), pc.GetCart)
-	r.DELETE("/deletecart", middlewares.AuthMiddleware(""), pc.DeleteCart)
-	r.POST("/transactions", middlewares.AuthMiddleware(""), pc.CreateTransaction)
+	r.POST("/cart",middlewares.AuthMiddleware(""), middlewares.RequirePermission("cart:manage"), pc.AddToCart)
+	r.GET("/cart", middlewares.AuthMiddleware(""), middlewares.RequirePermission("cart:manage"), pc.GetCart)
+	r.DELETE("/deletecart", middlewares.AuthMiddleware(""), middlewares.RequirePermission("cart:manage"), pc.DeleteCart)
+	r.POST("/transactions", middlewares.AuthMiddleware(""), middlewares.RequirePermission("orders:create"), pc.CreateTransaction)
 }
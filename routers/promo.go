@@ -0,0 +1,26 @@
+package routers
+
+import (
+	"coffeeder-backend/controllers"
+	"coffeeder-backend/middlewares"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func PromoRoutes(r *gin.Engine, pg *pgxpool.Pool) {
+	pc := controllers.PromoController{DB: pg}
+
+	admin := r.Group("/admin")
+	admin.Use(middlewares.AuthMiddleware(""))
+	{
+		admin.GET("/promos", middlewares.RequirePermission("promos:read"), pc.GetPromos)
+		admin.GET("/promos/:id", middlewares.RequirePermission("promos:read"), pc.GetPromoByID)
+		admin.POST("/promos", middlewares.RequirePermission("promos:create"), pc.CreatePromo)
+		admin.PATCH("/promos/:id", middlewares.RequirePermission("promos:update"), pc.UpdatePromo)
+		admin.DELETE("/promos/:id", middlewares.RequirePermission("promos:delete"), pc.DeletePromo)
+		admin.POST("/promos/:id/products", middlewares.RequirePermission("promos:update"), pc.AddPromoProducts)
+		admin.DELETE("/promos/:id/products/:product_id", middlewares.RequirePermission("promos:update"), pc.RemovePromoProduct)
+	}
+	r.GET("/promos/active", pc.GetActivePromos)
+}
@@ -25,5 +25,8 @@ func InitRouter(pg *pgxpool.Pool) *gin.Engine {
 	TransactionRoutes(r, pg)
 	AdminUserRoutes(r, pg)
 	CategoryRoutes(r, pg)
+	APIKeyRoutes(r, pg)
+	SessionRoutes(r, pg)
+	PromoRoutes(r, pg)
 	return r
 }
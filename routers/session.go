@@ -0,0 +1,27 @@
+package routers
+
+import (
+	"coffeeder-backend/controllers"
+	"coffeeder-backend/middlewares"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func SessionRoutes(r *gin.Engine, pg *pgxpool.Pool) {
+	sc := controllers.SessionController{DB: pg}
+
+	sessions := r.Group("/sessions")
+	sessions.Use(middlewares.AuthMiddleware(""))
+	{
+		sessions.GET("", middlewares.RequirePermission("profile:read"), sc.GetSessions)
+		sessions.DELETE("/:id", middlewares.RequirePermission("profile:update"), sc.RevokeSession)
+	}
+
+	admin := r.Group("/admin")
+	admin.Use(middlewares.AuthMiddleware(""))
+	{
+		admin.GET("/users/:id/sessions", middlewares.RequirePermission("users:read"), sc.GetUserSessions)
+		admin.DELETE("/users/:id/sessions/:sessionId", middlewares.RequirePermission("users:update"), sc.RevokeUserSession)
+	}
+}
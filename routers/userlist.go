@@ -10,16 +10,32 @@ import (
 
 func AdminUserRoutes(r *gin.Engine, pg *pgxpool.Pool) {
 	uc := controllers.UserController{DB: pg}
+	ic := controllers.InvitationController{DB: pg}
+	lc := controllers.LockoutController{DB: pg}
 
 	admin := r.Group("/admin")
-	admin.Use(middlewares.AuthMiddleware("admin"))
+	admin.Use(middlewares.AuthMiddleware(""))
 	{
-		admin.GET("/users", uc.GetUsersList)
-		admin.GET("/users/:id", uc.GetUserByID)
-		admin.POST("/users", uc.AddUser)
-		admin.PATCH("/users/:id", uc.EditUser)
-		admin.DELETE("/users/:id", uc.DeleteUser)
+		admin.GET("/users", middlewares.RequirePermission("users:read"), uc.GetUsersList)
+		admin.GET("/users/:id", middlewares.RequirePermission("users:read"), uc.GetUserByID)
+		admin.POST("/users", middlewares.RequirePermission("users:create"), uc.AddUser)
+		admin.PATCH("/users/:id", middlewares.RequirePermission("users:update"), uc.EditUser)
+		admin.DELETE("/users/:id", middlewares.RequirePermission("users:delete"), uc.DeleteUser)
+		admin.POST("/users/:id/revoke-tokens", middlewares.RequirePermission("users:update"), uc.RevokeUserTokens)
+		admin.POST("/users/deletions/run", middlewares.RequirePermission("users:delete"), uc.RunAccountDeletions)
+		admin.GET("/users/invitations", middlewares.RequirePermission("users:invite"), ic.GetInvitations)
+		admin.POST("/users/invitations", middlewares.RequirePermission("users:invite"), ic.CreateInvitation)
+		admin.DELETE("/users/invitations/:id", middlewares.RequirePermission("users:invite"), ic.RevokeInvitation)
+		admin.GET("/lockouts", middlewares.RequirePermission("auth:lockouts"), lc.GetLockouts)
+		admin.DELETE("/lockouts/:email", middlewares.RequirePermission("auth:lockouts"), lc.ClearLockout)
 	}
-	r.PATCH("/profile", middlewares.AuthMiddleware(""), uc.UpdateProfile)
-	r.GET("/profile", middlewares.AuthMiddleware(""), uc.GetProfile)
+	r.PATCH("/profile", middlewares.AuthMiddleware(""), middlewares.RequirePermission("profile:update"), uc.UpdateProfile)
+	r.GET("/profile", middlewares.AuthMiddleware(""), middlewares.RequirePermission("profile:read"), uc.GetProfile)
+	r.DELETE("/profile", middlewares.AuthMiddleware(""), middlewares.RequirePermission("profile:update"), uc.DeleteAccount)
+	r.GET("/profile/export", middlewares.AuthMiddleware(""), middlewares.RequirePermission("profile:read"), uc.ExportProfile)
+	r.POST("/profile/deletion/confirm", uc.ConfirmAccountDeletion)
+	r.POST("/profile/deletion/cancel", middlewares.AuthMiddleware(""), middlewares.RequirePermission("profile:update"), uc.CancelAccountDeletion)
+	r.PATCH("/profile/password", middlewares.AuthMiddleware(""), middlewares.RequirePermission("profile:update"), uc.ChangePassword)
+	r.POST("/profile/email", middlewares.AuthMiddleware(""), middlewares.RequirePermission("profile:update"), uc.RequestEmailChange)
+	r.POST("/profile/email/confirm", uc.ConfirmEmailChange)
 }